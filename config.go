@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// config prints the effective settings of the gen command for a
+// directory, combining its fm.toml files with any flags
+func config(args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Println("Usage: fm config show [gen flags]")
+		os.Exit(1)
+	}
+
+	f := newGenFlags("config show")
+	_ = f.fs.Parse(args[1:])
+
+	cfg, err := f.configure()
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, filename := range cfg.Files {
+		fmt.Printf("# read %s\n", filename)
+	}
+	_, _ = cfg.WriteTo(os.Stdout)
+}
@@ -8,7 +8,103 @@ Example Usage
 Generate spy implementations:
     $ fm
 
+which is the same as running the gen command:
+    $ fm gen
+
 Pass command line arguments:
     $ fm -dir example/ -out example_spies_test
+
+Generate mocks, which fail the test on unexpected calls, instead of spies:
+    $ fm -kind mock -out fm_mock_test
+
+Generate dummies which panic when called, stubs which only return
+canned values, or delegates which record calls before passing them on:
+    $ fm -kind stub -out fm_stub_test
+
+Write spies into the package itself, e.g., for unexported interfaces:
+    $ fm -internal
+
+Write spies into a regular package which other packages may import:
+    $ fm -pkg fakes -outdir internal/fakes
+
+fm only overwrites files it generated. To replace any other file:
+    $ fm -force
+
+fm reports each declaration it skips by position. To fail instead:
+    $ fm -strict
+
+Describe the generated test doubles as JSON, in a file or on stdout:
+    $ fm -manifest fm.json
+    $ fm -format json
+
+Only files built for GOOS, GOARCH, and the given tags are parsed. To copy
+each file's build constraint onto its spies, e.g., into fm_linux_build_test.go:
+    $ GOOS=linux fm -tags integration -constraints
+
+Include interfaces declared in test files, e.g., export_test.go, and skip
+generated protobuf code. Files generated by fm are never parsed:
+    $ fm -tests -exclude-files '*.pb.go'
+
+Named func types, such as type Clock func() time.Time, get a spy whose
+method of the same name is passed in their place:
+    now := &SpyClock{}
+    Stamp("laundry", now.Clock)
+
+Every spy logs the names of its methods as they are called. To implement
+several interfaces with a single spy and a single log, e.g., SpyDoerRepeater,
+compose them, here or with compose = ["Doer+Repeater"] in fm.toml:
+    $ fm -compose Doer+Repeater
+Only interfaces declared by the package may be composed, not those of
+other packages such as io.WriterTo.
+
+Spies may be reused with Reset, which clears the recorded calls and the
+configured results. Snapshot copies the recorded calls, e.g., into a
+SpyDoerSnapshot, to inspect while calls are still being made.
+
+Spy on only some methods of large interfaces, e.g., all Get methods and
+Put. The others panic when called, with "method Delete not spied":
+    $ fm -methods 'Get*,Put'
+
+Generic interfaces are skipped unless instantiated, here or with iface in
+fm.toml, e.g., SpyRepoUser implements Repo[example.User]:
+    $ fm -iface 'Repo[example.User]'
+
+Directives in the doc comment of an interface control its generation:
+    //fm:skip            leaves the interface out
+    //fm:name FakeStore  names the generated type FakeStore
+    //fm:kind stub       generates a stub, unless the kind flag is passed
+
+Interfaces with a kind directive are generated in the run without the kind
+flag only, so that a run per kind, each with its own file, declares them once.
+
+Settings may be checked in as fm.toml files, read from the module root
+down to the directory, with flags taking precedence:
+    kind = "mock"
+    exclude = ["Legacy*"]
+
+    [names]
+    Doer = "FakeDoer"
+
+    [packages."internal/store"]
+    kind = "stub"
+    include = ["Store*"]
+
+Print the effective settings for a directory:
+    $ fm config show -dir internal/store
+
+Declare an interface holding the methods of a concrete type, written to
+client_interface.go, and generate its spies along with the others:
+    $ fm extract -type Client -from net/http -methods Do,Get -name HTTPClient
+
+Generate spies for the dependencies of a struct instead, i.e., every field
+whose type is an interface, including io.Reader or interface{ Log(string) },
+which is spied on by SpyDelegatorLogger for a field named logger:
+    $ fm -deps Delegator
+
+List the interfaces fm would pick up, and whether they are supported:
+    $ fm list ./...
+
+Print the version:
+    $ fm version
 */
 package main
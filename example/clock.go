@@ -0,0 +1,11 @@
+package example
+
+import "time"
+
+// Clock tells the current time
+type Clock func() time.Time
+
+// Stamp prefixes a task with the time it was handed out
+func Stamp(task string, now Clock) string {
+	return now().Format(time.RFC3339) + " " + task
+}
@@ -1,10 +1,17 @@
 package example_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/enocom/fm/example"
+	"github.com/enocom/fm/example/internal/fakes"
 )
 
 func TestDelegatorCallsDoer(t *testing.T) {
@@ -66,6 +73,106 @@ func TestDelegatorReturnsDoerResult(t *testing.T) {
 	}
 }
 
+func TestDelegatorReturnsDoerResultForTask(t *testing.T) {
+	spyDoer := &SpyDoer{}
+	spyDoer.DoItReturnsWhen(func(task string, graciously bool) bool {
+		return task == "laundry"
+	}, 1, nil)
+	expectedErr := errors.New("some-error")
+	spyDoer.DoIt_Output.Ret1 = expectedErr
+	d := &example.Delegator{Delegate: spyDoer}
+
+	n, err := d.DoSomething("laundry")
+
+	if n != 1 || err != nil {
+		t.Errorf("wanted: %v, %v, but got %v, %v", 1, nil, n, err)
+	}
+
+	n, err = d.DoSomething("dishes")
+
+	if n != 0 || err != expectedErr {
+		t.Errorf("wanted: %v, %v, but got %v, %v", 0, expectedErr, n, err)
+	}
+}
+
+func TestDelegatorReturnsDoerResultForCallCount(t *testing.T) {
+	spyDoer := &SpyDoer{}
+	// the rule inspects the spy, which it may do while the call is made
+	spyDoer.DoItReturnsWhen(func(task string, graciously bool) bool {
+		return spyDoer.Snapshot().DoIt_CallCount > 1
+	}, 1, nil)
+	d := &example.Delegator{Delegate: spyDoer}
+
+	results := make(chan int)
+	go func() {
+		for i := 0; i < 2; i++ {
+			n, _ := d.DoSomething("laundry")
+			results <- n
+		}
+	}()
+
+	for _, want := range []int{0, 1} {
+		select {
+		case got := <-results:
+			if want != got {
+				t.Errorf("wanted: %v, but got %v", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("wanted the rule to inspect the spy, but the call deadlocked")
+		}
+	}
+}
+
+func TestDelegatorCallsDoerFromGoroutine(t *testing.T) {
+	spyDoer := &SpyDoer{}
+	d := &example.Delegator{Delegate: spyDoer}
+
+	go d.DoSomething("laundry")
+	go d.DoSomething("dishes")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := spyDoer.WaitForDoIt(ctx, 2)
+
+	if err != nil {
+		t.Errorf("wanted: %v, but got %v", nil, err)
+	}
+}
+
+func TestDelegatorWaitsForBlockedDoer(t *testing.T) {
+	spyDoer := &SpyDoer{}
+	spyDoer.DoIt_Output.Ret0 = 42
+	spyDoer.BlockDoIt()
+	d := &example.Delegator{Delegate: spyDoer}
+
+	result := make(chan int)
+	go func() {
+		n, _ := d.DoSomething("laundry")
+		result <- n
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := spyDoer.WaitForDoIt(ctx, 1); err != nil {
+		t.Fatalf("WaitForDoIt failed with %v", err)
+	}
+
+	select {
+	case <-result:
+		t.Fatal("wanted DoSomething to block, but it returned")
+	default:
+	}
+
+	spyDoer.ReleaseDoIt()
+
+	want := 42
+	got := <-result
+
+	if want != got {
+		t.Errorf("wanted: %v, but got %v", want, got)
+	}
+}
+
 func TestDelegatorCallsRepeater(t *testing.T) {
 	r := &SpyRepeater{}
 	d := &example.Delegator{Repeater: r}
@@ -124,3 +231,259 @@ func TestDelegatorReturnsRepeaterResult(t *testing.T) {
 		t.Errorf("wanted %v, but got %v", wantRet1, gotRet1)
 	}
 }
+
+func TestDelegatorCallsMockDoer(t *testing.T) {
+	mockDoer := NewMockDoer(t)
+	mockDoer.ExpectDoIt("laundry", false).Return(42, nil)
+	d := &example.Delegator{Delegate: mockDoer}
+
+	n, err := d.DoSomething("laundry")
+
+	if n != 42 || err != nil {
+		t.Errorf("wanted: %v, %v, but got %v, %v", 42, nil, n, err)
+	}
+}
+
+func TestDelegatorCallsMockDoerInOrder(t *testing.T) {
+	mockDoer := NewMockDoer(t).InOrder()
+	mockDoer.ExpectDoIt("laundry", false).Times(2)
+	mockDoer.ExpectDoIt("dishes", false)
+	d := &example.Delegator{Delegate: mockDoer}
+
+	d.DoSomething("laundry")
+	d.DoSomething("laundry")
+	d.DoSomething("dishes")
+}
+
+func TestDelegatorCallsMockDoerWithAnyTask(t *testing.T) {
+	mockDoer := NewMockDoer(t)
+	mockDoer.ExpectDoIt("", false).AnyArg0().Times(2)
+	mockDoer.ExpectDoIt("", true).MatchArg0(func(task string) bool {
+		return strings.HasPrefix(task, "wash ")
+	})
+	d := &example.Delegator{Delegate: mockDoer}
+
+	d.DoSomething("laundry")
+	d.DoSomething("dishes")
+	mockDoer.DoIt("wash windows", true)
+}
+
+// recordingTB records failures, rather than failing the test, so that
+// mocks which are meant to fail it may be exercised
+type recordingTB struct {
+	testing.TB
+	mu       sync.Mutex
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func TestMockDoerReportsUnexpectedCallFromGoroutine(t *testing.T) {
+	tb := &recordingTB{}
+	mockDoer := NewMockDoer(tb)
+	mockDoer.ExpectDoIt("laundry", false).Return(42, nil)
+
+	done := make(chan int)
+	go func() {
+		n, _ := mockDoer.DoIt("dishes", false)
+		done <- n
+	}()
+	n := <-done
+	for _, cleanup := range tb.cleanups {
+		cleanup()
+	}
+
+	if n != 0 {
+		t.Errorf("wanted zero value, but got %v", n)
+	}
+	want := []string{
+		`unexpected call to DoIt("dishes", false)`,
+		`expected 1 call(s) to DoIt("laundry", false), got 0`,
+	}
+	if !reflect.DeepEqual(want, tb.errors) {
+		t.Errorf("wanted: %v, but got %v", want, tb.errors)
+	}
+}
+
+func TestMockDoerLetsMatcherCallMock(t *testing.T) {
+	tb := &recordingTB{}
+	mockDoer := NewMockDoer(tb)
+	call := mockDoer.ExpectDoIt("", false)
+	// the matcher calls the mock, which it may do while the call is made
+	call.MatchArg0(func(task string) bool {
+		call.Return(len(task), nil)
+		return true
+	})
+
+	result := make(chan int)
+	go func() {
+		n, _ := mockDoer.DoIt("laundry", false)
+		result <- n
+	}()
+
+	select {
+	case n := <-result:
+		if n != len("laundry") {
+			t.Errorf("wanted: %v, but got %v", len("laundry"), n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wanted the matcher to call the mock, but the call deadlocked")
+	}
+	for _, cleanup := range tb.cleanups {
+		cleanup()
+	}
+	if len(tb.errors) > 0 {
+		t.Errorf("wanted no errors, but got %v", tb.errors)
+	}
+}
+
+func TestDelegatorLeavesDummyDoerAlone(t *testing.T) {
+	r := &SpyRepeater{}
+	d := &example.Delegator{Delegate: &DummyDoer{}, Repeater: r}
+
+	d.DoSomethingAgain("laundry", "still not done")
+
+	want := true
+	got := r.Repeat_Called
+
+	if want != got {
+		t.Errorf("wanted %v, but got %v", want, got)
+	}
+}
+
+func TestDelegatorReturnsStubDoerResult(t *testing.T) {
+	stubDoer := &StubDoer{}
+	stubDoer.DoIt_Output.Ret0 = 42
+	d := &example.Delegator{Delegate: stubDoer}
+
+	n, _ := d.DoSomething("laundry")
+
+	want := 42
+	got := n
+
+	if want != got {
+		t.Errorf("wanted %v, but got %v", want, got)
+	}
+}
+
+func TestDelegatorCallsThroughDelegateDoer(t *testing.T) {
+	stubDoer := &StubDoer{}
+	stubDoer.DoIt_Output.Ret0 = 42
+	delegateDoer := &DelegateDoer{Delegate: stubDoer}
+	d := &example.Delegator{Delegate: delegateDoer}
+
+	n, _ := d.DoSomething("laundry")
+
+	if n != 42 {
+		t.Errorf("wanted %v, but got %v", 42, n)
+	}
+
+	wantArg0 := "laundry"
+	gotArg0 := delegateDoer.DoIt_Input.Arg0
+
+	if wantArg0 != gotArg0 {
+		t.Errorf("wanted %v, but got %v", wantArg0, gotArg0)
+	}
+}
+
+func TestDelegatorWithSharedSpyDoer(t *testing.T) {
+	spyDoer := &fakes.SpyDoer{}
+	d := &example.Delegator{Delegate: spyDoer}
+
+	d.DoSomething("laundry")
+
+	want := "laundry"
+	got := spyDoer.DoIt_Input.Arg0
+
+	if want != got {
+		t.Errorf("wanted %v, but got %v", want, got)
+	}
+}
+
+func TestStampUsesClock(t *testing.T) {
+	spyClock := &SpyClock{}
+	spyClock.Clock_Output.Ret0 = time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	got := example.Stamp("laundry", spyClock.Clock)
+
+	want := "2017-01-02T03:04:05Z laundry"
+	if want != got {
+		t.Errorf("wanted: %v, but got %v", want, got)
+	}
+	if spyClock.Clock_CallCount != 1 {
+		t.Errorf("wanted: %v, but got %v", 1, spyClock.Clock_CallCount)
+	}
+}
+
+func TestStampCallsThroughDelegateClock(t *testing.T) {
+	delegateClock := &DelegateClock{Delegate: func() time.Time {
+		return time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	}}
+
+	got := example.Stamp("laundry", delegateClock.Clock)
+
+	want := "2017-01-02T03:04:05Z laundry"
+	if want != got {
+		t.Errorf("wanted: %v, but got %v", want, got)
+	}
+	if delegateClock.Clock_CallCount != 1 {
+		t.Errorf("wanted: %v, but got %v", 1, delegateClock.Clock_CallCount)
+	}
+}
+
+func TestDelegatorDoesThenRepeats(t *testing.T) {
+	spy := &SpyDoerRepeater{}
+	d := &example.Delegator{Delegate: spy, Repeater: spy}
+
+	d.DoSomething("laundry")
+	d.DoSomethingAgain("laundry", "still dirty")
+
+	want := []string{"DoIt", "Repeat"}
+	got := spy.CallLog
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("wanted: %v, but got %v", want, got)
+	}
+}
+
+func TestDelegatorResetSpyBetweenTasks(t *testing.T) {
+	spy := &SpyDoer{}
+	d := &example.Delegator{Delegate: spy}
+
+	d.DoSomething("laundry")
+	spy.Reset()
+	d.DoSomething("dishes")
+
+	want := SpyDoerSnapshot{DoIt_Called: true, DoIt_CallCount: 1, CallLog: []string{"DoIt"}}
+	want.DoIt_Input.Arg0 = "dishes"
+	got := spy.Snapshot()
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("wanted: %v, but got %v", want, got)
+	}
+}
+
+func TestRenameStoresRenamedUser(t *testing.T) {
+	users := &SpyRepoUser{}
+	users.Get_Output.Ret0 = example.User{Name: "ada"}
+
+	example.Rename(users, "1", "grace")
+
+	want := example.User{Name: "grace"}
+	got := users.Put_Input.Arg1
+
+	if want != got {
+		t.Errorf("wanted: %v, but got %v", want, got)
+	}
+}
@@ -0,0 +1,158 @@
+// Spies generated by fm. Do not edit.
+// Regenerate by running fm instead.
+package example_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/enocom/fm/example"
+)
+
+type DelegateClock struct {
+	Delegate        example.Clock
+	mu              sync.Mutex
+	Clock_Called    bool
+	Clock_CallCount int
+}
+
+func (f *DelegateClock) Clock() time.Time {
+	f.mu.Lock()
+	f.Clock_Called = true
+	f.Clock_CallCount++
+	f.mu.Unlock()
+	return f.Delegate()
+}
+
+var _ example.Clock = (*DelegateClock)(nil).Clock
+
+type DelegateDoer struct {
+	Delegate interface {
+		DoIt(task string, graciously bool) (int, error)
+	}
+	mu             sync.Mutex
+	DoIt_Called    bool
+	DoIt_CallCount int
+	DoIt_Input     struct {
+		Arg0 string
+		Arg1 bool
+	}
+}
+
+func (f *DelegateDoer) DoIt(task string, graciously bool) (int, error) {
+	f.mu.Lock()
+	f.DoIt_Called = true
+	f.DoIt_CallCount++
+	f.DoIt_Input.Arg0 = task
+	f.DoIt_Input.Arg1 = graciously
+	f.mu.Unlock()
+	return f.Delegate.DoIt(task, graciously)
+}
+
+var _ example.Doer = (*DelegateDoer)(nil)
+
+type DelegateRepeater struct {
+	Delegate interface {
+		Repeat(task, rationale string) (count int, err error)
+	}
+	mu               sync.Mutex
+	Repeat_Called    bool
+	Repeat_CallCount int
+	Repeat_Input     struct {
+		Arg0 string
+		Arg1 string
+	}
+}
+
+func (f *DelegateRepeater) Repeat(task, rationale string) (count int, err error) {
+	f.mu.Lock()
+	f.Repeat_Called = true
+	f.Repeat_CallCount++
+	f.Repeat_Input.Arg0 = task
+	f.Repeat_Input.Arg1 = rationale
+	f.mu.Unlock()
+	return f.Delegate.Repeat(task, rationale)
+}
+
+var _ example.Repeater = (*DelegateRepeater)(nil)
+
+type DelegateRepoUser struct {
+	Delegate interface {
+		Get(id string) (example.User, error)
+		Put(id string, item example.User) error
+	}
+	mu            sync.Mutex
+	Get_Called    bool
+	Get_CallCount int
+	Get_Input     struct {
+		Arg0 string
+	}
+	Put_Called    bool
+	Put_CallCount int
+	Put_Input     struct {
+		Arg0 string
+		Arg1 example.User
+	}
+}
+
+func (f *DelegateRepoUser) Get(id string) (example.User, error) {
+	f.mu.Lock()
+	f.Get_Called = true
+	f.Get_CallCount++
+	f.Get_Input.Arg0 = id
+	f.mu.Unlock()
+	return f.Delegate.Get(id)
+}
+func (f *DelegateRepoUser) Put(id string, item example.User) error {
+	f.mu.Lock()
+	f.Put_Called = true
+	f.Put_CallCount++
+	f.Put_Input.Arg0 = id
+	f.Put_Input.Arg1 = item
+	f.mu.Unlock()
+	return f.Delegate.Put(id, item)
+}
+
+var _ example.Repo[example.User] = (*DelegateRepoUser)(nil)
+
+type DelegateDoerRepeater struct {
+	Delegate interface {
+		DoIt(task string, graciously bool) (int, error)
+		Repeat(task, rationale string) (count int, err error)
+	}
+	mu             sync.Mutex
+	DoIt_Called    bool
+	DoIt_CallCount int
+	DoIt_Input     struct {
+		Arg0 string
+		Arg1 bool
+	}
+	Repeat_Called    bool
+	Repeat_CallCount int
+	Repeat_Input     struct {
+		Arg0 string
+		Arg1 string
+	}
+}
+
+func (f *DelegateDoerRepeater) DoIt(task string, graciously bool) (int, error) {
+	f.mu.Lock()
+	f.DoIt_Called = true
+	f.DoIt_CallCount++
+	f.DoIt_Input.Arg0 = task
+	f.DoIt_Input.Arg1 = graciously
+	f.mu.Unlock()
+	return f.Delegate.DoIt(task, graciously)
+}
+func (f *DelegateDoerRepeater) Repeat(task, rationale string) (count int, err error) {
+	f.mu.Lock()
+	f.Repeat_Called = true
+	f.Repeat_CallCount++
+	f.Repeat_Input.Arg0 = task
+	f.Repeat_Input.Arg1 = rationale
+	f.mu.Unlock()
+	return f.Delegate.Repeat(task, rationale)
+}
+
+var _ example.Doer = (*DelegateDoerRepeater)(nil)
+var _ example.Repeater = (*DelegateDoerRepeater)(nil)
@@ -0,0 +1,56 @@
+// Spies generated by fm. Do not edit.
+// Regenerate by running fm instead.
+package example_test
+
+import (
+	"time"
+
+	"github.com/enocom/fm/example"
+)
+
+type DummyClock struct{}
+
+func (f *DummyClock) Clock() time.Time {
+	panic("unexpected call to DummyClock.Clock")
+}
+
+var _ example.Clock = (*DummyClock)(nil).Clock
+
+type DummyDoer struct{}
+
+func (f *DummyDoer) DoIt(task string, graciously bool) (int, error) {
+	panic("unexpected call to DummyDoer.DoIt")
+}
+
+var _ example.Doer = (*DummyDoer)(nil)
+
+type DummyRepeater struct{}
+
+func (f *DummyRepeater) Repeat(task, rationale string) (count int, err error) {
+	panic("unexpected call to DummyRepeater.Repeat")
+}
+
+var _ example.Repeater = (*DummyRepeater)(nil)
+
+type DummyRepoUser struct{}
+
+func (f *DummyRepoUser) Get(id string) (example.User, error) {
+	panic("unexpected call to DummyRepoUser.Get")
+}
+func (f *DummyRepoUser) Put(id string, item example.User) error {
+	panic("unexpected call to DummyRepoUser.Put")
+}
+
+var _ example.Repo[example.User] = (*DummyRepoUser)(nil)
+
+type DummyDoerRepeater struct{}
+
+func (f *DummyDoerRepeater) DoIt(task string, graciously bool) (int, error) {
+	panic("unexpected call to DummyDoerRepeater.DoIt")
+}
+func (f *DummyDoerRepeater) Repeat(task, rationale string) (count int, err error) {
+	panic("unexpected call to DummyDoerRepeater.Repeat")
+}
+
+var _ example.Doer = (*DummyDoerRepeater)(nil)
+var _ example.Repeater = (*DummyDoerRepeater)(nil)
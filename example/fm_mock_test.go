@@ -0,0 +1,968 @@
+// Spies generated by fm. Do not edit.
+// Regenerate by running fm instead.
+package example_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/enocom/fm/example"
+)
+
+type MockClock struct {
+	mu             sync.Mutex
+	t              testing.TB
+	ordered        bool
+	seq, last      int
+	clock_expected []*MockClockClockCall
+}
+
+// NewMockClock returns a MockClock which fails t on any unexpected call
+// and checks that all expected calls were made when t finishes
+func NewMockClock(t testing.TB) *MockClock {
+	f := &MockClock{t: t}
+	t.Cleanup(f.verify)
+	return f
+}
+
+// InOrder requires expected calls to be made in the order they were declared
+func (f *MockClock) InOrder() *MockClock {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ordered = true
+	return f
+}
+
+type MockClockClockCall struct {
+	mock              *MockClock
+	seq, times, calls int
+	Output            struct {
+		Ret0 time.Time
+	}
+}
+
+// ExpectClock declares an expected call to Clock with the given arguments.
+// The call is expected once unless set otherwise with Times
+func (f *MockClock) ExpectClock() *MockClockClockCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	call := &MockClockClockCall{mock: f, seq: f.seq, times: 1}
+	f.clock_expected = append(f.clock_expected, call)
+	return call
+}
+
+// Return sets the values returned by the expected call
+func (c *MockClockClockCall) Return(ret0 time.Time) *MockClockClockCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.Output.Ret0 = ret0
+	return c
+}
+
+// Times sets the number of times the call is expected to be made
+func (c *MockClockClockCall) Times(n int) *MockClockClockCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.times = n
+	return c
+}
+
+// Clock returns the values of the first expected call matching its arguments
+func (f *MockClock) Clock() time.Time {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, call := range f.clock_expected {
+		if call.calls >= call.times {
+			continue
+		}
+		if f.ordered && call.seq < f.last {
+			f.t.Errorf("call to Clock() made out of order")
+		}
+		f.last = call.seq
+		call.calls++
+		return call.Output.Ret0
+	}
+	f.t.Errorf("unexpected call to Clock()")
+	return *new(time.Time)
+}
+
+// verify fails the test for every expected call that was not made
+func (f *MockClock) verify() {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, call := range f.clock_expected {
+		if call.calls < call.times {
+			f.t.Errorf("expected %d call(s) to Clock(), got %d", call.times, call.calls)
+		}
+	}
+}
+
+var _ example.Clock = (*MockClock)(nil).Clock
+
+type MockDoer struct {
+	mu            sync.Mutex
+	t             testing.TB
+	ordered       bool
+	seq, last     int
+	doIt_expected []*MockDoerDoItCall
+}
+
+// NewMockDoer returns a MockDoer which fails t on any unexpected call
+// and checks that all expected calls were made when t finishes
+func NewMockDoer(t testing.TB) *MockDoer {
+	f := &MockDoer{t: t}
+	t.Cleanup(f.verify)
+	return f
+}
+
+// InOrder requires expected calls to be made in the order they were declared
+func (f *MockDoer) InOrder() *MockDoer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ordered = true
+	return f
+}
+
+type MockDoerDoItCall struct {
+	mock              *MockDoer
+	seq, times, calls int
+	Input             struct {
+		Arg0 string
+		Arg1 bool
+	}
+	Output struct {
+		Ret0 int
+		Ret1 error
+	}
+	arg0_match func(string) bool
+	arg1_match func(bool) bool
+}
+
+// ExpectDoIt declares an expected call to DoIt with the given arguments.
+// The call is expected once unless set otherwise with Times
+func (f *MockDoer) ExpectDoIt(task string, graciously bool) *MockDoerDoItCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	call := &MockDoerDoItCall{mock: f, seq: f.seq, times: 1}
+	call.Input.Arg0 = task
+	call.Input.Arg1 = graciously
+	f.doIt_expected = append(f.doIt_expected, call)
+	return call
+}
+
+// MatchArg0 matches argument 0 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockDoerDoItCall) MatchArg0(match func(string) bool) *MockDoerDoItCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg0_match = match
+	return c
+}
+
+// AnyArg0 matches the call whatever its argument 0
+func (c *MockDoerDoItCall) AnyArg0() *MockDoerDoItCall {
+	return c.MatchArg0(func(string) bool {
+		return true
+	})
+}
+
+// MatchArg1 matches argument 1 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockDoerDoItCall) MatchArg1(match func(bool) bool) *MockDoerDoItCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg1_match = match
+	return c
+}
+
+// AnyArg1 matches the call whatever its argument 1
+func (c *MockDoerDoItCall) AnyArg1() *MockDoerDoItCall {
+	return c.MatchArg1(func(bool) bool {
+		return true
+	})
+}
+
+// Return sets the values returned by the expected call
+func (c *MockDoerDoItCall) Return(ret0 int, ret1 error) *MockDoerDoItCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.Output.Ret0 = ret0
+	c.Output.Ret1 = ret1
+	return c
+}
+
+// Times sets the number of times the call is expected to be made
+func (c *MockDoerDoItCall) Times(n int) *MockDoerDoItCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.times = n
+	return c
+}
+
+// DoIt returns the values of the first expected call matching its arguments
+func (f *MockDoer) DoIt(task string, graciously bool) (int, error) {
+	f.t.Helper()
+	f.mu.Lock()
+	expected := make([]MockDoerDoItCall, len(f.doIt_expected))
+	for i, call := range f.doIt_expected {
+		expected[i] = *call
+	}
+	f.mu.Unlock()
+	matched := make([]bool, len(expected))
+	for i, call := range expected {
+		if call.arg0_match != nil {
+			if !call.arg0_match(task) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg0, task) {
+			continue
+		}
+		if call.arg1_match != nil {
+			if !call.arg1_match(graciously) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg1, graciously) {
+			continue
+		}
+		matched[i] = true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, call := range f.doIt_expected[:len(matched)] {
+		if !matched[i] || call.calls >= call.times {
+			continue
+		}
+		if f.ordered && call.seq < f.last {
+			f.t.Errorf("call to DoIt(%#v, %#v) made out of order", task, graciously)
+		}
+		f.last = call.seq
+		call.calls++
+		return call.Output.Ret0, call.Output.Ret1
+	}
+	f.t.Errorf("unexpected call to DoIt(%#v, %#v)", task, graciously)
+	return *new(int), *new(error)
+}
+
+// verify fails the test for every expected call that was not made
+func (f *MockDoer) verify() {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, call := range f.doIt_expected {
+		if call.calls < call.times {
+			f.t.Errorf("expected %d call(s) to DoIt(%#v, %#v), got %d", call.times, call.Input.Arg0, call.Input.Arg1, call.calls)
+		}
+	}
+}
+
+var _ example.Doer = (*MockDoer)(nil)
+
+type MockRepeater struct {
+	mu              sync.Mutex
+	t               testing.TB
+	ordered         bool
+	seq, last       int
+	repeat_expected []*MockRepeaterRepeatCall
+}
+
+// NewMockRepeater returns a MockRepeater which fails t on any unexpected call
+// and checks that all expected calls were made when t finishes
+func NewMockRepeater(t testing.TB) *MockRepeater {
+	f := &MockRepeater{t: t}
+	t.Cleanup(f.verify)
+	return f
+}
+
+// InOrder requires expected calls to be made in the order they were declared
+func (f *MockRepeater) InOrder() *MockRepeater {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ordered = true
+	return f
+}
+
+type MockRepeaterRepeatCall struct {
+	mock              *MockRepeater
+	seq, times, calls int
+	Input             struct {
+		Arg0 string
+		Arg1 string
+	}
+	Output struct {
+		Ret0 int
+		Ret1 error
+	}
+	arg0_match func(string) bool
+	arg1_match func(string) bool
+}
+
+// ExpectRepeat declares an expected call to Repeat with the given arguments.
+// The call is expected once unless set otherwise with Times
+func (f *MockRepeater) ExpectRepeat(task, rationale string) *MockRepeaterRepeatCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	call := &MockRepeaterRepeatCall{mock: f, seq: f.seq, times: 1}
+	call.Input.Arg0 = task
+	call.Input.Arg1 = rationale
+	f.repeat_expected = append(f.repeat_expected, call)
+	return call
+}
+
+// MatchArg0 matches argument 0 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockRepeaterRepeatCall) MatchArg0(match func(string) bool) *MockRepeaterRepeatCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg0_match = match
+	return c
+}
+
+// AnyArg0 matches the call whatever its argument 0
+func (c *MockRepeaterRepeatCall) AnyArg0() *MockRepeaterRepeatCall {
+	return c.MatchArg0(func(string) bool {
+		return true
+	})
+}
+
+// MatchArg1 matches argument 1 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockRepeaterRepeatCall) MatchArg1(match func(string) bool) *MockRepeaterRepeatCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg1_match = match
+	return c
+}
+
+// AnyArg1 matches the call whatever its argument 1
+func (c *MockRepeaterRepeatCall) AnyArg1() *MockRepeaterRepeatCall {
+	return c.MatchArg1(func(string) bool {
+		return true
+	})
+}
+
+// Return sets the values returned by the expected call
+func (c *MockRepeaterRepeatCall) Return(ret0 int, ret1 error) *MockRepeaterRepeatCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.Output.Ret0 = ret0
+	c.Output.Ret1 = ret1
+	return c
+}
+
+// Times sets the number of times the call is expected to be made
+func (c *MockRepeaterRepeatCall) Times(n int) *MockRepeaterRepeatCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.times = n
+	return c
+}
+
+// Repeat returns the values of the first expected call matching its arguments
+func (f *MockRepeater) Repeat(task, rationale string) (count int, err error) {
+	f.t.Helper()
+	f.mu.Lock()
+	expected := make([]MockRepeaterRepeatCall, len(f.repeat_expected))
+	for i, call := range f.repeat_expected {
+		expected[i] = *call
+	}
+	f.mu.Unlock()
+	matched := make([]bool, len(expected))
+	for i, call := range expected {
+		if call.arg0_match != nil {
+			if !call.arg0_match(task) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg0, task) {
+			continue
+		}
+		if call.arg1_match != nil {
+			if !call.arg1_match(rationale) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg1, rationale) {
+			continue
+		}
+		matched[i] = true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, call := range f.repeat_expected[:len(matched)] {
+		if !matched[i] || call.calls >= call.times {
+			continue
+		}
+		if f.ordered && call.seq < f.last {
+			f.t.Errorf("call to Repeat(%#v, %#v) made out of order", task, rationale)
+		}
+		f.last = call.seq
+		call.calls++
+		return call.Output.Ret0, call.Output.Ret1
+	}
+	f.t.Errorf("unexpected call to Repeat(%#v, %#v)", task, rationale)
+	return *new(int), *new(error)
+}
+
+// verify fails the test for every expected call that was not made
+func (f *MockRepeater) verify() {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, call := range f.repeat_expected {
+		if call.calls < call.times {
+			f.t.Errorf("expected %d call(s) to Repeat(%#v, %#v), got %d", call.times, call.Input.Arg0, call.Input.Arg1, call.calls)
+		}
+	}
+}
+
+var _ example.Repeater = (*MockRepeater)(nil)
+
+type MockRepoUser struct {
+	mu           sync.Mutex
+	t            testing.TB
+	ordered      bool
+	seq, last    int
+	get_expected []*MockRepoUserGetCall
+	put_expected []*MockRepoUserPutCall
+}
+
+// NewMockRepoUser returns a MockRepoUser which fails t on any unexpected call
+// and checks that all expected calls were made when t finishes
+func NewMockRepoUser(t testing.TB) *MockRepoUser {
+	f := &MockRepoUser{t: t}
+	t.Cleanup(f.verify)
+	return f
+}
+
+// InOrder requires expected calls to be made in the order they were declared
+func (f *MockRepoUser) InOrder() *MockRepoUser {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ordered = true
+	return f
+}
+
+type MockRepoUserGetCall struct {
+	mock              *MockRepoUser
+	seq, times, calls int
+	Input             struct {
+		Arg0 string
+	}
+	Output struct {
+		Ret0 example.User
+		Ret1 error
+	}
+	arg0_match func(string) bool
+}
+
+// ExpectGet declares an expected call to Get with the given arguments.
+// The call is expected once unless set otherwise with Times
+func (f *MockRepoUser) ExpectGet(id string) *MockRepoUserGetCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	call := &MockRepoUserGetCall{mock: f, seq: f.seq, times: 1}
+	call.Input.Arg0 = id
+	f.get_expected = append(f.get_expected, call)
+	return call
+}
+
+// MatchArg0 matches argument 0 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockRepoUserGetCall) MatchArg0(match func(string) bool) *MockRepoUserGetCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg0_match = match
+	return c
+}
+
+// AnyArg0 matches the call whatever its argument 0
+func (c *MockRepoUserGetCall) AnyArg0() *MockRepoUserGetCall {
+	return c.MatchArg0(func(string) bool {
+		return true
+	})
+}
+
+// Return sets the values returned by the expected call
+func (c *MockRepoUserGetCall) Return(ret0 example.User, ret1 error) *MockRepoUserGetCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.Output.Ret0 = ret0
+	c.Output.Ret1 = ret1
+	return c
+}
+
+// Times sets the number of times the call is expected to be made
+func (c *MockRepoUserGetCall) Times(n int) *MockRepoUserGetCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.times = n
+	return c
+}
+
+// Get returns the values of the first expected call matching its arguments
+func (f *MockRepoUser) Get(id string) (example.User, error) {
+	f.t.Helper()
+	f.mu.Lock()
+	expected := make([]MockRepoUserGetCall, len(f.get_expected))
+	for i, call := range f.get_expected {
+		expected[i] = *call
+	}
+	f.mu.Unlock()
+	matched := make([]bool, len(expected))
+	for i, call := range expected {
+		if call.arg0_match != nil {
+			if !call.arg0_match(id) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg0, id) {
+			continue
+		}
+		matched[i] = true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, call := range f.get_expected[:len(matched)] {
+		if !matched[i] || call.calls >= call.times {
+			continue
+		}
+		if f.ordered && call.seq < f.last {
+			f.t.Errorf("call to Get(%#v) made out of order", id)
+		}
+		f.last = call.seq
+		call.calls++
+		return call.Output.Ret0, call.Output.Ret1
+	}
+	f.t.Errorf("unexpected call to Get(%#v)", id)
+	return *new(example.User), *new(error)
+}
+
+type MockRepoUserPutCall struct {
+	mock              *MockRepoUser
+	seq, times, calls int
+	Input             struct {
+		Arg0 string
+		Arg1 example.User
+	}
+	Output struct {
+		Ret0 error
+	}
+	arg0_match func(string) bool
+	arg1_match func(example.User) bool
+}
+
+// ExpectPut declares an expected call to Put with the given arguments.
+// The call is expected once unless set otherwise with Times
+func (f *MockRepoUser) ExpectPut(id string, item example.User) *MockRepoUserPutCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	call := &MockRepoUserPutCall{mock: f, seq: f.seq, times: 1}
+	call.Input.Arg0 = id
+	call.Input.Arg1 = item
+	f.put_expected = append(f.put_expected, call)
+	return call
+}
+
+// MatchArg0 matches argument 0 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockRepoUserPutCall) MatchArg0(match func(string) bool) *MockRepoUserPutCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg0_match = match
+	return c
+}
+
+// AnyArg0 matches the call whatever its argument 0
+func (c *MockRepoUserPutCall) AnyArg0() *MockRepoUserPutCall {
+	return c.MatchArg0(func(string) bool {
+		return true
+	})
+}
+
+// MatchArg1 matches argument 1 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockRepoUserPutCall) MatchArg1(match func(example.User) bool) *MockRepoUserPutCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg1_match = match
+	return c
+}
+
+// AnyArg1 matches the call whatever its argument 1
+func (c *MockRepoUserPutCall) AnyArg1() *MockRepoUserPutCall {
+	return c.MatchArg1(func(example.User) bool {
+		return true
+	})
+}
+
+// Return sets the values returned by the expected call
+func (c *MockRepoUserPutCall) Return(ret0 error) *MockRepoUserPutCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.Output.Ret0 = ret0
+	return c
+}
+
+// Times sets the number of times the call is expected to be made
+func (c *MockRepoUserPutCall) Times(n int) *MockRepoUserPutCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.times = n
+	return c
+}
+
+// Put returns the values of the first expected call matching its arguments
+func (f *MockRepoUser) Put(id string, item example.User) error {
+	f.t.Helper()
+	f.mu.Lock()
+	expected := make([]MockRepoUserPutCall, len(f.put_expected))
+	for i, call := range f.put_expected {
+		expected[i] = *call
+	}
+	f.mu.Unlock()
+	matched := make([]bool, len(expected))
+	for i, call := range expected {
+		if call.arg0_match != nil {
+			if !call.arg0_match(id) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg0, id) {
+			continue
+		}
+		if call.arg1_match != nil {
+			if !call.arg1_match(item) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg1, item) {
+			continue
+		}
+		matched[i] = true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, call := range f.put_expected[:len(matched)] {
+		if !matched[i] || call.calls >= call.times {
+			continue
+		}
+		if f.ordered && call.seq < f.last {
+			f.t.Errorf("call to Put(%#v, %#v) made out of order", id, item)
+		}
+		f.last = call.seq
+		call.calls++
+		return call.Output.Ret0
+	}
+	f.t.Errorf("unexpected call to Put(%#v, %#v)", id, item)
+	return *new(error)
+}
+
+// verify fails the test for every expected call that was not made
+func (f *MockRepoUser) verify() {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, call := range f.get_expected {
+		if call.calls < call.times {
+			f.t.Errorf("expected %d call(s) to Get(%#v), got %d", call.times, call.Input.Arg0, call.calls)
+		}
+	}
+	for _, call := range f.put_expected {
+		if call.calls < call.times {
+			f.t.Errorf("expected %d call(s) to Put(%#v, %#v), got %d", call.times, call.Input.Arg0, call.Input.Arg1, call.calls)
+		}
+	}
+}
+
+var _ example.Repo[example.User] = (*MockRepoUser)(nil)
+
+type MockDoerRepeater struct {
+	mu              sync.Mutex
+	t               testing.TB
+	ordered         bool
+	seq, last       int
+	doIt_expected   []*MockDoerRepeaterDoItCall
+	repeat_expected []*MockDoerRepeaterRepeatCall
+}
+
+// NewMockDoerRepeater returns a MockDoerRepeater which fails t on any unexpected call
+// and checks that all expected calls were made when t finishes
+func NewMockDoerRepeater(t testing.TB) *MockDoerRepeater {
+	f := &MockDoerRepeater{t: t}
+	t.Cleanup(f.verify)
+	return f
+}
+
+// InOrder requires expected calls to be made in the order they were declared
+func (f *MockDoerRepeater) InOrder() *MockDoerRepeater {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ordered = true
+	return f
+}
+
+type MockDoerRepeaterDoItCall struct {
+	mock              *MockDoerRepeater
+	seq, times, calls int
+	Input             struct {
+		Arg0 string
+		Arg1 bool
+	}
+	Output struct {
+		Ret0 int
+		Ret1 error
+	}
+	arg0_match func(string) bool
+	arg1_match func(bool) bool
+}
+
+// ExpectDoIt declares an expected call to DoIt with the given arguments.
+// The call is expected once unless set otherwise with Times
+func (f *MockDoerRepeater) ExpectDoIt(task string, graciously bool) *MockDoerRepeaterDoItCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	call := &MockDoerRepeaterDoItCall{mock: f, seq: f.seq, times: 1}
+	call.Input.Arg0 = task
+	call.Input.Arg1 = graciously
+	f.doIt_expected = append(f.doIt_expected, call)
+	return call
+}
+
+// MatchArg0 matches argument 0 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockDoerRepeaterDoItCall) MatchArg0(match func(string) bool) *MockDoerRepeaterDoItCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg0_match = match
+	return c
+}
+
+// AnyArg0 matches the call whatever its argument 0
+func (c *MockDoerRepeaterDoItCall) AnyArg0() *MockDoerRepeaterDoItCall {
+	return c.MatchArg0(func(string) bool {
+		return true
+	})
+}
+
+// MatchArg1 matches argument 1 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockDoerRepeaterDoItCall) MatchArg1(match func(bool) bool) *MockDoerRepeaterDoItCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg1_match = match
+	return c
+}
+
+// AnyArg1 matches the call whatever its argument 1
+func (c *MockDoerRepeaterDoItCall) AnyArg1() *MockDoerRepeaterDoItCall {
+	return c.MatchArg1(func(bool) bool {
+		return true
+	})
+}
+
+// Return sets the values returned by the expected call
+func (c *MockDoerRepeaterDoItCall) Return(ret0 int, ret1 error) *MockDoerRepeaterDoItCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.Output.Ret0 = ret0
+	c.Output.Ret1 = ret1
+	return c
+}
+
+// Times sets the number of times the call is expected to be made
+func (c *MockDoerRepeaterDoItCall) Times(n int) *MockDoerRepeaterDoItCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.times = n
+	return c
+}
+
+// DoIt returns the values of the first expected call matching its arguments
+func (f *MockDoerRepeater) DoIt(task string, graciously bool) (int, error) {
+	f.t.Helper()
+	f.mu.Lock()
+	expected := make([]MockDoerRepeaterDoItCall, len(f.doIt_expected))
+	for i, call := range f.doIt_expected {
+		expected[i] = *call
+	}
+	f.mu.Unlock()
+	matched := make([]bool, len(expected))
+	for i, call := range expected {
+		if call.arg0_match != nil {
+			if !call.arg0_match(task) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg0, task) {
+			continue
+		}
+		if call.arg1_match != nil {
+			if !call.arg1_match(graciously) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg1, graciously) {
+			continue
+		}
+		matched[i] = true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, call := range f.doIt_expected[:len(matched)] {
+		if !matched[i] || call.calls >= call.times {
+			continue
+		}
+		if f.ordered && call.seq < f.last {
+			f.t.Errorf("call to DoIt(%#v, %#v) made out of order", task, graciously)
+		}
+		f.last = call.seq
+		call.calls++
+		return call.Output.Ret0, call.Output.Ret1
+	}
+	f.t.Errorf("unexpected call to DoIt(%#v, %#v)", task, graciously)
+	return *new(int), *new(error)
+}
+
+type MockDoerRepeaterRepeatCall struct {
+	mock              *MockDoerRepeater
+	seq, times, calls int
+	Input             struct {
+		Arg0 string
+		Arg1 string
+	}
+	Output struct {
+		Ret0 int
+		Ret1 error
+	}
+	arg0_match func(string) bool
+	arg1_match func(string) bool
+}
+
+// ExpectRepeat declares an expected call to Repeat with the given arguments.
+// The call is expected once unless set otherwise with Times
+func (f *MockDoerRepeater) ExpectRepeat(task, rationale string) *MockDoerRepeaterRepeatCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	call := &MockDoerRepeaterRepeatCall{mock: f, seq: f.seq, times: 1}
+	call.Input.Arg0 = task
+	call.Input.Arg1 = rationale
+	f.repeat_expected = append(f.repeat_expected, call)
+	return call
+}
+
+// MatchArg0 matches argument 0 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockDoerRepeaterRepeatCall) MatchArg0(match func(string) bool) *MockDoerRepeaterRepeatCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg0_match = match
+	return c
+}
+
+// AnyArg0 matches the call whatever its argument 0
+func (c *MockDoerRepeaterRepeatCall) AnyArg0() *MockDoerRepeaterRepeatCall {
+	return c.MatchArg0(func(string) bool {
+		return true
+	})
+}
+
+// MatchArg1 matches argument 1 of the call with match in place of the
+// expected value, e.g., for a value which the code under test builds itself
+func (c *MockDoerRepeaterRepeatCall) MatchArg1(match func(string) bool) *MockDoerRepeaterRepeatCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.arg1_match = match
+	return c
+}
+
+// AnyArg1 matches the call whatever its argument 1
+func (c *MockDoerRepeaterRepeatCall) AnyArg1() *MockDoerRepeaterRepeatCall {
+	return c.MatchArg1(func(string) bool {
+		return true
+	})
+}
+
+// Return sets the values returned by the expected call
+func (c *MockDoerRepeaterRepeatCall) Return(ret0 int, ret1 error) *MockDoerRepeaterRepeatCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.Output.Ret0 = ret0
+	c.Output.Ret1 = ret1
+	return c
+}
+
+// Times sets the number of times the call is expected to be made
+func (c *MockDoerRepeaterRepeatCall) Times(n int) *MockDoerRepeaterRepeatCall {
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+	c.times = n
+	return c
+}
+
+// Repeat returns the values of the first expected call matching its arguments
+func (f *MockDoerRepeater) Repeat(task, rationale string) (count int, err error) {
+	f.t.Helper()
+	f.mu.Lock()
+	expected := make([]MockDoerRepeaterRepeatCall, len(f.repeat_expected))
+	for i, call := range f.repeat_expected {
+		expected[i] = *call
+	}
+	f.mu.Unlock()
+	matched := make([]bool, len(expected))
+	for i, call := range expected {
+		if call.arg0_match != nil {
+			if !call.arg0_match(task) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg0, task) {
+			continue
+		}
+		if call.arg1_match != nil {
+			if !call.arg1_match(rationale) {
+				continue
+			}
+		} else if !reflect.DeepEqual(call.Input.Arg1, rationale) {
+			continue
+		}
+		matched[i] = true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, call := range f.repeat_expected[:len(matched)] {
+		if !matched[i] || call.calls >= call.times {
+			continue
+		}
+		if f.ordered && call.seq < f.last {
+			f.t.Errorf("call to Repeat(%#v, %#v) made out of order", task, rationale)
+		}
+		f.last = call.seq
+		call.calls++
+		return call.Output.Ret0, call.Output.Ret1
+	}
+	f.t.Errorf("unexpected call to Repeat(%#v, %#v)", task, rationale)
+	return *new(int), *new(error)
+}
+
+// verify fails the test for every expected call that was not made
+func (f *MockDoerRepeater) verify() {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, call := range f.doIt_expected {
+		if call.calls < call.times {
+			f.t.Errorf("expected %d call(s) to DoIt(%#v, %#v), got %d", call.times, call.Input.Arg0, call.Input.Arg1, call.calls)
+		}
+	}
+	for _, call := range f.repeat_expected {
+		if call.calls < call.times {
+			f.t.Errorf("expected %d call(s) to Repeat(%#v, %#v), got %d", call.times, call.Input.Arg0, call.Input.Arg1, call.calls)
+		}
+	}
+}
+
+var _ example.Doer = (*MockDoerRepeater)(nil)
+var _ example.Repeater = (*MockDoerRepeater)(nil)
@@ -0,0 +1,87 @@
+// Spies generated by fm. Do not edit.
+// Regenerate by running fm instead.
+package example_test
+
+import (
+	"time"
+
+	"github.com/enocom/fm/example"
+)
+
+type StubClock struct {
+	Clock_Output struct {
+		Ret0 time.Time
+	}
+}
+
+func (f *StubClock) Clock() time.Time {
+	return f.Clock_Output.Ret0
+}
+
+var _ example.Clock = (*StubClock)(nil).Clock
+
+type StubDoer struct {
+	DoIt_Output struct {
+		Ret0 int
+		Ret1 error
+	}
+}
+
+func (f *StubDoer) DoIt(task string, graciously bool) (int, error) {
+	return f.DoIt_Output.Ret0, f.DoIt_Output.Ret1
+}
+
+var _ example.Doer = (*StubDoer)(nil)
+
+type StubRepeater struct {
+	Repeat_Output struct {
+		Ret0 int
+		Ret1 error
+	}
+}
+
+func (f *StubRepeater) Repeat(task, rationale string) (count int, err error) {
+	return f.Repeat_Output.Ret0, f.Repeat_Output.Ret1
+}
+
+var _ example.Repeater = (*StubRepeater)(nil)
+
+type StubRepoUser struct {
+	Get_Output struct {
+		Ret0 example.User
+		Ret1 error
+	}
+	Put_Output struct {
+		Ret0 error
+	}
+}
+
+func (f *StubRepoUser) Get(id string) (example.User, error) {
+	return f.Get_Output.Ret0, f.Get_Output.Ret1
+}
+func (f *StubRepoUser) Put(id string, item example.User) error {
+	return f.Put_Output.Ret0
+}
+
+var _ example.Repo[example.User] = (*StubRepoUser)(nil)
+
+type StubDoerRepeater struct {
+	DoIt_Output struct {
+		Ret0 int
+		Ret1 error
+	}
+	Repeat_Output struct {
+		Ret0 int
+		Ret1 error
+	}
+}
+
+func (f *StubDoerRepeater) DoIt(task string, graciously bool) (int, error) {
+	return f.DoIt_Output.Ret0, f.DoIt_Output.Ret1
+}
+func (f *StubDoerRepeater) Repeat(task, rationale string) (count int, err error) {
+	return f.Repeat_Output.Ret0, f.Repeat_Output.Ret1
+}
+
+var _ example.Doer = (*StubDoerRepeater)(nil)
+var _ example.Repeater = (*StubDoerRepeater)(nil)
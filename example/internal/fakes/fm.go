@@ -0,0 +1,874 @@
+// Spies generated by fm. Do not edit.
+// Regenerate by running fm instead.
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/enocom/fm/example"
+)
+
+type SpyClock struct {
+	mu              sync.Mutex
+	called          chan struct{}
+	Clock_Called    bool
+	Clock_CallCount int
+	Clock_Output    struct {
+		Ret0 time.Time
+	}
+	clock_gate  chan struct{}
+	clock_rules []func() (bool, time.Time)
+	CallLog     []string
+}
+
+func (f *SpyClock) Clock() time.Time {
+	f.mu.Lock()
+	f.Clock_Called = true
+	f.Clock_CallCount++
+	f.CallLog = append(f.CallLog, "Clock")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	gate := f.clock_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.clock_rules, f.Clock_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0 := rule(); ok {
+			return ret0
+		}
+	}
+	return output.Ret0
+}
+
+// WaitForClock blocks until Clock has been called at least n times
+func (f *SpyClock) WaitForClock(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Clock_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockClock causes calls to Clock to block until ReleaseClock is called
+func (f *SpyClock) BlockClock() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.clock_gate == nil {
+		f.clock_gate = make(chan struct{})
+	}
+}
+
+// ReleaseClock lets all calls to Clock blocked by BlockClock proceed
+func (f *SpyClock) ReleaseClock() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.clock_gate != nil {
+		close(f.clock_gate)
+		f.clock_gate = nil
+	}
+}
+
+// ClockReturnsWhen makes Clock return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Clock_Output
+func (f *SpyClock) ClockReturnsWhen(match func() bool, ret0 time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.clock_rules = append(f.clock_rules, func() (bool, time.Time) {
+		return match(), ret0
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyClock) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyClock
+	f.Clock_Called = zero.Clock_Called
+	f.Clock_CallCount = zero.Clock_CallCount
+	f.Clock_Output = zero.Clock_Output
+	f.clock_rules = zero.clock_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyClockSnapshot holds a copy of the calls recorded by SpyClock
+type SpyClockSnapshot struct {
+	Clock_Called    bool
+	Clock_CallCount int
+	CallLog         []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyClock) Snapshot() SpyClockSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyClockSnapshot
+	snapshot.Clock_Called = f.Clock_Called
+	snapshot.Clock_CallCount = f.Clock_CallCount
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ example.Clock = (*SpyClock)(nil).Clock
+
+type SpyDoer struct {
+	mu             sync.Mutex
+	called         chan struct{}
+	DoIt_Called    bool
+	DoIt_CallCount int
+	DoIt_Input     struct {
+		Arg0 string
+		Arg1 bool
+	}
+	DoIt_Output struct {
+		Ret0 int
+		Ret1 error
+	}
+	doIt_gate  chan struct{}
+	doIt_rules []func(task string, graciously bool) (bool, int, error)
+	CallLog    []string
+}
+
+func (f *SpyDoer) DoIt(task string, graciously bool) (int, error) {
+	f.mu.Lock()
+	f.DoIt_Called = true
+	f.DoIt_CallCount++
+	f.CallLog = append(f.CallLog, "DoIt")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.DoIt_Input.Arg0 = task
+	f.DoIt_Input.Arg1 = graciously
+	gate := f.doIt_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.doIt_rules, f.DoIt_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0, ret1 := rule(task, graciously); ok {
+			return ret0, ret1
+		}
+	}
+	return output.Ret0, output.Ret1
+}
+
+// WaitForDoIt blocks until DoIt has been called at least n times
+func (f *SpyDoer) WaitForDoIt(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.DoIt_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockDoIt causes calls to DoIt to block until ReleaseDoIt is called
+func (f *SpyDoer) BlockDoIt() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.doIt_gate == nil {
+		f.doIt_gate = make(chan struct{})
+	}
+}
+
+// ReleaseDoIt lets all calls to DoIt blocked by BlockDoIt proceed
+func (f *SpyDoer) ReleaseDoIt() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.doIt_gate != nil {
+		close(f.doIt_gate)
+		f.doIt_gate = nil
+	}
+}
+
+// DoItReturnsWhen makes DoIt return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to DoIt_Output
+func (f *SpyDoer) DoItReturnsWhen(match func(task string, graciously bool) bool, ret0 int, ret1 error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.doIt_rules = append(f.doIt_rules, func(task string, graciously bool) (bool, int, error) {
+		return match(task, graciously), ret0, ret1
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyDoer) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyDoer
+	f.DoIt_Called = zero.DoIt_Called
+	f.DoIt_CallCount = zero.DoIt_CallCount
+	f.DoIt_Input = zero.DoIt_Input
+	f.DoIt_Output = zero.DoIt_Output
+	f.doIt_rules = zero.doIt_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyDoerSnapshot holds a copy of the calls recorded by SpyDoer
+type SpyDoerSnapshot struct {
+	DoIt_Called    bool
+	DoIt_CallCount int
+	DoIt_Input     struct {
+		Arg0 string
+		Arg1 bool
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyDoer) Snapshot() SpyDoerSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyDoerSnapshot
+	snapshot.DoIt_Called = f.DoIt_Called
+	snapshot.DoIt_CallCount = f.DoIt_CallCount
+	snapshot.DoIt_Input = f.DoIt_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ example.Doer = (*SpyDoer)(nil)
+
+type SpyRepeater struct {
+	mu               sync.Mutex
+	called           chan struct{}
+	Repeat_Called    bool
+	Repeat_CallCount int
+	Repeat_Input     struct {
+		Arg0 string
+		Arg1 string
+	}
+	Repeat_Output struct {
+		Ret0 int
+		Ret1 error
+	}
+	repeat_gate  chan struct{}
+	repeat_rules []func(task, rationale string) (bool, int, error)
+	CallLog      []string
+}
+
+func (f *SpyRepeater) Repeat(task, rationale string) (count int, err error) {
+	f.mu.Lock()
+	f.Repeat_Called = true
+	f.Repeat_CallCount++
+	f.CallLog = append(f.CallLog, "Repeat")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.Repeat_Input.Arg0 = task
+	f.Repeat_Input.Arg1 = rationale
+	gate := f.repeat_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.repeat_rules, f.Repeat_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0, ret1 := rule(task, rationale); ok {
+			return ret0, ret1
+		}
+	}
+	return output.Ret0, output.Ret1
+}
+
+// WaitForRepeat blocks until Repeat has been called at least n times
+func (f *SpyRepeater) WaitForRepeat(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Repeat_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockRepeat causes calls to Repeat to block until ReleaseRepeat is called
+func (f *SpyRepeater) BlockRepeat() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.repeat_gate == nil {
+		f.repeat_gate = make(chan struct{})
+	}
+}
+
+// ReleaseRepeat lets all calls to Repeat blocked by BlockRepeat proceed
+func (f *SpyRepeater) ReleaseRepeat() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.repeat_gate != nil {
+		close(f.repeat_gate)
+		f.repeat_gate = nil
+	}
+}
+
+// RepeatReturnsWhen makes Repeat return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Repeat_Output
+func (f *SpyRepeater) RepeatReturnsWhen(match func(task, rationale string) bool, ret0 int, ret1 error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.repeat_rules = append(f.repeat_rules, func(task, rationale string) (bool, int, error) {
+		return match(task, rationale), ret0, ret1
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyRepeater) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyRepeater
+	f.Repeat_Called = zero.Repeat_Called
+	f.Repeat_CallCount = zero.Repeat_CallCount
+	f.Repeat_Input = zero.Repeat_Input
+	f.Repeat_Output = zero.Repeat_Output
+	f.repeat_rules = zero.repeat_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyRepeaterSnapshot holds a copy of the calls recorded by SpyRepeater
+type SpyRepeaterSnapshot struct {
+	Repeat_Called    bool
+	Repeat_CallCount int
+	Repeat_Input     struct {
+		Arg0 string
+		Arg1 string
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyRepeater) Snapshot() SpyRepeaterSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyRepeaterSnapshot
+	snapshot.Repeat_Called = f.Repeat_Called
+	snapshot.Repeat_CallCount = f.Repeat_CallCount
+	snapshot.Repeat_Input = f.Repeat_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ example.Repeater = (*SpyRepeater)(nil)
+
+type SpyRepoUser struct {
+	mu            sync.Mutex
+	called        chan struct{}
+	Get_Called    bool
+	Get_CallCount int
+	Get_Input     struct {
+		Arg0 string
+	}
+	Get_Output struct {
+		Ret0 example.User
+		Ret1 error
+	}
+	get_gate      chan struct{}
+	get_rules     []func(id string) (bool, example.User, error)
+	Put_Called    bool
+	Put_CallCount int
+	Put_Input     struct {
+		Arg0 string
+		Arg1 example.User
+	}
+	Put_Output struct {
+		Ret0 error
+	}
+	put_gate  chan struct{}
+	put_rules []func(id string, item example.User) (bool, error)
+	CallLog   []string
+}
+
+func (f *SpyRepoUser) Get(id string) (example.User, error) {
+	f.mu.Lock()
+	f.Get_Called = true
+	f.Get_CallCount++
+	f.CallLog = append(f.CallLog, "Get")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.Get_Input.Arg0 = id
+	gate := f.get_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.get_rules, f.Get_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0, ret1 := rule(id); ok {
+			return ret0, ret1
+		}
+	}
+	return output.Ret0, output.Ret1
+}
+
+// WaitForGet blocks until Get has been called at least n times
+func (f *SpyRepoUser) WaitForGet(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Get_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockGet causes calls to Get to block until ReleaseGet is called
+func (f *SpyRepoUser) BlockGet() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.get_gate == nil {
+		f.get_gate = make(chan struct{})
+	}
+}
+
+// ReleaseGet lets all calls to Get blocked by BlockGet proceed
+func (f *SpyRepoUser) ReleaseGet() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.get_gate != nil {
+		close(f.get_gate)
+		f.get_gate = nil
+	}
+}
+
+// GetReturnsWhen makes Get return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Get_Output
+func (f *SpyRepoUser) GetReturnsWhen(match func(id string) bool, ret0 example.User, ret1 error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.get_rules = append(f.get_rules, func(id string) (bool, example.User, error) {
+		return match(id), ret0, ret1
+	})
+}
+func (f *SpyRepoUser) Put(id string, item example.User) error {
+	f.mu.Lock()
+	f.Put_Called = true
+	f.Put_CallCount++
+	f.CallLog = append(f.CallLog, "Put")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.Put_Input.Arg0 = id
+	f.Put_Input.Arg1 = item
+	gate := f.put_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.put_rules, f.Put_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0 := rule(id, item); ok {
+			return ret0
+		}
+	}
+	return output.Ret0
+}
+
+// WaitForPut blocks until Put has been called at least n times
+func (f *SpyRepoUser) WaitForPut(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Put_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockPut causes calls to Put to block until ReleasePut is called
+func (f *SpyRepoUser) BlockPut() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.put_gate == nil {
+		f.put_gate = make(chan struct{})
+	}
+}
+
+// ReleasePut lets all calls to Put blocked by BlockPut proceed
+func (f *SpyRepoUser) ReleasePut() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.put_gate != nil {
+		close(f.put_gate)
+		f.put_gate = nil
+	}
+}
+
+// PutReturnsWhen makes Put return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Put_Output
+func (f *SpyRepoUser) PutReturnsWhen(match func(id string, item example.User) bool, ret0 error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.put_rules = append(f.put_rules, func(id string, item example.User) (bool, error) {
+		return match(id, item), ret0
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyRepoUser) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyRepoUser
+	f.Get_Called = zero.Get_Called
+	f.Get_CallCount = zero.Get_CallCount
+	f.Get_Input = zero.Get_Input
+	f.Get_Output = zero.Get_Output
+	f.get_rules = zero.get_rules
+	f.Put_Called = zero.Put_Called
+	f.Put_CallCount = zero.Put_CallCount
+	f.Put_Input = zero.Put_Input
+	f.Put_Output = zero.Put_Output
+	f.put_rules = zero.put_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyRepoUserSnapshot holds a copy of the calls recorded by SpyRepoUser
+type SpyRepoUserSnapshot struct {
+	Get_Called    bool
+	Get_CallCount int
+	Get_Input     struct {
+		Arg0 string
+	}
+	Put_Called    bool
+	Put_CallCount int
+	Put_Input     struct {
+		Arg0 string
+		Arg1 example.User
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyRepoUser) Snapshot() SpyRepoUserSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyRepoUserSnapshot
+	snapshot.Get_Called = f.Get_Called
+	snapshot.Get_CallCount = f.Get_CallCount
+	snapshot.Get_Input = f.Get_Input
+	snapshot.Put_Called = f.Put_Called
+	snapshot.Put_CallCount = f.Put_CallCount
+	snapshot.Put_Input = f.Put_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ example.Repo[example.User] = (*SpyRepoUser)(nil)
+
+type SpyDoerRepeater struct {
+	mu             sync.Mutex
+	called         chan struct{}
+	DoIt_Called    bool
+	DoIt_CallCount int
+	DoIt_Input     struct {
+		Arg0 string
+		Arg1 bool
+	}
+	DoIt_Output struct {
+		Ret0 int
+		Ret1 error
+	}
+	doIt_gate        chan struct{}
+	doIt_rules       []func(task string, graciously bool) (bool, int, error)
+	Repeat_Called    bool
+	Repeat_CallCount int
+	Repeat_Input     struct {
+		Arg0 string
+		Arg1 string
+	}
+	Repeat_Output struct {
+		Ret0 int
+		Ret1 error
+	}
+	repeat_gate  chan struct{}
+	repeat_rules []func(task, rationale string) (bool, int, error)
+	CallLog      []string
+}
+
+func (f *SpyDoerRepeater) DoIt(task string, graciously bool) (int, error) {
+	f.mu.Lock()
+	f.DoIt_Called = true
+	f.DoIt_CallCount++
+	f.CallLog = append(f.CallLog, "DoIt")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.DoIt_Input.Arg0 = task
+	f.DoIt_Input.Arg1 = graciously
+	gate := f.doIt_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.doIt_rules, f.DoIt_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0, ret1 := rule(task, graciously); ok {
+			return ret0, ret1
+		}
+	}
+	return output.Ret0, output.Ret1
+}
+
+// WaitForDoIt blocks until DoIt has been called at least n times
+func (f *SpyDoerRepeater) WaitForDoIt(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.DoIt_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockDoIt causes calls to DoIt to block until ReleaseDoIt is called
+func (f *SpyDoerRepeater) BlockDoIt() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.doIt_gate == nil {
+		f.doIt_gate = make(chan struct{})
+	}
+}
+
+// ReleaseDoIt lets all calls to DoIt blocked by BlockDoIt proceed
+func (f *SpyDoerRepeater) ReleaseDoIt() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.doIt_gate != nil {
+		close(f.doIt_gate)
+		f.doIt_gate = nil
+	}
+}
+
+// DoItReturnsWhen makes DoIt return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to DoIt_Output
+func (f *SpyDoerRepeater) DoItReturnsWhen(match func(task string, graciously bool) bool, ret0 int, ret1 error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.doIt_rules = append(f.doIt_rules, func(task string, graciously bool) (bool, int, error) {
+		return match(task, graciously), ret0, ret1
+	})
+}
+func (f *SpyDoerRepeater) Repeat(task, rationale string) (count int, err error) {
+	f.mu.Lock()
+	f.Repeat_Called = true
+	f.Repeat_CallCount++
+	f.CallLog = append(f.CallLog, "Repeat")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.Repeat_Input.Arg0 = task
+	f.Repeat_Input.Arg1 = rationale
+	gate := f.repeat_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.repeat_rules, f.Repeat_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0, ret1 := rule(task, rationale); ok {
+			return ret0, ret1
+		}
+	}
+	return output.Ret0, output.Ret1
+}
+
+// WaitForRepeat blocks until Repeat has been called at least n times
+func (f *SpyDoerRepeater) WaitForRepeat(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Repeat_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockRepeat causes calls to Repeat to block until ReleaseRepeat is called
+func (f *SpyDoerRepeater) BlockRepeat() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.repeat_gate == nil {
+		f.repeat_gate = make(chan struct{})
+	}
+}
+
+// ReleaseRepeat lets all calls to Repeat blocked by BlockRepeat proceed
+func (f *SpyDoerRepeater) ReleaseRepeat() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.repeat_gate != nil {
+		close(f.repeat_gate)
+		f.repeat_gate = nil
+	}
+}
+
+// RepeatReturnsWhen makes Repeat return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Repeat_Output
+func (f *SpyDoerRepeater) RepeatReturnsWhen(match func(task, rationale string) bool, ret0 int, ret1 error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.repeat_rules = append(f.repeat_rules, func(task, rationale string) (bool, int, error) {
+		return match(task, rationale), ret0, ret1
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyDoerRepeater) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyDoerRepeater
+	f.DoIt_Called = zero.DoIt_Called
+	f.DoIt_CallCount = zero.DoIt_CallCount
+	f.DoIt_Input = zero.DoIt_Input
+	f.DoIt_Output = zero.DoIt_Output
+	f.doIt_rules = zero.doIt_rules
+	f.Repeat_Called = zero.Repeat_Called
+	f.Repeat_CallCount = zero.Repeat_CallCount
+	f.Repeat_Input = zero.Repeat_Input
+	f.Repeat_Output = zero.Repeat_Output
+	f.repeat_rules = zero.repeat_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyDoerRepeaterSnapshot holds a copy of the calls recorded by SpyDoerRepeater
+type SpyDoerRepeaterSnapshot struct {
+	DoIt_Called    bool
+	DoIt_CallCount int
+	DoIt_Input     struct {
+		Arg0 string
+		Arg1 bool
+	}
+	Repeat_Called    bool
+	Repeat_CallCount int
+	Repeat_Input     struct {
+		Arg0 string
+		Arg1 string
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyDoerRepeater) Snapshot() SpyDoerRepeaterSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyDoerRepeaterSnapshot
+	snapshot.DoIt_Called = f.DoIt_Called
+	snapshot.DoIt_CallCount = f.DoIt_CallCount
+	snapshot.DoIt_Input = f.DoIt_Input
+	snapshot.Repeat_Called = f.Repeat_Called
+	snapshot.Repeat_CallCount = f.Repeat_CallCount
+	snapshot.Repeat_Input = f.Repeat_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ example.Doer = (*SpyDoerRepeater)(nil)
+var _ example.Repeater = (*SpyDoerRepeater)(nil)
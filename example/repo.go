@@ -0,0 +1,22 @@
+package example
+
+// User is stored in a Repo
+type User struct {
+	Name string
+}
+
+// Repo stores items by their ID
+type Repo[T any] interface {
+	Get(id string) (T, error)
+	Put(id string, item T) error
+}
+
+// Rename changes the name of the stored user
+func Rename(users Repo[User], id, name string) error {
+	u, err := users.Get(id)
+	if err != nil {
+		return err
+	}
+	u.Name = name
+	return users.Put(id, u)
+}
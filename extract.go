@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// extract declares an interface holding the methods of a concrete type,
+// writes it into the package within the directory, and then generates
+// test doubles for that package as the gen command does
+func extract(args []string) {
+	f := newGenFlags("extract")
+	typeName := f.fs.String(
+		"type",
+		"",
+		"Name of the concrete type to extract an interface from",
+	)
+	from := f.fs.String(
+		"from",
+		".",
+		"Import path, or directory, of the package declaring the type",
+	)
+	name := f.fs.String(
+		"name",
+		"",
+		"Name of the extracted interface (defaults to the name of the type)",
+	)
+	file := f.fs.String(
+		"file",
+		"",
+		"Name of the file receiving the interface (defaults to <type>_interface.go)",
+	)
+	_ = f.fs.Parse(args)
+
+	if *typeName == "" {
+		fmt.Println("Error -type is required")
+		os.Exit(1)
+	}
+	if *name == "" {
+		*name = *typeName
+	}
+	if *file == "" {
+		*file = strings.ToLower(*typeName) + "_interface.go"
+	}
+
+	// -methods selects the methods to extract, all of which are then spied on
+	methods := splitList(*f.methods)
+	*f.methods = ""
+
+	src, skipped, err := fm.Extract(*f.dir, packageName(*f.dir), *from, *typeName, *name, methods)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		os.Exit(1)
+	}
+	for _, m := range skipped {
+		fmt.Fprintf(os.Stderr, "skipped method %s: uses a type unexported by its package\n", m)
+	}
+
+	w := &fm.FileWriter{Force: *f.force}
+	err = w.Write(filepath.Join(*f.dir, *file), src)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		os.Exit(1)
+	}
+
+	runGen(f)
+}
+
+// packageName returns the name of the package within the directory,
+// or the name of the directory when it holds no package yet
+func packageName(dir string) string {
+	p, err := build.ImportDir(dir, 0)
+	if err == nil {
+		return p.Name
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.Base(dir)
+	}
+	return filepath.Base(abs)
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// generators maps each kind of test double to its generator
+var generators = map[string]fm.DeclGenerator{
+	"spy": &fm.SpyGenerator{
+		Converter:   &fm.SpyStructConverter{},
+		Implementer: &fm.SpyFuncImplementer{},
+	},
+	"mock": &fm.MockGenerator{},
+	"dummy": &fm.DummyGenerator{
+		Converter:   &fm.DummyStructConverter{},
+		Implementer: &fm.DummyFuncImplementer{},
+	},
+	"stub": &fm.StubGenerator{
+		Converter:   &fm.StubStructConverter{},
+		Implementer: &fm.StubFuncImplementer{},
+	},
+	"delegate": &fm.DelegateGenerator{
+		Converter:   &fm.DelegateStructConverter{},
+		Implementer: &fm.DelegateFuncImplementer{},
+	},
+}
+
+// genFlags holds the flags of the gen command, most of which may
+// also be set by fm.toml files
+type genFlags struct {
+	fs           *flag.FlagSet
+	version      *bool
+	out          *string
+	dir          *string
+	kind         *string
+	internal     *bool
+	pkg          *string
+	outdir       *string
+	force        *bool
+	strict       *bool
+	tags         *string
+	constraints  *bool
+	tests        *bool
+	includeFiles *string
+	excludeFiles *string
+	compose      *string
+	methods      *string
+	iface        *string
+	deps         *string
+	manifest     *string
+	format       *string
+}
+
+// newGenFlags defines the flags of the gen command on a new flag set
+func newGenFlags(name string) *genFlags {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return &genFlags{
+		fs:      fs,
+		version: fs.Bool("version", false, "Print version and exit"),
+		out: fs.String(
+			"out",
+			"fm_test.go",
+			"Name of output file with generated spies",
+		),
+		dir: fs.String(
+			"dir",
+			".",
+			"Directory to search for interfaces",
+		),
+		kind: fs.String(
+			"kind",
+			"spy",
+			"Kind of test double to generate: spy, mock, dummy, stub, or delegate",
+		),
+		internal: fs.Bool(
+			"internal",
+			false,
+			"Write spies into the package itself instead of its external test package",
+		),
+		pkg: fs.String(
+			"pkg",
+			"",
+			"Name of a regular, importable package to write spies into",
+		),
+		outdir: fs.String(
+			"outdir",
+			"",
+			"Directory to write spies into (requires -pkg)",
+		),
+		force: fs.Bool(
+			"force",
+			false,
+			"Overwrite the output file even if it was not generated by fm",
+		),
+		strict: fs.Bool(
+			"strict",
+			false,
+			"Exit with an error when any declaration is skipped",
+		),
+		tags: fs.String(
+			"tags",
+			"",
+			"Comma-separated list of build tags to consider when parsing",
+		),
+		constraints: fs.Bool(
+			"constraints",
+			false,
+			"Copy build constraints onto spies, writing a file per constraint",
+		),
+		tests: fs.Bool(
+			"tests",
+			false,
+			"Include interfaces declared in test files",
+		),
+		includeFiles: fs.String(
+			"include-files",
+			"",
+			"Comma-separated list of patterns selecting the files to parse, e.g., *_api.go",
+		),
+		excludeFiles: fs.String(
+			"exclude-files",
+			"",
+			"Comma-separated list of patterns selecting files to skip, e.g., *.pb.go",
+		),
+		compose: fs.String(
+			"compose",
+			"",
+			"Comma-separated list of interfaces of the package to implement together, e.g., Doer+Repeater",
+		),
+		methods: fs.String(
+			"methods",
+			"",
+			"Comma-separated list of the methods to spy on, e.g., Get,Put; the others panic when called",
+		),
+		iface: fs.String(
+			"iface",
+			"",
+			"Comma-separated list of instantiations of generic interfaces, e.g., Repo[example.User]",
+		),
+		deps: fs.String(
+			"deps",
+			"",
+			"Name of a struct whose interface-typed fields receive test doubles",
+		),
+		manifest: fs.String(
+			"manifest",
+			"",
+			"Name of a JSON file describing what was generated",
+		),
+		format: fs.String(
+			"format",
+			"text",
+			"Output format on stdout: text, or json for a description of what was generated",
+		),
+	}
+}
+
+// configure loads the fm.toml files for the directory and applies each
+// of their settings whose flag was not passed on the command line. It
+// returns the effective settings
+func (f *genFlags) configure() (*fm.Config, error) {
+	cfg, err := fm.LoadConfig(*f.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	f.setString("kind", f.kind, cfg.Kind)
+	f.setString("pkg", f.pkg, cfg.Package)
+	f.setString("outdir", f.outdir, cfg.OutDir)
+	f.setString("out", f.out, cfg.Out)
+	f.setBool("internal", f.internal, cfg.Internal)
+	f.setBool("strict", f.strict, cfg.Strict)
+	f.setBool("constraints", f.constraints, cfg.Constraints)
+	f.setBool("tests", f.tests, cfg.Tests)
+	if isFlagSet(f.fs, "tags") {
+		cfg.Tags = splitList(*f.tags)
+	}
+	if isFlagSet(f.fs, "include-files") {
+		cfg.IncludeFiles = splitList(*f.includeFiles)
+	}
+	if isFlagSet(f.fs, "exclude-files") {
+		cfg.ExcludeFiles = splitList(*f.excludeFiles)
+	}
+	if isFlagSet(f.fs, "compose") {
+		cfg.Compose = splitList(*f.compose)
+	}
+	if isFlagSet(f.fs, "methods") {
+		cfg.Methods = splitList(*f.methods)
+	}
+	if isFlagSet(f.fs, "iface") {
+		cfg.Iface = splitTypes(*f.iface)
+	}
+	if *f.pkg != "" && !isFlagSet(f.fs, "out") && cfg.Out == "" {
+		*f.out = "fm.go"
+	}
+
+	cfg.Kind, cfg.Out, cfg.Package, cfg.OutDir = *f.kind, *f.out, *f.pkg, *f.outdir
+	cfg.Internal, cfg.Strict, cfg.Constraints = *f.internal, *f.strict, *f.constraints
+	cfg.Tests = *f.tests
+	return cfg, nil
+}
+
+// splitList returns the items of a comma-separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// splitTypes returns the types of a comma-separated list, keeping
+// together the type arguments of each, e.g., Pair[string, int]
+func splitTypes(list string) []string {
+	var items []string
+	var depth, start int
+	for i, r := range list + "," {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == ',' && depth == 0:
+			if item := strings.TrimSpace(list[start:i]); item != "" {
+				items = append(items, item)
+			}
+			start = i + 1
+		}
+	}
+	return items
+}
+
+// setString applies a configured value unless the named flag was set
+func (f *genFlags) setString(name string, p *string, value string) {
+	if value != "" && !isFlagSet(f.fs, name) {
+		*p = value
+	}
+}
+
+// setBool applies a configured value unless the named flag was set
+func (f *genFlags) setBool(name string, p *bool, value bool) {
+	if value && !isFlagSet(f.fs, name) {
+		*p = value
+	}
+}
+
+// gen generates test doubles for the interfaces within a directory
+func gen(args []string) {
+	f := newGenFlags("gen")
+	_ = f.fs.Parse(args)
+	runGen(f)
+}
+
+// runGen generates test doubles as the parsed flags direct
+func runGen(f *genFlags) {
+	if *f.version {
+		version()
+		return
+	}
+
+	cfg, err := f.configure()
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		os.Exit(1)
+	}
+
+	if *f.pkg != "" && *f.internal {
+		fmt.Println("Error -pkg cannot be combined with -internal")
+		os.Exit(1)
+	}
+	if *f.outdir != "" && *f.pkg == "" {
+		fmt.Println("Error -outdir requires -pkg")
+		os.Exit(1)
+	}
+
+	if *f.format != "text" && *f.format != "json" {
+		fmt.Printf("Error unknown format %q\n", *f.format)
+		os.Exit(1)
+	}
+
+	if _, ok := generators[*f.kind]; !ok {
+		fmt.Printf("Error unknown kind %q\n", *f.kind)
+		os.Exit(1)
+	}
+
+	// the source importer which type-checks the generated code only
+	// honors the default context, so the tags are applied to it, as
+	// are GOOS and GOARCH from the environment
+	build.Default.BuildTags = append(build.Default.BuildTags, cfg.Tags...)
+
+	parser := &fm.SrcFileParser{
+		Tests:   cfg.Tests,
+		Include: cfg.IncludeFiles,
+		Exclude: cfg.ExcludeFiles,
+	}
+	c := &fm.Cmd{
+		DeclGenerator: &fm.KindGenerator{Default: *f.kind, Explicit: isFlagSet(f.fs, "kind"), Generators: generators},
+		Parser:        parser,
+		Writer:        &fm.FileWriter{Force: *f.force},
+		ImportWriter:  &fm.GoImportsWriter{},
+		Checker:       &fm.TypeChecker{Parser: parser},
+		Internal:      *f.internal,
+		Strict:        *f.strict,
+		Package:       *f.pkg,
+		OutputDir:     *f.outdir,
+		Warnings:      os.Stderr,
+		Include:       cfg.Include,
+		Exclude:       cfg.Exclude,
+		Names:         cfg.Names,
+		Compose:       cfg.Compose,
+		Methods:       cfg.Methods,
+		Instantiate:   cfg.Iface,
+		Constraints:   *f.constraints,
+		Deps:          *f.deps,
+	}
+	if *f.manifest != "" || *f.format == "json" {
+		c.Manifest = &fm.Manifest{}
+	}
+
+	err = c.Run(*f.dir, *f.out)
+
+	// the manifest is written even when the run fails, since it
+	// describes what was skipped and why
+	if c.Manifest != nil {
+		writeErr := writeManifest(c.Manifest, *f.manifest, *f.format == "json")
+		if writeErr != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", writeErr)
+			os.Exit(1)
+		}
+	}
+
+	if err != nil {
+		out := os.Stdout
+		if *f.format == "json" {
+			out = os.Stderr
+		}
+		fmt.Fprintf(out, "Error %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeManifest encodes the manifest as JSON to the named file,
+// if any, and to stdout when requested
+func writeManifest(m *fm.Manifest, filename string, stdout bool) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if filename != "" {
+		err = ioutil.WriteFile(filename, data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	if stdout {
+		_, err = os.Stdout.Write(data)
+	}
+	return err
+}
+
+// isFlagSet reports whether the named flag was passed on the command line
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	var set bool
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,292 @@
+package fm
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	posType = reflect.TypeOf(token.NoPos)
+	objType = reflect.TypeOf(&ast.Object{})
+)
+
+// stripPos returns a deep copy of an AST node without any position
+// information. Nodes taken from a parsed source file carry positions
+// from that file, which confuse the printer's placement of the comments
+// added to generated code
+func stripPos(node ast.Node) ast.Node {
+	return stripValue(reflect.ValueOf(node)).Interface().(ast.Node)
+}
+
+func stripValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == objType {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(stripValue(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(stripValue(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(stripValue(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).Type == posType {
+				continue
+			}
+			c.Field(i).Set(stripValue(v.Field(i)))
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// makeStmt makes a channel if it has not been made yet:
+//
+//	if ch == nil {
+//		ch = make(chan struct{})
+//	}
+func makeStmt(ch ast.Expr) ast.Stmt {
+	return &ast.IfStmt{
+		Cond: &ast.BinaryExpr{
+			X:  ch,
+			Op: token.EQL,
+			Y:  ast.NewIdent("nil"),
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{ch},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{&ast.CallExpr{
+					Fun:  ast.NewIdent("make"),
+					Args: []ast.Expr{emptyChanType()},
+				}},
+			},
+		}},
+	}
+}
+
+// closeStmt closes and resets a channel if it has been made:
+//
+//	if ch != nil {
+//		close(ch)
+//		ch = nil
+//	}
+func closeStmt(ch ast.Expr) ast.Stmt {
+	return &ast.IfStmt{
+		Cond: &ast.BinaryExpr{
+			X:  ch,
+			Op: token.NEQ,
+			Y:  ast.NewIdent("nil"),
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.ExprStmt{X: &ast.CallExpr{
+				Fun:  ast.NewIdent("close"),
+				Args: []ast.Expr{ch},
+			}},
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{ch},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{ast.NewIdent("nil")},
+			},
+		}},
+	}
+}
+
+// lockStmt returns the statement f.mu.Lock()
+func lockStmt() ast.Stmt {
+	return &ast.ExprStmt{X: &ast.CallExpr{Fun: recvSelector("mu", "Lock")}}
+}
+
+// unlockStmt returns the statement f.mu.Unlock()
+func unlockStmt() ast.Stmt {
+	return &ast.ExprStmt{X: &ast.CallExpr{Fun: recvSelector("mu", "Unlock")}}
+}
+
+// deferUnlockStmt returns the statement defer f.mu.Unlock()
+func deferUnlockStmt() ast.Stmt {
+	return &ast.DeferStmt{Call: &ast.CallExpr{Fun: recvSelector("mu", "Unlock")}}
+}
+
+// uniqueName returns base, or base with trailing underscores when needed
+// to avoid clashing with any of the function's parameter or result names
+func uniqueName(base string, f *ast.FuncType) string {
+	var lists []*ast.FieldList
+	lists = append(lists, f.Params, f.Results)
+
+	name := base
+	for {
+		taken := false
+		for _, list := range lists {
+			if list == nil {
+				continue
+			}
+			for _, field := range list.List {
+				for _, n := range field.Names {
+					if n.Name == name {
+						taken = true
+					}
+				}
+			}
+		}
+		if !taken {
+			return name
+		}
+		name += "_"
+	}
+}
+
+// paramNames returns the names of all of the function's parameters
+func paramNames(f *ast.FuncType) []ast.Expr {
+	var names []ast.Expr
+	if f.Params == nil {
+		return names
+	}
+	for _, field := range f.Params.List {
+		for _, n := range field.Names {
+			names = append(names, ast.NewIdent(n.Name))
+		}
+	}
+	return names
+}
+
+// callWithParams returns a call of fun which passes along all of the
+// function's parameters, including any variadic parameter
+func callWithParams(fun ast.Expr, f *ast.FuncType) *ast.CallExpr {
+	call := &ast.CallExpr{Fun: fun, Args: paramNames(f)}
+	types := paramTypes(f)
+	if len(types) > 0 {
+		if _, ok := types[len(types)-1].(*ast.Ellipsis); ok {
+			// any valid position prints the ellipsis
+			call.Ellipsis = 1
+		}
+	}
+	return call
+}
+
+// resultTypes returns the type of each of the function's result values,
+// e.g., (a, b int) results in [int, int]
+func resultTypes(f *ast.FuncType) []ast.Expr {
+	return fieldTypes(f.Results)
+}
+
+// paramTypes returns the type of each of the function's parameters
+func paramTypes(f *ast.FuncType) []ast.Expr {
+	return fieldTypes(f.Params)
+}
+
+// fieldTypes returns the type of each value declared in the field list
+func fieldTypes(list *ast.FieldList) []ast.Expr {
+	var types []ast.Expr
+	if list == nil {
+		return types
+	}
+	for _, field := range list.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			types = append(types, field.Type)
+		}
+	}
+	return types
+}
+
+// zeroValue returns an expression for the zero value of any type T, i.e., *new(T)
+func zeroValue(t ast.Expr) ast.Expr {
+	return &ast.StarExpr{X: &ast.CallExpr{
+		Fun:  ast.NewIdent("new"),
+		Args: []ast.Expr{t},
+	}}
+}
+
+// docComment returns a comment group with one comment per line
+func docComment(lines ...string) *ast.CommentGroup {
+	var list []*ast.Comment
+	for _, l := range lines {
+		list = append(list, &ast.Comment{Text: "// " + l})
+	}
+	return &ast.CommentGroup{List: list}
+}
+
+// isIdent reports whether the expression is the identifier name
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+// recvSelector returns a selector expression rooted at the receiver,
+// e.g., recvSelector("mu", "Lock") returns f.mu.Lock
+func recvSelector(names ...string) ast.Expr {
+	return selector(recvName, names...)
+}
+
+// selector returns a selector expression of the form x.names[0].names[1]...
+func selector(x string, names ...string) ast.Expr {
+	var expr ast.Expr = ast.NewIdent(x)
+	for _, n := range names {
+		expr = &ast.SelectorExpr{X: expr, Sel: ast.NewIdent(n)}
+	}
+	return expr
+}
+
+// emptyChanType returns the type chan struct{}. The empty struct is
+// written as an identifier so that it prints on a single line
+func emptyChanType() ast.Expr {
+	return &ast.ChanType{
+		Dir:   ast.SEND | ast.RECV,
+		Value: ast.NewIdent("struct{}"),
+	}
+}
+
+// unexported lowercases the first letter of name, keeping fields which
+// only the spy itself uses out of its public API
+func unexported(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
+
+// assertionDecl returns a compile-time assertion that the named struct
+// implements the interface, e.g., var _ Doer = (*SpyDoer)(nil)
+func assertionDecl(iface, structName string) ast.Decl {
+	return &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{&ast.ValueSpec{
+			Names: []*ast.Ident{ast.NewIdent("_")},
+			Type:  ast.NewIdent(iface),
+			Values: []ast.Expr{&ast.CallExpr{
+				Fun:  &ast.ParenExpr{X: &ast.StarExpr{X: ast.NewIdent(structName)}},
+				Args: []ast.Expr{ast.NewIdent("nil")},
+			}},
+		}},
+	}
+}
+
+// funcAssertionDecl returns a compile-time assertion that the named struct
+// provides the func type as a method, e.g., var _ Clock = (*SpyClock)(nil).Clock
+func funcAssertionDecl(fn, structName string) ast.Decl {
+	decl := assertionDecl(fn, structName).(*ast.GenDecl)
+	valueSpec := decl.Specs[0].(*ast.ValueSpec)
+	valueSpec.Values[0] = &ast.SelectorExpr{X: valueSpec.Values[0], Sel: ast.NewIdent(fn)}
+	return decl
+}
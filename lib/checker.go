@@ -0,0 +1,388 @@
+package fm
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TypeChecker type-checks generated source against the package
+// it was generated from
+type TypeChecker struct {
+	// Parser selects the files of the package which are checked along
+	// with the generated source. Defaults to a SrcFileParser in the
+	// default context, in which imported packages are always loaded
+	Parser Parser
+}
+
+// Check parses and type-checks the sources destined for each of the files,
+// which were generated together, in turn. When a source belongs to the
+// package within dir, e.g., in internal mode, the two are checked together
+// along with the other generated files of the package, whether generated
+// before or along with it. Otherwise the package within dir is imported
+// like any other. The error for invalid code names the interface and method
+// which produced it
+func (c *TypeChecker) Check(dir string, srcs map[string][]byte) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	pending := make(map[string][]byte)
+	var filenames []string
+	for filename, src := range srcs {
+		filename, err := filepath.Abs(filename)
+		if err != nil {
+			return err
+		}
+		pending[filename] = src
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		err = c.check(dir, filename, pending)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check type-checks the source destined for filename, which is one of
+// the pending files to be written, by absolute name
+func (c *TypeChecker) check(dir, filename string, pending map[string][]byte) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, pending[filename], 0)
+	if err != nil {
+		return fmt.Errorf("generated code does not parse: %v", err)
+	}
+
+	p := c.Parser
+	if p == nil {
+		p = &SrcFileParser{}
+	}
+	pkgs, err := p.ParseDir(fset, dir)
+	if err != nil {
+		return err
+	}
+
+	files := []*ast.File{file}
+	if filepath.Dir(filename) == dir {
+		if p, ok := pkgs[file.Name.Name]; ok {
+			files = append(files, sortedFiles(p)...)
+		}
+
+		// the other generated files are always checked along with the
+		// source, as test files may refer to their test doubles and any
+		// test double declared twice keeps the package from compiling.
+		// Those about to be replaced are checked as they will be written
+		others, err := parser.ParseDir(fset, dir, otherGeneratedFile(dir, pending), 0)
+		if err != nil {
+			return err
+		}
+		if p, ok := others[file.Name.Name]; ok {
+			files = append(files, sortedFiles(p)...)
+		}
+		pendingFiles, err := otherPendingFiles(fset, dir, filename, pending)
+		if err != nil {
+			return err
+		}
+		for _, f := range pendingFiles {
+			if f.Name.Name == file.Name.Name {
+				files = append(files, f)
+			}
+		}
+	}
+
+	// the test files of a package, e.g., export_test.go, are only
+	// visible to its external test package
+	var imp types.Importer = newSrcImporter(fset, dir)
+	base := strings.TrimSuffix(file.Name.Name, "_test")
+	if p, ok := pkgs[base]; ok && base != file.Name.Name && hasTestFiles(fset, p) {
+		if path, err := importPath(dir); err == nil {
+			imp = &testImporter{fset: fset, path: path, files: sortedFiles(p), fallback: imp}
+		}
+	}
+
+	var errs []types.Error
+	conf := types.Config{
+		Importer: imp,
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok {
+				errs = append(errs, typeErr)
+			}
+		},
+	}
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	_, err = conf.Check(file.Name.Name, fset, files, info)
+	if err == nil {
+		return nil
+	}
+	if len(errs) == 0 {
+		return err
+	}
+
+	// report the first error within the generated code, as any others
+	// tend to follow from it
+	for _, typeErr := range errs {
+		if fset.Position(typeErr.Pos).Filename != filename {
+			continue
+		}
+		return fmt.Errorf("%s does not compile: %v", describeOrigin(file, info, typeErr.Pos), typeErr)
+	}
+	return errs[0]
+}
+
+// testImporter imports the package at path from its files, including
+// its test files, and any other package from source
+type testImporter struct {
+	fset     *token.FileSet
+	path     string
+	files    []*ast.File
+	fallback types.Importer
+	pkg      *types.Package
+}
+
+// Import returns the package at path
+func (i *testImporter) Import(path string) (*types.Package, error) {
+	if path != i.path {
+		return i.fallback.Import(path)
+	}
+	if i.pkg == nil {
+		conf := types.Config{Importer: i.fallback}
+		pkg, err := conf.Check(path, i.fset, i.files, nil)
+		if err != nil {
+			return nil, err
+		}
+		i.pkg = pkg
+	}
+	return i.pkg, nil
+}
+
+// otherGeneratedFile returns an ast.Filter which keeps the files of dir
+// generated by fm, other than those pending, which are built by default
+func otherGeneratedFile(dir string, pending map[string][]byte) func(os.FileInfo) bool {
+	return func(info os.FileInfo) bool {
+		if _, ok := pending[filepath.Join(dir, info.Name())]; ok {
+			return false
+		}
+		if ok, err := build.Default.MatchFile(dir, info.Name()); err != nil || !ok {
+			return false
+		}
+		generated, err := isGenerated(filepath.Join(dir, info.Name()))
+		return err == nil && generated
+	}
+}
+
+// otherPendingFiles parses the pending files of dir, other than filename,
+// which are built by default, in order
+func otherPendingFiles(fset *token.FileSet, dir, filename string, pending map[string][]byte) ([]*ast.File, error) {
+	var names []string
+	for name := range pending {
+		if name != filename && filepath.Dir(name) == dir {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var files []*ast.File
+	for _, name := range names {
+		// the build constraint is read from the source, as the file
+		// may not have been written yet
+		ctx := build.Default
+		src := pending[name]
+		ctx.OpenFile = func(string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(src)), nil
+		}
+		if ok, err := ctx.MatchFile(dir, filepath.Base(name)); err != nil || !ok {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, src, 0)
+		if err != nil {
+			return nil, fmt.Errorf("generated code does not parse: %v", err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// hasTestFiles reports whether any file of the package is a test file
+func hasTestFiles(fset *token.FileSet, p *ast.Package) bool {
+	if p == nil {
+		return false
+	}
+	for _, f := range p.Files {
+		if isTestFile(fset, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTestFile reports whether the file is a test file
+func isTestFile(fset *token.FileSet, f *ast.File) bool {
+	return strings.HasSuffix(fset.Position(f.Package).Filename, "_test.go")
+}
+
+// origin is an interface whose generated implementation is
+// asserted within the generated code
+type origin struct {
+	iface   string
+	methods []string
+}
+
+// describeOrigin names the interface, and method when possible,
+// whose generated code contains the position
+func describeOrigin(file *ast.File, info *types.Info, pos token.Pos) string {
+	origins := assertedOrigins(file, info)
+
+	owner, member := enclosingNames(file, pos)
+	var structName string
+	for name := range origins {
+		if strings.HasPrefix(owner, name) && len(name) > len(structName) {
+			structName = name
+		}
+	}
+	if structName == "" {
+		return "generated code"
+	}
+	o := origins[structName]
+
+	// the method's name is found in that of the generated function or field,
+	// e.g., WaitForDoIt or DoIt_Input, or of the generated type, e.g., MockDoerDoItCall
+	if member == "" {
+		member = strings.TrimPrefix(owner, structName)
+	}
+	var method string
+	for _, m := range o.methods {
+		if strings.Contains(member, m) && len(m) > len(method) {
+			method = m
+		}
+	}
+	if method == "" {
+		return fmt.Sprintf("%s for interface %s", structName, o.iface)
+	}
+	return fmt.Sprintf("%s for interface %s, method %s", structName, o.iface, method)
+}
+
+// assertedOrigins maps the name of each struct named in a compile-time
+// assertion to the interface it implements
+func assertedOrigins(file *ast.File, info *types.Info) map[string]origin {
+	origins := make(map[string]origin)
+	for _, d := range file.Decls {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec, ok := spec.(*ast.ValueSpec)
+			if !ok || valueSpec.Type == nil || len(valueSpec.Values) != 1 {
+				continue
+			}
+			structName := assertedStruct(valueSpec.Values[0])
+			if structName == "" {
+				continue
+			}
+
+			o := origin{iface: types.ExprString(valueSpec.Type)}
+			if t := info.TypeOf(valueSpec.Type); t != nil {
+				switch u := t.Underlying().(type) {
+				case *types.Interface:
+					for idx := 0; idx < u.NumMethods(); idx++ {
+						o.methods = append(o.methods, u.Method(idx).Name())
+					}
+				case *types.Signature:
+					// the method standing in for a func type shares its name
+					name := o.iface[strings.LastIndex(o.iface, ".")+1:]
+					o.methods = append(o.methods, name)
+				}
+			}
+			sort.Strings(o.methods)
+			origins[structName] = o
+		}
+	}
+	return origins
+}
+
+// assertedStruct returns the struct named in an expression
+// such as (*SpyDoer)(nil), or (*SpyClock)(nil).Clock for a func type
+func assertedStruct(e ast.Expr) string {
+	if sel, ok := e.(*ast.SelectorExpr); ok {
+		e = sel.X
+	}
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return ""
+	}
+	paren, ok := call.Fun.(*ast.ParenExpr)
+	if !ok {
+		return ""
+	}
+	star, ok := paren.X.(*ast.StarExpr)
+	if !ok {
+		return ""
+	}
+	ident, ok := star.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	return ident.Name
+}
+
+// enclosingNames returns the name of the type, or receiver type, declared
+// at the position along with the name of the function or field, if any
+func enclosingNames(file *ast.File, pos token.Pos) (owner, member string) {
+	for _, d := range file.Decls {
+		if pos < d.Pos() || pos >= d.End() {
+			continue
+		}
+		switch decl := d.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv != nil && len(decl.Recv.List) == 1 {
+				owner = types.ExprString(decl.Recv.List[0].Type)
+				owner = strings.TrimPrefix(owner, "*")
+			}
+			return owner, decl.Name.Name
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if pos < spec.Pos() || pos >= spec.End() {
+					continue
+				}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					return s.Name.Name, enclosingField(s, pos)
+				case *ast.ValueSpec:
+					if len(s.Values) == 1 {
+						return assertedStruct(s.Values[0]), ""
+					}
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// enclosingField returns the name of the struct field declared at the
+// position, if any
+func enclosingField(t *ast.TypeSpec, pos token.Pos) string {
+	structType, ok := t.Type.(*ast.StructType)
+	if !ok {
+		return ""
+	}
+	for _, field := range structType.Fields.List {
+		if pos >= field.Pos() && pos < field.End() && len(field.Names) > 0 {
+			return field.Names[0].Name
+		}
+	}
+	return ""
+}
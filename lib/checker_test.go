@@ -0,0 +1,192 @@
+package fm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+const checkedSource = `package sample
+
+type Doer interface {
+	Do(task string) error
+}
+`
+
+func TestCheckAcceptsValidSource(t *testing.T) {
+	dir := writeCheckedSource(t)
+
+	c := &fm.TypeChecker{}
+	err := c.Check(dir, map[string][]byte{path.Join(dir, "fm_test.go"): []byte(`package sample
+
+type SpyDoer struct{}
+
+func (f *SpyDoer) Do(task string) error { return nil }
+
+var _ Doer = (*SpyDoer)(nil)
+`)})
+
+	if err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
+
+// TestCheckNamesInterfaceAndMethod ensures invalid generated code is
+// traced back to the interface and method it was generated from
+func TestCheckNamesInterfaceAndMethod(t *testing.T) {
+	dir := writeCheckedSource(t)
+
+	c := &fm.TypeChecker{}
+	err := c.Check(dir, map[string][]byte{path.Join(dir, "fm_test.go"): []byte(`package sample
+
+type SpyDoer struct{}
+
+func (f *SpyDoer) Do(task string) error { return undefinedError }
+
+var _ Doer = (*SpyDoer)(nil)
+`)})
+
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := "SpyDoer for interface Doer, method Do does not compile"
+	got := err.Error()
+
+	if !strings.Contains(got, want) {
+		t.Errorf("want %v in %v", want, got)
+	}
+}
+
+// TestCheckRejectsMissingMethod ensures the compile-time assertion
+// catches implementations which do not satisfy the interface
+func TestCheckRejectsMissingMethod(t *testing.T) {
+	dir := writeCheckedSource(t)
+
+	c := &fm.TypeChecker{}
+	err := c.Check(dir, map[string][]byte{path.Join(dir, "fm_test.go"): []byte(`package sample
+
+type SpyDoer struct{}
+
+var _ Doer = (*SpyDoer)(nil)
+`)})
+
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := "SpyDoer for interface Doer does not compile"
+	got := err.Error()
+
+	if !strings.Contains(got, want) {
+		t.Errorf("want %v in %v", want, got)
+	}
+}
+
+func writeCheckedSource(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("TempDir failed with %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	err = ioutil.WriteFile(path.Join(dir, "sample.go"), []byte(checkedSource), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile failed with %v", err)
+	}
+	return dir
+}
+
+// TestRunResolvesImportsFromTheSourceModule ensures the packages the
+// source imports are found within its module, rather than within that
+// of the working directory, when checking spies, finding dependencies,
+// and extracting interfaces
+func TestRunResolvesImportsFromTheSourceModule(t *testing.T) {
+	root, rmDir := writeTree(t, map[string]string{
+		"other/go.mod":  "module example.com/other\n",
+		"sample/go.mod": "module example.com/sample\n",
+		"sample/model/model.go": `package model
+
+type User struct{}
+
+type Client struct{}
+
+func (c *Client) Get(id string) (User, error) { return User{}, nil }
+`,
+		"sample/sample.go": `package sample
+
+import "example.com/sample/model"
+
+type Store interface {
+	Get(id string) (model.User, error)
+}
+
+type Service struct {
+	store Store
+}
+`,
+	})
+	defer rmDir()
+	dir := filepath.Join(root, "sample")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd failed with %v", err)
+	}
+	err = os.Chdir(filepath.Join(root, "other"))
+	if err != nil {
+		t.Fatalf("Chdir failed with %v", err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	runChecked(t, &fm.Cmd{DeclGenerator: buildGen()}, dir, "fm_test.go")
+	runChecked(t, &fm.Cmd{DeclGenerator: buildGen(), Deps: "Service"}, dir, "fm_test.go")
+
+	_, _, err = fm.Extract(dir, "sample", "example.com/sample/model", "Client", "Getter", nil)
+	if err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
+
+// TestRunRejectsTestDoublesDeclaredByOtherGeneratedFiles ensures a test
+// double already declared by another generated file fails the check,
+// even when test files are not parsed
+func TestRunRejectsTestDoublesDeclaredByOtherGeneratedFiles(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type Store interface {
+	Get(id string) (string, error)
+}
+
+type Service struct {
+	store Store
+}
+`,
+	})
+	defer rmDir()
+
+	runChecked(t, &fm.Cmd{DeclGenerator: buildGen()}, dir, "fm_test.go")
+
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{},
+		Writer:        &fm.FileWriter{},
+		ImportWriter:  &fm.GoImportsWriter{},
+		Checker:       &fm.TypeChecker{},
+		Deps:          "Service",
+	}
+	err := cmd.Run(dir, "fm_deps_test.go")
+
+	if err == nil || !strings.Contains(err.Error(), "SpyStore") {
+		t.Errorf("want error naming SpyStore, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fm_deps_test.go")); !os.IsNotExist(err) {
+		t.Errorf("want no fm_deps_test.go, got %v", err)
+	}
+}
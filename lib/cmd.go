@@ -1,8 +1,13 @@
 package fm
 
 import (
+	"fmt"
 	"go/ast"
+	"go/token"
+	"io"
+	"os"
 	"path"
+	"sort"
 	"strings"
 )
 
@@ -13,71 +18,193 @@ const (
 	retPrefix    = "Ret"
 )
 
-// DeclGenerator creates a new slice of ast declarations based on the input
+// DeclGenerator creates a new slice of ast declarations based on the input,
+// along with diagnostics for the declarations it skipped
 type DeclGenerator interface {
-	Generate(ds []ast.Decl) []ast.Decl
+	Generate(ds []ast.Decl) ([]ast.Decl, []Diagnostic)
+}
+
+// Diagnostic reports a declaration which was skipped or is unsupported
+type Diagnostic struct {
+	Pos     token.Pos
+	Message string
 }
 
 // Parser is responsible for returning the ASTs of all files
-// within a directory
+// within a directory, recording their positions in the file set
 type Parser interface {
-	ParseDir(dir string) (map[string]*ast.Package, error)
+	ParseDir(fset *token.FileSet, dir string) (map[string]*ast.Package, error)
 }
 
-// Writer writes the ast.File to the provided filename
+// Writer writes the source to the provided filename
 type Writer interface {
-	Write(file *ast.File, filename string) error
+	Write(filename string, src []byte) error
 }
 
-// ImportWriter runs goimport against the specified file, writing the results
-// back out to the same file
+// ImportWriter adds missing import statements to the source destined for
+// the specified file, returning the result
 type ImportWriter interface {
-	Write(filename string) error
+	Write(filename string, src []byte) ([]byte, error)
+}
+
+// Checker verifies the sources destined for the specified files, which
+// were generated together from the package within dir
+type Checker interface {
+	Check(dir string, srcs map[string][]byte) error
 }
 
 // Cmd coordinates between a parser, a generator, and a file writer.
 // It passes a parsed AST to the generator which produces an AST of spies
-// from the original AST, and then passes the generated AST to the file
-// writer, which saves the result to disk in the form of regular Go code.
+// from the original AST, renders the generated AST as regular Go code
+// with its imports in memory, and then passes the result to the file
+// writer, which saves it to disk.
 type Cmd struct {
 	DeclGenerator
 	Parser
 	Writer
 	ImportWriter
+
+	// Internal writes spies into the package itself rather than into
+	// its external *_test package
+	Internal bool
+	// Package names a regular, importable package which receives the
+	// spies in place of the external *_test package
+	Package string
+	// OutputDir is the directory the spies are written to.
+	// Defaults to the working directory when empty
+	OutputDir string
+	// Checker verifies the generated source before it is written.
+	// Verification is skipped when nil
+	Checker Checker
+	// Manifest records what was generated, when set
+	Manifest *Manifest
+	// Strict fails the run, before anything is written, when any
+	// declaration is skipped or unsupported
+	Strict bool
+	// Warnings receives a positional diagnostic for every declaration
+	// which is skipped or unsupported. Warnings are discarded when nil
+	Warnings io.Writer
+	// Include and Exclude select the interfaces to generate by name,
+	// with patterns as understood by path.Match. All interfaces are
+	// included when Include is empty
+	Include []string
+	Exclude []string
+	// Names maps interfaces to the names of their generated types,
+	// unless an //fm:name directive names them already
+	Names map[string]string
+	// Constraints copies the build constraint of each source file onto
+	// the spies generated from it, writing the spies for each distinct
+	// constraint into a file of their own
+	Constraints bool
+	// Compose lists composites of the interfaces declared by the package,
+	// e.g., Doer+Repeater, each of which receives a single test double,
+	// e.g., SpyDoerRepeater, implementing all of its members
+	Compose []string
+	// Methods selects the methods to generate test doubles for by name,
+	// with patterns as understood by path.Match. The others panic when
+	// called. All methods are selected when Methods is empty
+	Methods []string
+	// Instantiate lists instantiations of the generic interfaces declared
+	// by the package, e.g., Repo[example.User], each of which receives a
+	// test double of its own, e.g., SpyRepoUser
+	Instantiate []string
+	// Deps names a struct whose interface-typed fields receive test
+	// doubles in place of the interfaces declared by the package
+	Deps string
 }
 
 // Run parses the AST within the working directory and passes it to
 // the declaration generator. The result of the generator is then written
-// to the designated destination with *_test as the new package name
+// to the designated destination with *_test as the new package name,
+// with the original package name when running in internal mode, or with
+// the name of the designated package. Outside of internal mode, types
+// declared in the original package are qualified and imported.
 func (c *Cmd) Run(directory, outputFilename string) error {
-	pkgs, err := c.ParseDir(directory)
+	if !strings.HasSuffix(outputFilename, ".go") {
+		outputFilename += ".go"
+	}
+	if c.Package != "" && strings.HasSuffix(outputFilename, "_test.go") {
+		return fmt.Errorf("package %s would not be importable from %s", c.Package, outputFilename)
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := c.ParseDir(fset, directory)
 	if err != nil {
 		return err
 	}
 
+	outputDir := directory
+	if c.OutputDir != "" {
+		outputDir = c.OutputDir
+		err = os.MkdirAll(outputDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	// all files are generated before any is written, so that a skipped
+	// declaration in strict mode leaves every file untouched
+	var files []*generatedFile
+	var skipped int
+	filename := path.Join(outputDir, outputFilename)
 	for pname, p := range pkgs {
-		var decls []ast.Decl
-		for _, f := range p.Files {
-			spyDecls := c.Generate(f.Decls)
-			decls = append(decls, spyDecls...)
+		// the spies for an external test package are generated
+		// along with those of the package it tests
+		if base := strings.TrimSuffix(pname, "_test"); base != pname && pkgs[base] != nil {
+			continue
+		}
+		if ext, ok := pkgs[pname+"_test"]; ok {
+			p = mergePackages(p, ext)
+		}
+		var instances []instance
+		if c.Deps == "" {
+			err = checkComposites(p, c.Compose)
+			if err != nil {
+				return err
+			}
+			instances, err = parseInstances(p, c.Instantiate)
+			if err != nil {
+				return err
+			}
 		}
 
-		astFile := &ast.File{
-			Name:  ast.NewIdent(pname + "_test"),
-			Decls: decls,
+		constraints, groups := []string{""}, [][]*ast.File{sortedFiles(p)}
+		// the dependencies of a struct are found within the whole package
+		if c.Constraints && c.Deps == "" {
+			constraints, groups = constraintGroups(p)
 		}
 
-		if !strings.HasSuffix(outputFilename, ".go") {
-			outputFilename += ".go"
+		for i, group := range groups {
+			out := filename
+			if constraints[i] != "" {
+				out = constrainedFilename(filename, constraints[i])
+			}
+			gen, err := c.generateFile(fset, directory, pname, out, constraints[i], group, instances)
+			if err != nil {
+				return err
+			}
+			files = append(files, gen)
+			skipped += gen.skipped
 		}
+	}
 
-		filename := path.Join(directory, outputFilename)
-		err = c.Writer.Write(astFile, filename)
+	if c.Strict && skipped > 0 {
+		return fmt.Errorf("%d declaration(s) skipped in strict mode", skipped)
+	}
+	// every file is checked before any is written, so that invalid code
+	// in one of them leaves all of them untouched
+	if c.Checker != nil {
+		srcs := make(map[string][]byte)
+		for _, f := range files {
+			srcs[f.filename] = f.src
+		}
+		err = c.Checker.Check(directory, srcs)
 		if err != nil {
 			return err
 		}
-
-		err = c.ImportWriter.Write(filename)
+	}
+	for _, f := range files {
+		err = c.Writer.Write(f.filename, f.src)
 		if err != nil {
 			return err
 		}
@@ -85,3 +212,298 @@ func (c *Cmd) Run(directory, outputFilename string) error {
 
 	return nil
 }
+
+// generatedFile holds the rendered source destined for a file, along
+// with the number of declarations skipped while generating it
+type generatedFile struct {
+	filename string
+	src      []byte
+	skipped  int
+}
+
+// generateFile generates the spies for the files of the package pname
+// and renders them for filename under the build constraint, if any
+func (c *Cmd) generateFile(fset *token.FileSet, directory, pname, filename, constraint string, files []*ast.File, instances []instance) (*generatedFile, error) {
+	imports := newImportSet()
+	var srcPath string
+	var srcErr error
+	if !c.Internal {
+		srcPath, srcErr = importPath(directory)
+		imports.reserve(pname, srcPath)
+	}
+
+	var out *output
+	if c.Deps != "" {
+		var err error
+		out, err = c.generateDeps(fset, directory, pname, files, imports)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		out = c.generateDecls(fset, pname, filename, files, imports, instances)
+	}
+
+	c.report(fset, out.diags)
+	if c.Manifest != nil {
+		c.Manifest.add(fset, pname, directory, filename, out.sources, out.doubled, out.decls, out.diags)
+	}
+
+	decls := out.decls
+	if out.qualified {
+		if srcErr != nil {
+			return nil, srcErr
+		}
+		imports.use(srcPath)
+	}
+	if importDecl := imports.decl(); importDecl != nil {
+		decls = append([]ast.Decl{importDecl}, decls...)
+	}
+
+	astFile := &ast.File{
+		Name:  ast.NewIdent(c.packageName(pname)),
+		Decls: decls,
+	}
+
+	src, err := render(astFile, constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err = c.ImportWriter.Write(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	return &generatedFile{filename: filename, src: src, skipped: len(out.diags)}, nil
+}
+
+// output collects the test doubles generated for a file
+type output struct {
+	// sources are the declarations the test doubles were generated from
+	sources []ast.Decl
+	// doubled maps generated structs to the name of their source
+	// declaration, e.g., SpyDelegatorLogger to DelegatorLogger,
+	// whatever the type they are asserted to implement
+	doubled map[string]string
+	decls   []ast.Decl
+	diags   []Diagnostic
+	// qualified reports whether the test doubles refer to
+	// the source package, which must then be imported
+	qualified bool
+}
+
+// generateDecls generates test doubles for the interfaces declared
+// within the files of the package pname, and their instantiations
+func (c *Cmd) generateDecls(fset *token.FileSet, pname, filename string, files []*ast.File, imports *importSet, instances []instance) *output {
+	out := &output{doubled: make(map[string]string)}
+	locals := make(map[string]bool)
+	for _, f := range files {
+		ds := configuredDecls(instantiatedDecls(f.Decls, instances), c.Include, c.Exclude, c.Names)
+
+		// declarations of an external test package are only visible
+		// to spies written into that same package
+		local := strings.HasSuffix(f.Name.Name, "_test")
+		if local && f.Name.Name != c.packageName(pname) {
+			out.diags = append(out.diags, unreachableDiags(ds, "declared in external test package "+f.Name.Name)...)
+			continue
+		}
+		// likewise, declarations of test files are only visible to tests
+		if isTestFile(fset, f) && !strings.HasSuffix(filename, "_test.go") {
+			out.diags = append(out.diags, unreachableDiags(ds, "declared in a test file; write spies into a _test.go file")...)
+			continue
+		}
+		external := !c.Internal && !local
+		resolveImports(ds, fileImports(f), imports)
+		if local {
+			for _, typeSpec := range doubledSpecs(ds) {
+				locals[typeSpec.Name.Name] = true
+			}
+		}
+
+		if external {
+			var skipped []Diagnostic
+			ds, skipped = externalDecls(ds)
+			out.diags = append(out.diags, skipped...)
+			if qualifyInterfaces(ds, pname) {
+				out.qualified = true
+			}
+		}
+		out.sources = append(out.sources, ds...)
+		spyDecls, generated := c.doubles(ds)
+		out.diags = append(out.diags, generated...)
+		for structName, name := range doubledNames(spyDecls) {
+			out.doubled[structName] = name
+		}
+		pkg := pname
+		if !external {
+			pkg = ""
+		}
+		if retargetAssertions(spyDecls, instanceTypes(instances, pkg)) && external {
+			out.qualified = true
+		}
+		if external && qualifyAssertions(spyDecls, pname) {
+			out.qualified = true
+		}
+		typeFuncFields(spyDecls)
+		out.decls = append(out.decls, spyDecls...)
+	}
+
+	// composites span the interfaces of all files
+	for _, composed := range c.Compose {
+		comp, diag := compose(out.sources, composed)
+		if diag != nil {
+			out.diags = append(out.diags, *diag)
+			continue
+		}
+		if comp == nil {
+			continue // declared under another build constraint, if at all
+		}
+		ds := configuredDecls([]ast.Decl{comp.decl}, nil, nil, c.Names)
+		spyDecls, generated := c.doubles(ds)
+		out.diags = append(out.diags, generated...)
+
+		pkg := pname
+		if c.Internal {
+			pkg = ""
+		}
+		spyDecls, qualified := comp.assertions(spyDecls, pkg, locals)
+		if qualified {
+			out.qualified = true
+		}
+		out.decls = append(out.decls, spyDecls...)
+	}
+	return out
+}
+
+// doubles generates test doubles for the declarations, narrowed to
+// the selected methods
+func (c *Cmd) doubles(ds []ast.Decl) ([]ast.Decl, []Diagnostic) {
+	narrowed, omitted, diags := partialDecls(ds, c.Methods)
+	decls, generated := c.Generate(narrowed)
+	return unspiedDecls(decls, omitted), append(diags, generated...)
+}
+
+// sortedPackageNames returns the names of the packages in order
+func sortedPackageNames(pkgs map[string]*ast.Package) []string {
+	var names []string
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedFiles returns the files of the package ordered by name,
+// so that spies are generated in the same order on every run
+func sortedFiles(p *ast.Package) []*ast.File {
+	var files []*ast.File
+	for _, name := range sortedFileNames(p) {
+		files = append(files, p.Files[name])
+	}
+	return files
+}
+
+// sortedFileNames returns the names of the files of the package in order
+func sortedFileNames(p *ast.Package) []string {
+	var names []string
+	for name := range p.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// packageName returns the name of the package which receives
+// the spies generated from the package pname
+func (c *Cmd) packageName(pname string) string {
+	switch {
+	case c.Internal:
+		return pname
+	case c.Package != "":
+		return c.Package
+	case strings.HasSuffix(pname, "_test"):
+		// a directory holding only an external test package
+		return pname
+	default:
+		return pname + "_test"
+	}
+}
+
+// mergePackages returns a package holding the files of the
+// package p along with those of its external test package
+func mergePackages(p, ext *ast.Package) *ast.Package {
+	merged := &ast.Package{Name: p.Name, Files: make(map[string]*ast.File)}
+	for name, f := range p.Files {
+		merged.Files[name] = f
+	}
+	for name, f := range ext.Files {
+		merged.Files[name] = f
+	}
+	return merged
+}
+
+// unreachableDiags returns a diagnostic for each interface which
+// the spies cannot refer to, giving the reason
+func unreachableDiags(ds []ast.Decl, reason string) []Diagnostic {
+	var diags []Diagnostic
+	for _, typeSpec := range doubledSpecs(ds) {
+		diags = append(diags, Diagnostic{
+			Pos:     typeSpec.Pos(),
+			Message: fmt.Sprintf("skipped %s: %s", typeSpec.Name.Name, reason),
+		})
+	}
+	return diags
+}
+
+// externalDecls removes the interfaces which cannot be implemented from
+// an external test package, with a diagnostic for each one
+func externalDecls(ds []ast.Decl) ([]ast.Decl, []Diagnostic) {
+	var kept []ast.Decl
+	var diags []Diagnostic
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			kept = append(kept, d)
+			continue
+		}
+
+		var specs []ast.Spec
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if ok {
+				if doubledType(typeSpec) && !skipped(genDecl, typeSpec) {
+					if problem := externalProblem(typeSpec); problem != "" {
+						diags = append(diags, Diagnostic{
+							Pos:     typeSpec.Pos(),
+							Message: fmt.Sprintf("skipped %s: %s; use -internal to spy on it", typeSpec.Name.Name, problem),
+						})
+						continue
+					}
+				}
+			}
+			specs = append(specs, spec)
+		}
+		if len(specs) == 0 {
+			continue
+		}
+
+		filtered := *genDecl
+		filtered.Specs = specs
+		kept = append(kept, &filtered)
+	}
+	return kept, diags
+}
+
+// report writes the diagnostics in order of their position,
+// e.g., doer.go:5:2: skipped ..., when a destination for warnings is set
+func (c *Cmd) report(fset *token.FileSet, diags []Diagnostic) {
+	if c.Warnings == nil {
+		return
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Pos < diags[j].Pos
+	})
+	for _, d := range diags {
+		fmt.Fprintf(c.Warnings, "%s: %s\n", fset.Position(d.Pos), d.Message)
+	}
+}
@@ -3,9 +3,14 @@ package fm_test
 import (
 	"errors"
 	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -93,7 +98,7 @@ func TestRunReturnsErrorWhenWriteFails(t *testing.T) {
 		Parser:        spyParser,
 		DeclGenerator: nil,
 		Writer:        spyFileWriter,
-		ImportWriter:  nil,
+		ImportWriter:  &SpyImportWriter{},
 	}
 
 	err := cmd.Run("", "sample_test.go")
@@ -106,6 +111,38 @@ func TestRunReturnsErrorWhenWriteFails(t *testing.T) {
 	}
 }
 
+// TestRunDoesNotWriteWhenImportsFail ensures nothing is written to disk
+// when the generated source cannot be completed
+func TestRunDoesNotWriteWhenImportsFail(t *testing.T) {
+	spyParser := &SpyParser{}
+	spyParser.ParseDir_Output.Ret0 = map[string]*ast.Package{
+		"bogus": &ast.Package{
+			Name:  "bogus",
+			Files: make(map[string]*ast.File),
+		},
+	}
+	spyImportWriter := &SpyImportWriter{}
+	expectedError := errors.New("goimports failed")
+	spyImportWriter.Write_Output.Ret1 = expectedError
+	spyFileWriter := &SpyWriter{}
+
+	cmd := &fm.Cmd{
+		Parser:       spyParser,
+		Writer:       spyFileWriter,
+		ImportWriter: spyImportWriter,
+	}
+
+	err := cmd.Run("", "sample_test.go")
+
+	if err != expectedError {
+		t.Errorf("want %v, got %v", expectedError, err)
+	}
+
+	if spyFileWriter.Write_Called {
+		t.Error("want no write, got a write")
+	}
+}
+
 // TestRunAddsGoSuffix ensures the output file name has ".go" appended to it
 func TestRunAddsGoSuffix(t *testing.T) {
 	spyParser := &SpyParser{}
@@ -131,13 +168,276 @@ func TestRunAddsGoSuffix(t *testing.T) {
 	}
 
 	want := "sample_test.go"
-	got := spyFileWriter.Write_Input.Arg1
+	got := spyFileWriter.Write_Input.Arg0
 
 	if want != got {
 		t.Errorf("want %v, got %v", want, got)
 	}
 }
 
+// TestRunInternalKeepsPackageName ensures spies generated in internal mode
+// belong to the package itself
+func TestRunInternalKeepsPackageName(t *testing.T) {
+	spyParser := &SpyParser{}
+	spyParser.ParseDir_Output.Ret0 = map[string]*ast.Package{
+		"bogus": &ast.Package{
+			Name:  "bogus",
+			Files: make(map[string]*ast.File),
+		},
+	}
+	spyImportWriter := &SpyImportWriter{}
+
+	cmd := &fm.Cmd{
+		Parser:       spyParser,
+		Writer:       &SpyWriter{},
+		ImportWriter: spyImportWriter,
+		Internal:     true,
+	}
+
+	err := cmd.Run("", "sample_test.go")
+	if err != nil {
+		t.Fatalf("Run failed with error %v", err)
+	}
+
+	want := "package bogus\n"
+	got := string(spyImportWriter.Write_Input.Arg1)
+
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunSkipsInterfacesUnavailableExternally ensures interfaces which
+// cannot be implemented from the external test package are not generated
+// and are reported as warnings
+func TestRunSkipsInterfacesUnavailableExternally(t *testing.T) {
+	wd, err, rmTempFile := writeTmpFile(`package sample
+
+type Public interface {
+	Do(s string) error
+}
+
+type private interface {
+	Do()
+}
+
+type Leaky interface {
+	Do(o options)
+}
+
+type options struct{}`)
+	defer rmTempFile()
+	if err != nil {
+		t.Fatalf("writeTmpFile failed with %v", err)
+	}
+
+	spyGenerator := &SpyDeclGenerator{}
+	warnings := &strings.Builder{}
+	cmd := &fm.Cmd{
+		DeclGenerator: spyGenerator,
+		Parser:        &fm.SrcFileParser{},
+		Writer:        &SpyWriter{},
+		ImportWriter:  &SpyImportWriter{},
+		Warnings:      warnings,
+	}
+
+	err = cmd.Run(wd, "sample_test.go")
+	if err != nil {
+		t.Fatalf("Run failed with error %v", err)
+	}
+
+	var names []string
+	for _, d := range spyGenerator.Generate_Input.Arg0 {
+		for _, spec := range d.(*ast.GenDecl).Specs {
+			names = append(names, spec.(*ast.TypeSpec).Name.Name)
+		}
+	}
+
+	want := "Public options"
+	got := strings.Join(names, " ")
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	filename := path.Join(wd, "sample.go")
+	wantWarnings := filename + `:7:6: skipped private: interface private is unexported; use -internal to spy on it
+` + filename + `:11:6: skipped Leaky: method Leaky.Do uses unexported type options; use -internal to spy on it
+`
+	gotWarnings := warnings.String()
+
+	if wantWarnings != gotWarnings {
+		t.Errorf("want %v, got %v", wantWarnings, gotWarnings)
+	}
+}
+
+// TestRunWritesImportablePackage ensures spies written to a regular
+// package import and qualify the types of the original package
+func TestRunWritesImportablePackage(t *testing.T) {
+	wd, err, rmTempFile := writeTmpFile(`package sample
+
+type Task struct{}
+
+type Doer interface {
+	Do(t Task) error
+}`)
+	defer rmTempFile()
+	if err != nil {
+		t.Fatalf("writeTmpFile failed with %v", err)
+	}
+	err = ioutil.WriteFile(path.Join(wd, "go.mod"), []byte("module example.com/sample\n"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile failed with %v", err)
+	}
+	defer os.RemoveAll(wd)
+
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{},
+		Writer:        &fm.FileWriter{},
+		ImportWriter:  &fm.GoImportsWriter{},
+		Package:       "fakes",
+		OutputDir:     path.Join(wd, "internal", "fakes"),
+	}
+	err = cmd.Run(wd, "fm.go")
+	if err != nil {
+		t.Fatalf("Run failed with error %v", err)
+	}
+
+	bytes, err := ioutil.ReadFile(path.Join(wd, "internal", "fakes", "fm.go"))
+	if err != nil {
+		t.Fatalf("ReadFile failed with %v", err)
+	}
+	src := string(bytes)
+
+	for _, want := range []string{
+		"package fakes",
+		`"example.com/sample"`,
+		"Arg0 sample.Task",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("want %v in %v", want, src)
+		}
+	}
+}
+
+// TestRunRejectsTestFileForPackage ensures spies meant to be imported
+// are not written to a test file
+func TestRunRejectsTestFileForPackage(t *testing.T) {
+	cmd := &fm.Cmd{Package: "fakes"}
+
+	err := cmd.Run("", "fm_test.go")
+
+	if err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+// TestRunStrictFailsOnSkippedDeclarations ensures nothing is written
+// in strict mode when a declaration is skipped
+func TestRunStrictFailsOnSkippedDeclarations(t *testing.T) {
+	wd, err, rmTempFile := writeTmpFile(`package sample
+
+import "io"
+
+type ReadDoer interface {
+	io.Reader
+	Do() error
+}`)
+	defer rmTempFile()
+	if err != nil {
+		t.Fatalf("writeTmpFile failed with %v", err)
+	}
+
+	spyFileWriter := &SpyWriter{}
+	warnings := &strings.Builder{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{},
+		Writer:        spyFileWriter,
+		ImportWriter:  &SpyImportWriter{},
+		Strict:        true,
+		Warnings:      warnings,
+	}
+
+	err = cmd.Run(wd, "sample_test.go")
+
+	if err == nil {
+		t.Error("want error, got nil")
+	}
+
+	if spyFileWriter.Write_Called {
+		t.Error("want no write, got a write")
+	}
+
+	want := path.Join(wd, "sample.go") + ":6:2: skipped interface ReadDoer: embedded interface io.Reader is not supported\n"
+	got := warnings.String()
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunRecordsManifest ensures each generated test double is recorded
+// along with its interface and anything skipped
+func TestRunRecordsManifest(t *testing.T) {
+	wd, err, rmTempFile := writeTmpFile(`package sample
+
+type Doer interface {
+	Do() error
+}
+
+type private interface {
+	do()
+}`)
+	defer rmTempFile()
+	if err != nil {
+		t.Fatalf("writeTmpFile failed with %v", err)
+	}
+
+	err = ioutil.WriteFile(path.Join(wd, "go.mod"), []byte("module example.com/sample\n"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile failed with %v", err)
+	}
+	defer os.RemoveAll(wd)
+
+	manifest := &fm.Manifest{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{},
+		Writer:        &SpyWriter{},
+		ImportWriter:  &SpyImportWriter{},
+		Manifest:      manifest,
+	}
+
+	err = cmd.Run(wd, "sample_test.go")
+	if err != nil {
+		t.Fatalf("Run failed with error %v", err)
+	}
+
+	if len(manifest.Packages) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(manifest.Packages))
+	}
+	pkg := manifest.Packages[0]
+
+	want := fm.ManifestPackage{
+		Name:   "sample",
+		Dir:    wd,
+		Output: path.Join(wd, "sample_test.go"),
+		Interfaces: []fm.ManifestInterface{
+			{Name: "Doer", Position: path.Join(wd, "sample.go") + ":3:6", Generated: "SpyDoer"},
+		},
+		Skipped: []fm.ManifestSkipped{{
+			Position: path.Join(wd, "sample.go") + ":7:6",
+			Reason:   "skipped private: interface private is unexported; use -internal to spy on it",
+		}},
+	}
+
+	if !reflect.DeepEqual(want, pkg) {
+		t.Errorf("want %+v, got %+v", want, pkg)
+	}
+}
+
 func writeTmpFile(code string) (string, error, func()) {
 	dir, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -167,3 +467,129 @@ func buildGen() fm.DeclGenerator {
 		Implementer: &fm.SpyFuncImplementer{},
 	}
 }
+
+// runChecked runs the command on the module within dir, with the
+// generated source type-checked before it is written to filename,
+// and returns the file as written
+func runChecked(t *testing.T, cmd *fm.Cmd, dir, filename string) *ast.File {
+	t.Helper()
+
+	if cmd.Parser == nil {
+		cmd.Parser = &fm.SrcFileParser{}
+	}
+	cmd.Writer = &fm.FileWriter{}
+	cmd.ImportWriter = &fm.GoImportsWriter{}
+	cmd.Checker = &fm.TypeChecker{Parser: cmd.Parser}
+
+	err := cmd.Run(dir, filename)
+	if err != nil {
+		t.Fatalf("Run failed with error %v", err)
+	}
+	return parseGenerated(t, filepath.Join(dir, filename))
+}
+
+// writeTree writes the files, keyed by their slash-separated path,
+// into a new temporary directory
+func writeTree(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("TempDir failed with %v", err)
+	}
+	rmDir := func() { _ = os.RemoveAll(dir) }
+
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(filename), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filename, []byte(content), 0644)
+		}
+		if err != nil {
+			rmDir()
+			t.Fatalf("writing %s failed with %v", name, err)
+		}
+	}
+	return dir, rmDir
+}
+
+// writeModule writes the files into a new temporary directory,
+// along with the go.mod of the module example.com/sample
+func writeModule(t *testing.T, files map[string]string) (string, func()) {
+	tree := map[string]string{"go.mod": "module example.com/sample\n"}
+	for name, content := range files {
+		tree[name] = content
+	}
+	return writeTree(t, tree)
+}
+
+// parseGenerated parses the generated file
+func parseGenerated(t *testing.T, filename string) *ast.File {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("ParseFile failed with %v", err)
+	}
+	return f
+}
+
+// declaredTypes returns the types declared by the file, by name
+func declaredTypes(f *ast.File) map[string]ast.Expr {
+	typs := make(map[string]ast.Expr)
+	for _, d := range f.Decls {
+		if genDecl, ok := d.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				typs[typeSpec.Name.Name] = typeSpec.Type
+			}
+		}
+	}
+	return typs
+}
+
+// declaredMethods returns the methods declared by the file, named by
+// their receiver's type and their own name, e.g., SpyDoer.Do
+func declaredMethods(f *ast.File) map[string]*ast.FuncDecl {
+	methods := make(map[string]*ast.FuncDecl)
+	for _, d := range f.Decls {
+		funcDecl, ok := d.(*ast.FuncDecl)
+		if !ok || funcDecl.Recv == nil {
+			continue
+		}
+		recv := funcDecl.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		methods[types.ExprString(recv)+"."+funcDecl.Name.Name] = funcDecl
+	}
+	return methods
+}
+
+// assertedTypes returns the types which the compile-time assertions of
+// the file assert each generated type to implement, e.g., sample.Doer
+// for SpyDoer
+func assertedTypes(f *ast.File) map[string][]string {
+	asserted := make(map[string][]string)
+	for _, d := range f.Decls {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			if len(valueSpec.Values) != 1 || valueSpec.Type == nil {
+				continue
+			}
+			// (*SpyDoer)(nil), or (*SpyClock)(nil).Clock for a func type
+			value := valueSpec.Values[0]
+			if sel, ok := value.(*ast.SelectorExpr); ok {
+				value = sel.X
+			}
+			call, ok := value.(*ast.CallExpr)
+			if !ok {
+				continue
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(types.ExprString(call.Fun), "(*"), ")")
+			asserted[name] = append(asserted[name], types.ExprString(valueSpec.Type))
+		}
+	}
+	return asserted
+}
@@ -0,0 +1,181 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// composite is an interface holding the methods of several interfaces
+// or func types, its members, such that a single test double with a
+// single call log implements all of them
+type composite struct {
+	decl    *ast.GenDecl
+	name    string
+	members []*ast.TypeSpec
+}
+
+// compositeMembers returns the names of the members of a composite
+// written as Doer+Repeater
+func compositeMembers(composed string) []string {
+	var names []string
+	for _, name := range strings.Split(composed, "+") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// compose declares the composite of the named members, e.g., DoerRepeater
+// for Doer+Repeater, when they are declared among ds. It returns nil when
+// none of them are, and a diagnostic when only some of them are or when
+// members declare a method of the same name with different signatures
+func compose(ds []ast.Decl, composed string) (*composite, *Diagnostic) {
+	names := compositeMembers(composed)
+	specs := make(map[string]*ast.TypeSpec)
+	for _, spec := range doubledSpecs(ds) {
+		specs[spec.Name.Name] = spec
+	}
+
+	c := &composite{name: strings.Join(names, "")}
+	var missing []string
+	for _, name := range names {
+		if spec, ok := specs[name]; ok {
+			c.members = append(c.members, spec)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(c.members) == 0 {
+		return nil, nil
+	}
+	first := c.members[0]
+	if len(missing) > 0 {
+		return nil, c.skip(first.Pos(), "%s not declared alongside %s", strings.Join(missing, ", "), first.Name.Name)
+	}
+
+	var methods []*ast.Field
+	declaredBy := make(map[string]*ast.TypeSpec)
+	signatures := make(map[string]string)
+	for _, member := range c.members {
+		if len(typeParams(member)) > 0 {
+			return nil, c.skip(member.Pos(), "generic %s %s cannot be composed", typeKind(member), member.Name.Name)
+		}
+		for _, field := range methodsOf(member) {
+			if len(field.Names) == 0 {
+				methods = append(methods, field) // reported as unsupported
+				continue
+			}
+			method := field.Names[0].Name
+			signature := signatureString(field.Type)
+			if other, ok := declaredBy[method]; ok {
+				if signatures[method] != signature {
+					return nil, c.skip(member.Pos(), "method %s of %s conflicts with %s.%s", method, member.Name.Name, other.Name.Name, method)
+				}
+				continue // the same method, implemented once
+			}
+			declaredBy[method] = member
+			signatures[method] = signature
+			methods = append(methods, field)
+		}
+	}
+
+	c.decl = &ast.GenDecl{
+		Tok: token.TYPE,
+		Specs: []ast.Spec{&ast.TypeSpec{
+			Name: &ast.Ident{Name: c.name, NamePos: first.Name.Pos()},
+			Type: &ast.InterfaceType{Methods: &ast.FieldList{List: methods}},
+		}},
+	}
+	return c, nil
+}
+
+// skip returns a diagnostic for the composite, giving the reason
+func (c *composite) skip(pos token.Pos, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Pos:     pos,
+		Message: fmt.Sprintf("skipped composite %s: %s", c.name, fmt.Sprintf(format, args...)),
+	}
+}
+
+// signatureString returns the signature of a method without the names of
+// its parameters and results, which may differ between the members
+func signatureString(e ast.Expr) string {
+	funcType, ok := e.(*ast.FuncType)
+	if !ok {
+		return types.ExprString(e)
+	}
+	return "func(" + fieldTypesString(funcType.Params) + ") (" + fieldTypesString(funcType.Results) + ")"
+}
+
+// fieldTypesString returns the types of the fields, one per name
+func fieldTypesString(fl *ast.FieldList) string {
+	var list []string
+	for _, t := range fieldTypes(fl) {
+		list = append(list, types.ExprString(t))
+	}
+	return strings.Join(list, ", ")
+}
+
+// assertions replaces the compile-time assertion that a generated type
+// implements the composite with one for each of its members, qualified
+// with pkg unless it is empty or the member is local
+func (c *composite) assertions(ds []ast.Decl, pkg string, local map[string]bool) ([]ast.Decl, bool) {
+	var decls []ast.Decl
+	var qualified bool
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR || len(genDecl.Specs) != 1 {
+			decls = append(decls, d)
+			continue
+		}
+		valueSpec, ok := genDecl.Specs[0].(*ast.ValueSpec)
+		if !ok || len(valueSpec.Values) != 1 || types.ExprString(valueSpec.Type) != c.name {
+			decls = append(decls, d)
+			continue
+		}
+
+		structName := assertedStruct(valueSpec.Values[0])
+		for _, member := range c.members {
+			found := foundInterface{spec: member}
+			_, found.fn = member.Type.(*ast.FuncType)
+			assertion := found.assertion(structName)
+			if pkg != "" && !local[member.Name.Name] && qualifyAssertions([]ast.Decl{assertion}, pkg) {
+				qualified = true
+			}
+			decls = append(decls, assertion)
+		}
+	}
+	return decls, qualified
+}
+
+// checkComposites returns an error for any composite with fewer than two
+// members or with a member which the package does not declare, such as
+// one qualified by another package, e.g., io.WriterTo
+func checkComposites(p *ast.Package, composites []string) error {
+	declared := make(map[string]bool)
+	for _, f := range p.Files {
+		for _, spec := range doubledSpecs(f.Decls) {
+			declared[spec.Name.Name] = true
+		}
+	}
+
+	for _, composed := range composites {
+		names := compositeMembers(composed)
+		if len(names) < 2 {
+			return fmt.Errorf("composite %s needs at least two interfaces, e.g., Doer+Repeater", composed)
+		}
+		for _, name := range names {
+			if strings.Contains(name, ".") {
+				return fmt.Errorf("cannot compose %s; only interfaces declared by package %s may be composed", name, p.Name)
+			}
+			if !declared[name] {
+				return fmt.Errorf("no interface %s in package %s to compose %s", name, p.Name, strings.Join(names, ""))
+			}
+		}
+	}
+	return nil
+}
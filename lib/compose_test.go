@@ -0,0 +1,161 @@
+package fm_test
+
+import (
+	"go/ast"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestRunComposesInterfaces ensures a composite spy implements each of
+// its members, declared in separate files, with a method they share
+// implemented once and recorded in a single call log
+func TestRunComposesInterfaces(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"doer.go": `package sample
+
+type Doer interface {
+	Do(task string) error
+	Close() error
+}
+`,
+		"repeater.go": `package sample
+
+type Repeater interface {
+	Repeat(task string) error
+	Close() error
+}
+`,
+	})
+	defer rmDir()
+
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Compose:       []string{"Doer+Repeater"},
+	}
+	// a method implemented twice would not compile
+	f := runChecked(t, cmd, dir, "fm_test.go")
+
+	want := []string{"sample.Doer", "sample.Repeater"}
+	got := assertedTypes(f)["SpyDoerRepeater"]
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	st, ok := declaredTypes(f)["SpyDoerRepeater"].(*ast.StructType)
+	if !ok {
+		t.Fatalf("want struct SpyDoerRepeater, got %v", declaredTypes(f))
+	}
+	var logs int
+	for _, field := range st.Fields.List {
+		if field.Names[0].Name == "CallLog" {
+			logs++
+		}
+	}
+	if logs != 1 {
+		t.Errorf("want a single CallLog, got %d", logs)
+	}
+}
+
+// TestRunSkipsConflictingComposite ensures members which declare
+// different methods of the same name are not composed
+func TestRunSkipsConflictingComposite(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type Doer interface {
+	Do(task string) error
+}
+
+type Runner interface {
+	Do(task string, n int) error
+}
+`,
+	})
+	defer rmDir()
+
+	warnings := &strings.Builder{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Warnings:      warnings,
+		Compose:       []string{"Doer+Runner"},
+	}
+	f := runChecked(t, cmd, dir, "fm_test.go")
+
+	if _, ok := declaredTypes(f)["SpyDoerRunner"]; ok {
+		t.Error("want no SpyDoerRunner")
+	}
+
+	want := filepath.Join(dir, "sample.go") + ":7:6: skipped composite DoerRunner: method Do of Runner conflicts with Doer.Do\n"
+	got := warnings.String()
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunRejectsUnknownCompositeMember ensures a misspelt member fails
+// the run before anything is generated
+func TestRunRejectsUnknownCompositeMember(t *testing.T) {
+	dir, rmDir := writeTree(t, map[string]string{
+		"sample.go": "package sample\n\ntype Doer interface {\n\tDo()\n}\n",
+	})
+	defer rmDir()
+
+	spyWriter := &SpyWriter{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{},
+		Writer:        spyWriter,
+		ImportWriter:  &SpyImportWriter{},
+		Compose:       []string{"Doer+Reapeter"},
+	}
+
+	err := cmd.Run(dir, "fm_test.go")
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := "no interface Reapeter in package sample to compose DoerReapeter"
+	got := err.Error()
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if spyWriter.Write_Called {
+		t.Error("want nothing written")
+	}
+}
+
+// TestRunRejectsQualifiedCompositeMember ensures a member of another
+// package is reported as such rather than as missing
+func TestRunRejectsQualifiedCompositeMember(t *testing.T) {
+	dir, rmDir := writeTree(t, map[string]string{
+		"sample.go": "package sample\n\ntype Doer interface {\n\tDo()\n}\n",
+	})
+	defer rmDir()
+
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{},
+		Writer:        &SpyWriter{},
+		ImportWriter:  &SpyImportWriter{},
+		Compose:       []string{"Doer+io.WriterTo"},
+	}
+
+	err := cmd.Run(dir, "fm_test.go")
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := "cannot compose io.WriterTo; only interfaces declared by package sample may be composed"
+	got := err.Error()
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,316 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+const configFilename = "fm.toml"
+
+// Config holds generation settings read from fm.toml files.
+// Each setting mirrors the command line flag of the same name
+type Config struct {
+	Kind     string
+	Out      string
+	Internal bool
+	Package  string
+	OutDir   string
+	Strict   bool
+	// Tags are the build tags which, along with GOOS and GOARCH,
+	// decide which files are parsed
+	Tags        []string
+	Constraints bool
+	// Tests includes test files, and IncludeFiles and ExcludeFiles
+	// select files by name, e.g., *.pb.go
+	Tests        bool
+	IncludeFiles []string
+	ExcludeFiles []string
+	// Include and Exclude select interfaces by name with patterns
+	// such as Store*, as understood by path.Match
+	Include []string
+	Exclude []string
+	// Compose lists composites of interfaces, e.g., Doer+Repeater
+	Compose []string
+	// Methods selects the methods to spy on with patterns, e.g., Get*
+	Methods []string
+	// Iface lists instantiations of generic interfaces, e.g., Repo[User]
+	Iface []string
+	// Names maps interfaces to the names of their generated types
+	Names map[string]string
+	// Files lists the configuration files which were read, in order
+	Files []string
+}
+
+// LoadConfig reads the fm.toml files from the root of the enclosing module
+// down to dir, so that settings closer to dir take precedence. Settings
+// within a [packages."path"] table only apply when dir is that path,
+// relative to the file which holds it
+func LoadConfig(dir string) (*Config, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{Names: make(map[string]string)}
+	for _, d := range configDirs(abs) {
+		filename := filepath.Join(d, configFilename)
+		f, err := os.Open(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(d, abs)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		err = cfg.read(f, filename, filepath.ToSlash(rel))
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Files = append(cfg.Files, filename)
+	}
+	return cfg, nil
+}
+
+// configDirs returns the directories which may hold configuration for dir,
+// from the root of its module, or repository, down to dir itself
+func configDirs(dir string) []string {
+	dirs := []string{dir}
+	for d := dir; ; {
+		if isRoot(d) {
+			return dirs
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			// outside of any module, only dir itself is configured
+			return []string{dir}
+		}
+		d = parent
+		dirs = append([]string{d}, dirs...)
+	}
+}
+
+// isRoot reports whether the directory is the root of a module or repository
+func isRoot(dir string) bool {
+	for _, name := range []string{"go.mod", ".git"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// read applies the settings of a configuration file, where rel is the
+// configured directory relative to the file
+func (c *Config) read(r io.Reader, filename, rel string) error {
+	entries, err := parseTOML(r)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	for _, e := range entries {
+		table := e.table
+		if len(table) >= 2 && table[0] == "packages" {
+			if path.Clean(table[1]) != rel {
+				continue
+			}
+			table = table[2:]
+		}
+
+		switch {
+		case len(table) == 0:
+			err = c.set(e)
+		case len(table) == 1 && table[0] == "names":
+			name, ok := e.value.(string)
+			if !ok {
+				err = fmt.Errorf("name of %s must be a string", e.key)
+			}
+			c.Names[e.key] = name
+		default:
+			err = fmt.Errorf("unknown table %s", table)
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", filename, e.line, err)
+		}
+	}
+	return nil
+}
+
+// set applies a single setting
+func (c *Config) set(e tomlEntry) error {
+	var ok bool
+	switch e.key {
+	case "kind":
+		c.Kind, ok = e.value.(string)
+	case "out":
+		c.Out, ok = e.value.(string)
+	case "pkg":
+		c.Package, ok = e.value.(string)
+	case "outdir":
+		c.OutDir, ok = e.value.(string)
+	case "internal":
+		c.Internal, ok = e.value.(bool)
+	case "strict":
+		c.Strict, ok = e.value.(bool)
+	case "tags":
+		c.Tags, ok = e.value.([]string)
+	case "constraints":
+		c.Constraints, ok = e.value.(bool)
+	case "tests":
+		c.Tests, ok = e.value.(bool)
+	case "include_files":
+		c.IncludeFiles, ok = e.value.([]string)
+	case "exclude_files":
+		c.ExcludeFiles, ok = e.value.([]string)
+	case "include":
+		c.Include, ok = e.value.([]string)
+	case "exclude":
+		c.Exclude, ok = e.value.([]string)
+	case "compose":
+		c.Compose, ok = e.value.([]string)
+	case "methods":
+		c.Methods, ok = e.value.([]string)
+	case "iface":
+		c.Iface, ok = e.value.([]string)
+	default:
+		return fmt.Errorf("unknown setting %s", e.key)
+	}
+	if !ok {
+		return fmt.Errorf("unexpected value for %s: %v", e.key, e.value)
+	}
+	return nil
+}
+
+// WriteTo writes the settings in the format of a configuration file
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	write := func(format string, args ...interface{}) {
+		written, _ := fmt.Fprintf(w, format, args...)
+		n += int64(written)
+	}
+
+	write("kind = %s\n", strconv.Quote(c.Kind))
+	write("out = %s\n", strconv.Quote(c.Out))
+	write("internal = %t\n", c.Internal)
+	write("pkg = %s\n", strconv.Quote(c.Package))
+	write("outdir = %s\n", strconv.Quote(c.OutDir))
+	write("strict = %t\n", c.Strict)
+	write("tags = %s\n", quoteList(c.Tags))
+	write("constraints = %t\n", c.Constraints)
+	write("tests = %t\n", c.Tests)
+	write("include_files = %s\n", quoteList(c.IncludeFiles))
+	write("exclude_files = %s\n", quoteList(c.ExcludeFiles))
+	write("include = %s\n", quoteList(c.Include))
+	write("exclude = %s\n", quoteList(c.Exclude))
+	write("compose = %s\n", quoteList(c.Compose))
+	write("methods = %s\n", quoteList(c.Methods))
+	write("iface = %s\n", quoteList(c.Iface))
+
+	if len(c.Names) > 0 {
+		write("\n[names]\n")
+		var keys []string
+		for k := range c.Names {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			write("%s = %s\n", k, strconv.Quote(c.Names[k]))
+		}
+	}
+	return n, nil
+}
+
+// quoteList formats a list of strings as an array
+func quoteList(list []string) string {
+	s := "["
+	for i, item := range list {
+		if i > 0 {
+			s += ", "
+		}
+		s += strconv.Quote(item)
+	}
+	return s + "]"
+}
+
+// selected reports whether the interface is selected by the
+// include and exclude patterns
+func selected(name string, include, exclude []string) bool {
+	if len(include) > 0 && !matchAny(include, name) {
+		return false
+	}
+	return !matchAny(exclude, name)
+}
+
+// matchAny reports whether the name matches any of the patterns
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredDecls removes the interfaces which are not selected by the
+// include and exclude patterns and adds an //fm:name directive to those
+// with a configured name, unless the source already names them
+func configuredDecls(ds []ast.Decl, include, exclude []string, names map[string]string) []ast.Decl {
+	if len(include) == 0 && len(exclude) == 0 && len(names) == 0 {
+		return ds
+	}
+
+	var kept []ast.Decl
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok {
+			kept = append(kept, d)
+			continue
+		}
+
+		var specs []ast.Spec
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				specs = append(specs, spec)
+				continue
+			}
+			if !doubledType(typeSpec) {
+				specs = append(specs, spec)
+				continue
+			}
+			if !selected(typeSpec.Name.Name, include, exclude) {
+				continue
+			}
+
+			name, ok := names[typeSpec.Name.Name]
+			dirs, _ := parseDirectives(genDecl.Doc, typeSpec.Doc)
+			if ok && dirs.name == "" {
+				named := *typeSpec
+				named.Doc = &ast.CommentGroup{List: []*ast.Comment{{Text: directivePrefix + "name " + name}}}
+				if typeSpec.Doc != nil {
+					named.Doc.List = append(append([]*ast.Comment{}, typeSpec.Doc.List...), named.Doc.List...)
+				}
+				spec = &named
+			}
+			specs = append(specs, spec)
+		}
+		if len(specs) == 0 {
+			continue
+		}
+
+		filtered := *genDecl
+		filtered.Specs = specs
+		kept = append(kept, &filtered)
+	}
+	return kept
+}
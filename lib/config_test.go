@@ -0,0 +1,175 @@
+package fm_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestLoadConfigAppliesFilesFromModuleRoot ensures settings are read from
+// the module root down to the directory, with package tables applying only
+// to their own directory
+func TestLoadConfigAppliesFilesFromModuleRoot(t *testing.T) {
+	root, rmDir := writeModule(t, map[string]string{
+		"fm.toml": `# settings for every package
+kind = "mock"
+exclude = ["Legacy*"]
+
+[packages."store"]
+kind = "stub" # stubs suit the store best
+
+[packages."store".names]
+Store = "FakeStore"
+
+[packages."other"]
+kind = "dummy"
+`,
+		"store/fm.toml": `out = "fakes_test.go"`,
+	})
+	defer rmDir()
+
+	cfg, err := fm.LoadConfig(filepath.Join(root, "store"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed with %v", err)
+	}
+
+	if cfg.Kind != "stub" {
+		t.Errorf("want %v, got %v", "stub", cfg.Kind)
+	}
+	if cfg.Out != "fakes_test.go" {
+		t.Errorf("want %v, got %v", "fakes_test.go", cfg.Out)
+	}
+	if want := []string{"Legacy*"}; !reflect.DeepEqual(want, cfg.Exclude) {
+		t.Errorf("want %v, got %v", want, cfg.Exclude)
+	}
+	if want := map[string]string{"Store": "FakeStore"}; !reflect.DeepEqual(want, cfg.Names) {
+		t.Errorf("want %v, got %v", want, cfg.Names)
+	}
+	if len(cfg.Files) != 2 {
+		t.Errorf("want %v, got %v", 2, len(cfg.Files))
+	}
+}
+
+// TestLoadConfigRejectsUnknownSettings ensures a misspelled setting is
+// reported with its position rather than silently ignored
+func TestLoadConfigRejectsUnknownSettings(t *testing.T) {
+	root, rmDir := writeModule(t, map[string]string{
+		"fm.toml": "kind = \"spy\"\nkinds = \"mock\"\n",
+	})
+	defer rmDir()
+
+	_, err := fm.LoadConfig(root)
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := "fm.toml:2: unknown setting kinds"
+	got := err.Error()
+
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("want suffix %v, got %v", want, got)
+	}
+}
+
+// TestLoadConfigKeepsCommasWithinStrings ensures array items are only
+// split on the commas between them, e.g., not within the type arguments
+// of an instantiation
+func TestLoadConfigKeepsCommasWithinStrings(t *testing.T) {
+	root, rmDir := writeModule(t, map[string]string{
+		"fm.toml": `iface = ["Pair[string, *t1.Task]", 'Cache[K, V]', "Repo[User]",]
+exclude = ["a\",b", "c"] # "d, e"
+`,
+	})
+	defer rmDir()
+
+	cfg, err := fm.LoadConfig(root)
+	if err != nil {
+		t.Fatalf("LoadConfig failed with %v", err)
+	}
+
+	if want := []string{"Pair[string, *t1.Task]", "Cache[K, V]", "Repo[User]"}; !reflect.DeepEqual(want, cfg.Iface) {
+		t.Errorf("want %v, got %v", want, cfg.Iface)
+	}
+	if want := []string{"a\",b", "c"}; !reflect.DeepEqual(want, cfg.Exclude) {
+		t.Errorf("want %v, got %v", want, cfg.Exclude)
+	}
+}
+
+// TestConfigWriteTo ensures the effective settings are printed in the
+// format of a configuration file
+func TestConfigWriteTo(t *testing.T) {
+	cfg := &fm.Config{
+		Kind:    "spy",
+		Out:     "fm_test.go",
+		Include: []string{"Doer", "Store*"},
+		Names:   map[string]string{"Doer": "FakeDoer"},
+	}
+
+	var b strings.Builder
+	_, err := cfg.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo failed with %v", err)
+	}
+
+	for _, want := range []string{
+		`kind = "spy"`,
+		`include = ["Doer", "Store*"]`,
+		`exclude = []`,
+		"[names]\nDoer = \"FakeDoer\"",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("want %v in %v", want, b.String())
+		}
+	}
+}
+
+// TestRunAppliesConfiguredSelectionAndNames ensures excluded interfaces
+// are not generated and configured names replace the default ones
+func TestRunAppliesConfiguredSelectionAndNames(t *testing.T) {
+	wd, err, rmTempFile := writeTmpFile(`package sample
+
+type Doer interface {
+	Do() error
+}
+
+type Store interface {
+	Get(key string) string
+}
+
+type LegacyCache interface {
+	Fetch() string
+}`)
+	defer rmTempFile()
+	if err != nil {
+		t.Fatalf("writeTmpFile failed with %v", err)
+	}
+
+	spyImportWriter := &SpyImportWriter{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{},
+		Writer:        &SpyWriter{},
+		ImportWriter:  spyImportWriter,
+		Internal:      true,
+		Exclude:       []string{"Legacy*"},
+		Names:         map[string]string{"Store": "FakeStore"},
+	}
+
+	err = cmd.Run(wd, "sample_test.go")
+	if err != nil {
+		t.Fatalf("Run failed with error %v", err)
+	}
+
+	got := string(spyImportWriter.Write_Input.Arg1)
+	for _, want := range []string{"type SpyDoer struct", "type FakeStore struct"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %v in %v", want, got)
+		}
+	}
+	if strings.Contains(got, "LegacyCache") {
+		t.Errorf("want LegacyCache excluded, got %v", got)
+	}
+}
@@ -0,0 +1,125 @@
+package fm
+
+import (
+	"go/ast"
+	"go/build"
+	"go/build/constraint"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// unknownPort is a GOOS and GOARCH which no file name implies, so that
+// a name only matches it when it does not constrain the file
+const unknownPort = "fm"
+
+// fileConstraint returns the build constraint of the file, combining that
+// implied by its name with its //go:build line, or its // +build lines in
+// older files. It returns an empty string for an unconstrained file
+func fileConstraint(filename string, f *ast.File) string {
+	var exprs []constraint.Expr
+	exprs = append(exprs, nameConstraint(filename)...)
+
+	var goBuild constraint.Expr
+	var plusBuild []constraint.Expr
+	for _, group := range f.Comments {
+		if group.Pos() >= f.Package {
+			break
+		}
+		for _, comment := range group.List {
+			switch {
+			case constraint.IsGoBuild(comment.Text):
+				if expr, err := constraint.Parse(comment.Text); err == nil {
+					goBuild = expr
+				}
+			case constraint.IsPlusBuild(comment.Text):
+				if expr, err := constraint.Parse(comment.Text); err == nil {
+					plusBuild = append(plusBuild, expr)
+				}
+			}
+		}
+	}
+	if goBuild != nil {
+		exprs = append(exprs, goBuild)
+	} else {
+		exprs = append(exprs, plusBuild...)
+	}
+
+	if len(exprs) == 0 {
+		return ""
+	}
+	expr := exprs[0]
+	for _, x := range exprs[1:] {
+		expr = &constraint.AndExpr{X: expr, Y: x}
+	}
+	return expr.String()
+}
+
+// nameConstraint returns the constraints implied by the name of the file,
+// e.g., linux and amd64 for doer_linux_amd64.go, as go/build decides them
+func nameConstraint(filename string) []constraint.Expr {
+	base := filepath.Base(filename)
+	if nameMatches(base, unknownPort, unknownPort) {
+		return nil
+	}
+
+	// the first element never constrains the file, e.g., linux.go
+	name := strings.TrimSuffix(strings.TrimSuffix(base, ".go"), "_test")
+	l := strings.Split(name, "_")
+	n := len(l)
+	if n >= 3 && !nameMatches(base, l[n-2], unknownPort) && !nameMatches(base, unknownPort, l[n-1]) {
+		return []constraint.Expr{&constraint.TagExpr{Tag: l[n-2]}, &constraint.TagExpr{Tag: l[n-1]}}
+	}
+	return []constraint.Expr{&constraint.TagExpr{Tag: l[n-1]}}
+}
+
+// nameMatches reports whether go/build would build a file of the name,
+// disregarding its contents, for the GOOS and GOARCH
+func nameMatches(name, goos, goarch string) bool {
+	ctx := build.Context{
+		GOOS:     goos,
+		GOARCH:   goarch,
+		Compiler: "gc",
+		OpenFile: func(string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("package p\n")), nil
+		},
+	}
+	match, err := ctx.MatchFile("", name)
+	return err == nil && match
+}
+
+// constrainedFilename returns the name of the file which receives the
+// spies generated under the constraint, e.g., fm_linux_and_amd64_build_test.go
+// for fm_test.go and linux && amd64. The trailing _build keeps the name
+// itself from implying any constraint
+func constrainedFilename(filename, expr string) string {
+	r := strings.NewReplacer("&&", " and ", "||", " or ", "!", " not ", "(", " ", ")", " ")
+	suffix := strings.Join(strings.Fields(r.Replace(expr)), "_")
+
+	ext := ".go"
+	if strings.HasSuffix(filename, "_test.go") {
+		ext = "_test.go"
+	}
+	return strings.TrimSuffix(filename, ext) + "_" + suffix + "_build" + ext
+}
+
+// constraintGroups partitions the files of the package by their build
+// constraint, in order of name, with the unconstrained files first
+func constraintGroups(p *ast.Package) ([]string, [][]*ast.File) {
+	constraints := []string{""}
+	groups := [][]*ast.File{nil}
+	index := map[string]int{"": 0}
+	for _, name := range sortedFileNames(p) {
+		c := fileConstraint(name, p.Files[name])
+		i, ok := index[c]
+		if !ok {
+			i = len(groups)
+			index[c] = i
+			constraints = append(constraints, c)
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], p.Files[name])
+	}
+	return constraints, groups
+}
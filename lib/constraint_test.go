@@ -0,0 +1,222 @@
+package fm_test
+
+import (
+	"go/ast"
+	"go/build"
+	"go/build/constraint"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestSrcFileParserHonorsBuildContext ensures only the files built
+// for the GOOS, GOARCH, and tags of the context are parsed
+func TestSrcFileParserHonorsBuildContext(t *testing.T) {
+	dir, rmDir := writeTree(t, map[string]string{
+		"doer_linux.go":   "package sample\n",
+		"doer_windows.go": "package sample\n",
+		"tagged.go":       "//go:build integration\n\npackage sample\n",
+		"untagged.go":     "//go:build !integration\n\npackage sample\n",
+	})
+	defer rmDir()
+
+	ctx := linuxContext()
+	parser := &fm.SrcFileParser{Context: &ctx}
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir)
+	if err != nil {
+		t.Fatalf("ParseDir failed with %v", err)
+	}
+
+	var got []string
+	for name := range pkgs["sample"].Files {
+		got = append(got, filepath.Base(name))
+	}
+	sort.Strings(got)
+
+	want := "doer_linux.go tagged.go"
+	if strings.Join(got, " ") != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunWritesSpiesPerConstraint ensures spies carry the build constraint
+// of their source file, with a file of their own for each constraint
+func TestRunWritesSpiesPerConstraint(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"doer.go":        "package sample\n\ntype Doer interface {\n\tDo() error\n}\n",
+		"store_linux.go": "package sample\n\ntype Store interface {\n\tGet() string\n}\n",
+		"cache.go": "//go:build integration && !race\n\npackage sample\n\n" +
+			"type Cache interface {\n\tFetch() string\n}\n",
+	})
+	defer rmDir()
+
+	ctx := linuxContext()
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{Context: &ctx},
+		Internal:      true,
+		Constraints:   true,
+	}
+	runChecked(t, cmd, dir, "fm_test.go")
+
+	for filename, want := range map[string]struct{ constraint, spy string }{
+		"fm_test.go":             {"", "SpyDoer"},
+		"fm_linux_build_test.go": {"linux", "SpyStore"},
+		"fm_integration_and_not_race_build_test.go": {"integration && !race", "SpyCache"},
+	} {
+		f := parseGenerated(t, filepath.Join(dir, filename))
+		if got := buildConstraint(f); want.constraint != got {
+			t.Errorf("want constraint %q for %s, got %q", want.constraint, filename, got)
+		}
+		if _, ok := declaredTypes(f)[want.spy]; !ok {
+			t.Errorf("want %s in %s, got %v", want.spy, filename, declaredTypes(f))
+		}
+	}
+}
+
+// TestRunDerivesConstraintsFromFileNames ensures file names constrain
+// spies just as they constrain their source files for go/build
+func TestRunDerivesConstraintsFromFileNames(t *testing.T) {
+	iface := func(name string) string {
+		return "package sample\n\ntype " + name + " interface {\n\tDo() error\n}\n"
+	}
+	dir, rmDir := writeTree(t, map[string]string{
+		"doer_linux.go":          iface("Doer"),
+		"store_android_arm64.go": iface("Store"),
+		"cache_arm64.go":         iface("Cache"),
+		"client_unknown.go":      iface("Client"),
+	})
+	defer rmDir()
+
+	ctx := build.Default
+	ctx.GOOS = "android"
+	ctx.GOARCH = "arm64"
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{Context: &ctx},
+		Writer:        &fm.FileWriter{},
+		ImportWriter:  &fm.GoImportsWriter{},
+		Internal:      true,
+		Constraints:   true,
+	}
+
+	err := cmd.Run(dir, "fm_test.go")
+	if err != nil {
+		t.Fatalf("Run failed with error %v", err)
+	}
+
+	filenames, err := filepath.Glob(filepath.Join(dir, "fm_*"))
+	if err != nil {
+		t.Fatalf("Glob failed with %v", err)
+	}
+	var got []string
+	for _, filename := range filenames {
+		got = append(got, filepath.Base(filename))
+	}
+	sort.Strings(got)
+	want := []string{
+		"fm_android_and_arm64_build_test.go",
+		"fm_arm64_build_test.go",
+		"fm_linux_build_test.go",
+		"fm_test.go",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunStrictWritesNoConstraintGroup ensures nothing is written in
+// strict mode when only a later constraint group skips a declaration
+func TestRunStrictWritesNoConstraintGroup(t *testing.T) {
+	dir, rmDir := writeTree(t, map[string]string{
+		"doer.go": "package sample\n\ntype Doer interface {\n\tDo() error\n}\n",
+		"store_linux.go": "package sample\n\nimport \"io\"\n\n" +
+			"type Store interface {\n\tio.Reader\n\tGet() string\n}\n",
+	})
+	defer rmDir()
+
+	ctx := linuxContext()
+	spyWriter := &SpyWriter{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{Context: &ctx},
+		Writer:        spyWriter,
+		ImportWriter:  &SpyImportWriter{},
+		Internal:      true,
+		Constraints:   true,
+		Strict:        true,
+	}
+
+	err := cmd.Run(dir, "fm_test.go")
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if spyWriter.Write_Called {
+		t.Errorf("want no write, got a write of %s", spyWriter.Write_Input.Arg0)
+	}
+}
+
+// TestRunChecksEveryConstraintGroupBeforeWriting ensures a constraint
+// group whose spies do not compile leaves the files of all the others
+// untouched
+func TestRunChecksEveryConstraintGroupBeforeWriting(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"doer.go": "package sample\n\ntype Doer interface {\n\tDo() error\n}\n",
+		// the spy of Store is declared already, so that the spies of
+		// the linux group, which follows that of doer.go, do not compile
+		"store_linux.go": "package sample\n\ntype Store interface {\n\tGet() string\n}\n\ntype SpyStore struct{}\n",
+	})
+	defer rmDir()
+
+	ctx := linuxContext()
+	parser := &fm.SrcFileParser{Context: &ctx}
+	spyWriter := &SpyWriter{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        parser,
+		Writer:        spyWriter,
+		ImportWriter:  &fm.GoImportsWriter{},
+		Checker:       &fm.TypeChecker{Parser: parser},
+		Internal:      true,
+		Constraints:   true,
+	}
+
+	err := cmd.Run(dir, "fm_test.go")
+	if err == nil || !strings.Contains(err.Error(), "SpyStore") {
+		t.Fatalf("want error naming SpyStore, got %v", err)
+	}
+	if spyWriter.Write_Called {
+		t.Errorf("want no write, got a write of %s", spyWriter.Write_Input.Arg0)
+	}
+}
+
+// buildConstraint returns the expression of the file's //go:build line,
+// or an empty string when it has none
+func buildConstraint(f *ast.File) string {
+	for _, group := range f.Comments {
+		for _, comment := range group.List {
+			if constraint.IsGoBuild(comment.Text) {
+				expr, err := constraint.Parse(comment.Text)
+				if err == nil {
+					return expr.String()
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// linuxContext returns a build context for linux on amd64
+// with the integration tag
+func linuxContext() build.Context {
+	ctx := build.Default
+	ctx.GOOS = "linux"
+	ctx.GOARCH = "amd64"
+	ctx.BuildTags = []string{"integration"}
+	return ctx
+}
@@ -6,7 +6,17 @@ import (
 )
 
 const (
-	spyPrefix = "Spy"
+	spyPrefix         = "Spy"
+	calledField       = "called"
+	calledSuffix      = "_Called"
+	callLogField      = "CallLog"
+	callCountSuffix   = "_CallCount"
+	waitPrefix        = "WaitFor"
+	gateSuffix        = "_gate"
+	blockPrefix       = "Block"
+	releasePrefix     = "Release"
+	rulesSuffix       = "_rules"
+	returnsWhenSuffix = "ReturnsWhen"
 )
 
 // SpyStructConverter converts interfaces into spies, i.e., test doubles.
@@ -14,7 +24,10 @@ const (
 type SpyStructConverter struct{}
 
 // Convert mutates the ast.TypeSpec into a struct type with public properties
-// for all parameters and all return values declared in the interface
+// for all parameters and all return values declared in the interface,
+// along with a count of calls made to each function, a gate for
+// blocking calls to each function, rules for conditional return values,
+// and a log of the names of the functions called, in order
 func (s *SpyStructConverter) Convert(t *ast.TypeSpec, i *ast.InterfaceType) *ast.TypeSpec {
 	var list []*ast.Field
 	list = append(list, &ast.Field{
@@ -24,6 +37,11 @@ func (s *SpyStructConverter) Convert(t *ast.TypeSpec, i *ast.InterfaceType) *ast
 			Sel: ast.NewIdent("Mutex"),
 		},
 	})
+	// closed and reset whenever a function is called
+	list = append(list, &ast.Field{
+		Names: []*ast.Ident{ast.NewIdent(calledField)},
+		Type:  emptyChanType(),
+	})
 
 	for _, field := range i.Methods.List {
 		funcType, ok := field.Type.(*ast.FuncType)
@@ -37,11 +55,17 @@ func (s *SpyStructConverter) Convert(t *ast.TypeSpec, i *ast.InterfaceType) *ast
 
 		methodName := field.Names[0].Name
 		wasCalled := &ast.Field{
-			Names: []*ast.Ident{ast.NewIdent(methodName + "_Called")},
+			Names: []*ast.Ident{ast.NewIdent(methodName + calledSuffix)},
 			Type:  ast.NewIdent("bool"),
 		}
 		list = append(list, wasCalled)
 
+		callCount := &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(methodName + callCountSuffix)},
+			Type:  ast.NewIdent("int"),
+		}
+		list = append(list, callCount)
+
 		// add Input struct with arguments
 		if len(funcType.Params.List) > 0 {
 			inputStruct := buildStruct(methodName+inputSuffix, argPrefix, funcType.Params.List)
@@ -53,6 +77,31 @@ func (s *SpyStructConverter) Convert(t *ast.TypeSpec, i *ast.InterfaceType) *ast
 			outputStruct := buildStruct(methodName+outputSuffix, retPrefix, funcType.Results.List)
 			list = append(list, outputStruct)
 		}
+
+		// add gate which holds calls while the function is blocked
+		gate := &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(unexported(methodName) + gateSuffix)},
+			Type:  emptyChanType(),
+		}
+		list = append(list, gate)
+
+		// add rules which set return values for matching arguments
+		if funcType.Results != nil && len(funcType.Results.List) > 0 {
+			rules := &ast.Field{
+				Names: []*ast.Ident{ast.NewIdent(unexported(methodName) + rulesSuffix)},
+				Type:  &ast.ArrayType{Elt: ruleFuncType(funcType)},
+			}
+			list = append(list, rules)
+		}
+	}
+
+	// the log is left out when the interface declares a method of the
+	// same name, which is spied on instead
+	if !methodNames(i)[callLogField] {
+		list = append(list, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(callLogField)},
+			Type:  &ast.ArrayType{Elt: ast.NewIdent("string")},
+		})
 	}
 
 	return &ast.TypeSpec{
@@ -63,34 +112,19 @@ func (s *SpyStructConverter) Convert(t *ast.TypeSpec, i *ast.InterfaceType) *ast
 	}
 }
 
-// buildInputStruct writes a struct type whose fields
+// buildStruct writes a struct type whose fields
 // reflect the various input arguments defined in the interface
 func buildStruct(fieldname, prefix string, list []*ast.Field) *ast.Field {
-	var (
-		fields    []*ast.Field
-		argOffset int
-		argName   string
-	)
-
-	for idx, param := range list {
-		// if we have multiple arguments of the same type,
-		// add fields for each argument
-		if len(param.Names) > 1 {
-			for range param.Names {
-				argName = fmt.Sprintf("%s%d", prefix, idx+argOffset)
-				fields = append(fields, &ast.Field{
-					Names: []*ast.Ident{ast.NewIdent(argName)},
-					Type:  param.Type,
-				})
-				argOffset++
-			}
-		} else {
-			argName = fmt.Sprintf("%s%d", prefix, idx+argOffset)
-			fields = append(fields, &ast.Field{
-				Names: []*ast.Ident{ast.NewIdent(argName)},
-				Type:  param.Type,
-			})
-		}
+	var fields []*ast.Field
+
+	// multiple arguments of the same type, e.g., (one, two string),
+	// result in a field for each argument
+	for idx, t := range fieldTypes(&ast.FieldList{List: list}) {
+		argName := fmt.Sprintf("%s%d", prefix, idx)
+		fields = append(fields, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(argName)},
+			Type:  storedType(t),
+		})
 	}
 	return &ast.Field{
 		Names: []*ast.Ident{ast.NewIdent(fieldname)},
@@ -99,3 +133,12 @@ func buildStruct(fieldname, prefix string, list []*ast.Field) *ast.Field {
 		},
 	}
 }
+
+// storedType returns the type of a field which stores an argument,
+// i.e., a variadic ...T argument is stored as []T
+func storedType(t ast.Expr) ast.Expr {
+	if ellipsis, ok := t.(*ast.Ellipsis); ok {
+		return &ast.ArrayType{Elt: ellipsis.Elt}
+	}
+	return t
+}
@@ -57,12 +57,19 @@ func TestConvertAddsMutexWithRecordOfFunctionCallAsFields(t *testing.T) {
 		t.Errorf("want %v, got %v", want, got)
 	}
 
-	calledField := structType.Fields.List[1]
+	calledField := structType.Fields.List[2]
 	want = "Test_Called"
 	got = calledField.Names[0].Name
 	if want != got {
 		t.Errorf("want %v, got %v", want, got)
 	}
+
+	callCountField := structType.Fields.List[3]
+	want = "Test_CallCount"
+	got = callCountField.Names[0].Name
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
 }
 
 // does not add input when there are no arguments
@@ -92,7 +99,7 @@ func TestConvertGeneratesInputStructFieldWithArguments(t *testing.T) {
 		t.Fatal("expected typeSpec to be of type StructType")
 	}
 
-	want := 2
+	want := 6 // mu, called, Test_Called, Test_CallCount, test_gate, and CallLog
 	got := len(structType.Fields.List)
 	if want != got {
 		t.Errorf("want %v, got %v", want, got)
@@ -132,14 +139,14 @@ func TestConvertGeneratesInputStructWithArgumentFields(t *testing.T) {
 		t.Fatal("expected typeSpec to be of type StructType")
 	}
 
-	want := 3 // mu, Test_Called, and Test_Input
+	want := 7 // mu, called, Test_Called, Test_CallCount, Test_Input, test_gate, and CallLog
 	got := len(structType.Fields.List)
 
 	if want != got {
 		t.Errorf("want %v, got %v", want, got)
 	}
 
-	inputStruct := structType.Fields.List[2]
+	inputStruct := structType.Fields.List[4]
 
 	wantName := "Test_Input"
 	gotName := inputStruct.Names[0].Name
@@ -213,7 +220,7 @@ func TestConvertHandlesArgumentsDeclaredWithOneType(t *testing.T) {
 	if !ok {
 		t.Fatal("expected typeSpec to be of type StructType")
 	}
-	inputStruct := structType.Fields.List[2]
+	inputStruct := structType.Fields.List[4]
 	input, ok := inputStruct.Type.(*ast.StructType)
 	if !ok {
 		t.Fatal("expected inputStruct to be of type StructType")
@@ -289,14 +296,14 @@ func TestConvertGeneratesOutputStruct(t *testing.T) {
 		t.Fatal("expected typeSpec to be of type StructType")
 	}
 
-	want := 3 // mu, Test_Called, and Test_Output
+	want := 8 // mu, called, Test_Called, Test_CallCount, Test_Output, test_gate, test_rules, and CallLog
 	got := len(structType.Fields.List)
 
 	if want != got {
 		t.Errorf("want %v, got %v", want, got)
 	}
 
-	outputStruct := structType.Fields.List[2]
+	outputStruct := structType.Fields.List[4]
 
 	wantName := "Test_Output"
 	gotName := outputStruct.Names[0].Name
@@ -362,7 +369,7 @@ func TestConvertIgnoresEmptyReturnValues(t *testing.T) {
 		t.Fatal("expected typeSpec to be of type StructType")
 	}
 
-	want := 2 // mu and Test_Called
+	want := 6 // mu, called, Test_Called, Test_CallCount, test_gate, and CallLog
 	got := len(structType.Fields.List)
 	if want != got {
 		t.Errorf("want %v, got %v", want, got)
@@ -0,0 +1,154 @@
+package fm
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+const (
+	delegatePrefix = "Delegate"
+	delegateField  = "Delegate"
+)
+
+// DelegateGenerator creates delegating implementations of interface
+// declarations, i.e., test doubles which record calls like a spy
+// but forward them to a real implementation
+type DelegateGenerator struct {
+	Converter   StructConverter
+	Implementer FuncImplementer
+}
+
+// Generate transforms all the interfaces in the list of declarations
+// into delegates in the form of structs with implemented functions
+func (g *DelegateGenerator) Generate(ds []ast.Decl) ([]ast.Decl, []Diagnostic) {
+	return generate(ds, g.Converter, g.Implementer)
+}
+
+// DelegateStructConverter converts interfaces into delegates.
+// Meant to be used in conjunction with DelegateFuncImplementer
+type DelegateStructConverter struct{}
+
+// Convert returns a struct type with a Delegate property, which holds
+// the real implementation, along with public properties recording calls
+// to and the arguments of all functions declared in the interface
+func (s *DelegateStructConverter) Convert(t *ast.TypeSpec, i *ast.InterfaceType) *ast.TypeSpec {
+	// an interface literal with the same methods avoids
+	// having to refer to the interface by name
+	return convertDelegate(t, i, &ast.InterfaceType{Methods: i.Methods})
+}
+
+// ConvertFuncType returns a struct type like Convert, except that its
+// Delegate property holds a func of the named func type, e.g., a func
+// literal, rather than a type with a method of the same name
+func (s *DelegateStructConverter) ConvertFuncType(t *ast.TypeSpec, i *ast.InterfaceType) *ast.TypeSpec {
+	return convertDelegate(t, i, ast.NewIdent(t.Name.Name))
+}
+
+// convertDelegate returns a delegate struct type whose Delegate
+// property is of the given type
+func convertDelegate(t *ast.TypeSpec, i *ast.InterfaceType, delegateType ast.Expr) *ast.TypeSpec {
+	var list []*ast.Field
+	list = append(list, &ast.Field{
+		Names: []*ast.Ident{ast.NewIdent(delegateField)},
+		Type:  delegateType,
+	})
+	list = append(list, &ast.Field{
+		Names: []*ast.Ident{ast.NewIdent("mu")},
+		Type:  selector("sync", "Mutex"),
+	})
+
+	for _, field := range i.Methods.List {
+		funcType, ok := field.Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+
+		methodName := field.Names[0].Name
+		list = append(list, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(methodName + calledSuffix)},
+			Type:  ast.NewIdent("bool"),
+		})
+		list = append(list, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(methodName + callCountSuffix)},
+			Type:  ast.NewIdent("int"),
+		})
+
+		if len(funcType.Params.List) > 0 {
+			list = append(list, buildStruct(methodName+inputSuffix, argPrefix, funcType.Params.List))
+		}
+	}
+
+	return &ast.TypeSpec{
+		Name: ast.NewIdent(delegatePrefix + t.Name.Name),
+		Type: &ast.StructType{
+			Fields: &ast.FieldList{List: list},
+		},
+	}
+}
+
+// DelegateFuncImplementer creates delegating implementations of an
+// interface's functions. Meant to be used in conjunction with
+// DelegateStructConverter
+type DelegateFuncImplementer struct{}
+
+// Implement returns function declarations whose arguments are saved
+// as properties before the call is passed on to the Delegate
+func (s *DelegateFuncImplementer) Implement(name *ast.Ident, i *ast.InterfaceType) []*ast.FuncDecl {
+	return implementDelegate(name, i, func(fname string) ast.Expr {
+		return recvSelector(delegateField, fname)
+	})
+}
+
+// ImplementFuncType returns the method standing in for a named func type,
+// which passes the call on to the Delegate by calling it
+func (s *DelegateFuncImplementer) ImplementFuncType(name *ast.Ident, i *ast.InterfaceType) []*ast.FuncDecl {
+	return implementDelegate(name, i, func(string) ast.Expr {
+		return recvSelector(delegateField)
+	})
+}
+
+// implementDelegate returns the delegating functions of the interface,
+// each of which calls the func returned by delegate for its name
+func implementDelegate(name *ast.Ident, i *ast.InterfaceType, delegate func(fname string) ast.Expr) []*ast.FuncDecl {
+	var funcDecls []*ast.FuncDecl
+	for _, list := range i.Methods.List {
+		funcType, ok := list.Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+
+		fname := list.Names[0].Name
+		body := []ast.Stmt{
+			lockStmt(),
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{recvSelector(fname + calledSuffix)},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{ast.NewIdent("true")},
+			},
+			&ast.IncDecStmt{
+				X:   recvSelector(fname + callCountSuffix),
+				Tok: token.INC,
+			},
+		}
+		body = append(body, createInputStmts(fname, funcType)...)
+		body = append(body, unlockStmt())
+
+		call := callWithParams(delegate(fname), funcType)
+		if len(resultTypes(funcType)) > 0 {
+			body = append(body, &ast.ReturnStmt{Results: []ast.Expr{call}})
+		} else {
+			body = append(body, &ast.ExprStmt{X: call})
+		}
+
+		funcDecls = append(funcDecls, &ast.FuncDecl{
+			Recv: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent(recvName)},
+				Type:  &ast.StarExpr{X: name},
+			}}},
+			Name: list.Names[0],
+			Type: funcType,
+			Body: &ast.BlockStmt{List: body},
+		})
+	}
+	return funcDecls
+}
@@ -0,0 +1,127 @@
+package fm_test
+
+import (
+	"go/ast"
+	"go/types"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+func TestDelegateConvertAddsDelegateField(t *testing.T) {
+	converter := &fm.DelegateStructConverter{}
+
+	typeSpec := converter.Convert(
+		&ast.TypeSpec{Name: ast.NewIdent("Tester")},
+		buildInterface(),
+	)
+
+	want := "DelegateTester"
+	got := typeSpec.Name.Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	structType, ok := typeSpec.Type.(*ast.StructType)
+	if !ok {
+		t.Fatal("expected typeSpec to be of type StructType")
+	}
+
+	want = "Delegate"
+	got = structType.Fields.List[0].Names[0].Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if _, ok := structType.Fields.List[0].Type.(*ast.InterfaceType); !ok {
+		t.Error("expected Delegate to be of type InterfaceType")
+	}
+}
+
+func TestDelegateImplementCallsDelegate(t *testing.T) {
+	s := &fm.DelegateFuncImplementer{}
+	funcDecls := s.Implement(ast.NewIdent("DelegateTester"), buildResultInterface())
+
+	if len(funcDecls) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(funcDecls))
+	}
+
+	body := funcDecls[0].Body.List
+	ret, ok := body[len(body)-1].(*ast.ReturnStmt)
+	if !ok {
+		t.Fatal("expected last statement to be of type *ast.ReturnStmt")
+	}
+	call, ok := ret.Results[0].(*ast.CallExpr)
+	if !ok {
+		t.Fatal("expected return value to be a call")
+	}
+	sel := call.Fun.(*ast.SelectorExpr)
+
+	want := "SomeMethod"
+	got := sel.Sel.Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	want = "Delegate"
+	got = sel.X.(*ast.SelectorExpr).Sel.Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestDelegateConvertFuncTypeTypesDelegateAsFuncType(t *testing.T) {
+	converter := &fm.DelegateStructConverter{}
+
+	typeSpec := converter.ConvertFuncType(
+		&ast.TypeSpec{Name: ast.NewIdent("Tester")},
+		buildInterface(),
+	)
+
+	structType, ok := typeSpec.Type.(*ast.StructType)
+	if !ok {
+		t.Fatal("expected typeSpec to be of type StructType")
+	}
+
+	ident, ok := structType.Fields.List[0].Type.(*ast.Ident)
+	if !ok {
+		t.Fatal("expected Delegate to be of type Ident")
+	}
+
+	want := "Tester"
+	got := ident.Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestDelegateImplementFuncTypeCallsDelegate(t *testing.T) {
+	s := &fm.DelegateFuncImplementer{}
+	funcDecls := s.ImplementFuncType(ast.NewIdent("DelegateTester"), buildResultInterface())
+
+	if len(funcDecls) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(funcDecls))
+	}
+
+	body := funcDecls[0].Body.List
+	ret, ok := body[len(body)-1].(*ast.ReturnStmt)
+	if !ok {
+		t.Fatal("expected last statement to be of type *ast.ReturnStmt")
+	}
+	call, ok := ret.Results[0].(*ast.CallExpr)
+	if !ok {
+		t.Fatal("expected return value to be a call")
+	}
+
+	want := "f.Delegate"
+	got := types.ExprString(call.Fun)
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
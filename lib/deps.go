@@ -0,0 +1,237 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// generateDeps generates test doubles for the interface-typed fields of
+// the struct named by Deps, whether named or embedded, declared by the
+// package pname within dir or another, or written as interface{...} literals
+func (c *Cmd) generateDeps(fset *token.FileSet, dir, pname string, files []*ast.File, imports *importSet) (*output, error) {
+	// the files of an external test package are checked separately
+	var pkgFiles []*ast.File
+	for _, f := range files {
+		if f.Name.Name == pname {
+			pkgFiles = append(pkgFiles, f)
+		}
+	}
+	conf := types.Config{Importer: newSrcImporter(fset, dir)}
+	pkg, err := conf.Check(pname, fset, pkgFiles, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the dependencies of %s: %v", c.Deps, err)
+	}
+
+	var st *types.Struct
+	if obj, ok := pkg.Scope().Lookup(c.Deps).(*types.TypeName); ok {
+		st, _ = obj.Type().Underlying().(*types.Struct)
+	}
+	if st == nil {
+		return nil, fmt.Errorf("no struct %s in package %s", c.Deps, pname)
+	}
+
+	out := &output{}
+	qualifier := func(p *types.Package) string {
+		if p == pkg {
+			if c.Internal {
+				return ""
+			}
+			out.qualified = true
+			return pname
+		}
+		return imports.add(fileImport{name: p.Name(), path: p.Path()})
+	}
+
+	var ds []ast.Decl
+	asserted := make(map[string]ast.Expr)
+	seen := make(map[string]bool)
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		iface, ok := field.Type().Underlying().(*types.Interface)
+		if !ok || iface.Empty() {
+			continue
+		}
+		if problem := depProblem(field, iface, pkg, c.Internal); problem != "" {
+			out.diags = append(out.diags, Diagnostic{
+				Pos:     field.Pos(),
+				Message: fmt.Sprintf("skipped field %s.%s: %s", c.Deps, field.Name(), problem),
+			})
+			continue
+		}
+
+		typeString := types.TypeString(field.Type(), qualifier)
+		if seen[typeString] {
+			continue // another field of the same type
+		}
+		seen[typeString] = true
+
+		name := depName(c.Deps, field, asserted)
+		spec, err := depSpec(name, field.Pos(), iface, qualifier)
+		if err != nil {
+			return nil, err
+		}
+		assertion, err := parser.ParseExpr(typeString)
+		if err != nil {
+			return nil, err
+		}
+		asserted[name] = stripPos(assertion).(ast.Expr)
+		ds = append(ds, &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{spec}})
+	}
+
+	ds = configuredDecls(ds, c.Include, c.Exclude, c.Names)
+	out.sources = ds
+	spyDecls, generated := c.doubles(ds)
+	out.diags = append(out.diags, generated...)
+	out.doubled = doubledNames(spyDecls)
+	retargetAssertions(spyDecls, asserted)
+	out.decls = spyDecls
+	return out, nil
+}
+
+// depProblem describes why no test double can be generated for the
+// interface of the field, or returns an empty string if one can
+func depProblem(field *types.Var, iface *types.Interface, pkg *types.Package, internal bool) string {
+	// types of the package itself are only visible when internal
+	own := ""
+	if internal {
+		own = pkg.Path()
+	}
+
+	if named, ok := field.Type().(*types.Named); ok {
+		obj := named.Obj()
+		switch {
+		case obj.Pkg() == nil || obj.Exported():
+			// predeclared, e.g., error, or exported
+		case obj.Pkg() == pkg && !internal:
+			return fmt.Sprintf("interface %s is unexported; use -internal to spy on it", obj.Name())
+		case obj.Pkg() != pkg:
+			return fmt.Sprintf("interface %s is unexported by package %s", obj.Name(), obj.Pkg().Path())
+		}
+	}
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		if !m.Exported() && (m.Pkg() != pkg || !internal) {
+			return fmt.Sprintf("method %s is unexported", m.Name())
+		}
+		if t := unexportedType(m.Type().(*types.Signature), own); t != "" {
+			return fmt.Sprintf("method %s uses unexported type %s", m.Name(), t)
+		}
+	}
+	return ""
+}
+
+// depName returns the name of the interface standing in for the type
+// of the field. A named interface keeps its name, e.g., Error for error,
+// and an instantiated one is named after its type arguments, e.g.,
+// RepoTask for Repo[Task], just as with -iface. Either is prefixed by its
+// package when the name is taken, e.g., IoReader. An interface literal is
+// named after the struct and the field, e.g., DelegatorLogger.
+func depName(structName string, field *types.Var, taken map[string]ast.Expr) string {
+	named, ok := field.Type().(*types.Named)
+	if !ok {
+		return structName + exported(field.Name())
+	}
+	name := exported(named.Obj().Name())
+	if targs := named.TypeArgs(); targs.Len() > 0 {
+		var args []ast.Expr
+		for i := 0; i < targs.Len(); i++ {
+			arg, err := parser.ParseExpr(types.TypeString(targs.At(i), (*types.Package).Name))
+			if err == nil {
+				args = append(args, arg)
+			}
+		}
+		name = instanceName(name, args)
+	}
+	if _, ok := taken[name]; ok && named.Obj().Pkg() != nil {
+		name = exported(named.Obj().Pkg().Name()) + name
+	}
+	return name
+}
+
+// exported returns the name with its first letter in upper case
+func exported(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// depSpec declares an interface holding all methods of iface,
+// including those it embeds
+func depSpec(name string, pos token.Pos, iface *types.Interface, qualifier types.Qualifier) (*ast.TypeSpec, error) {
+	var b strings.Builder
+	b.WriteString("interface {\n")
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		fmt.Fprintf(&b, "%s%s\n", m.Name(), strings.TrimPrefix(types.TypeString(m.Type(), qualifier), "func"))
+	}
+	b.WriteString("}")
+
+	expr, err := parser.ParseExpr(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("interface %s does not parse: %v", name, err)
+	}
+	// the positions of the parsed interface lie outside the file set
+	return &ast.TypeSpec{
+		Name: &ast.Ident{Name: name, NamePos: pos},
+		Type: stripPos(expr).(ast.Expr),
+	}, nil
+}
+
+// doubledNames maps the structs among the generated declarations to
+// the interfaces named in their compile-time assertions, before those
+// are retargeted, e.g., SpyDelegatorLogger to DelegatorLogger
+func doubledNames(ds []ast.Decl) map[string]string {
+	names := make(map[string]string)
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec, ok := spec.(*ast.ValueSpec)
+			if !ok || len(valueSpec.Values) != 1 {
+				continue
+			}
+			ident, ok := valueSpec.Type.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			if structName := assertedStruct(valueSpec.Values[0]); structName != "" {
+				names[structName] = ident.Name
+			}
+		}
+	}
+	return names
+}
+
+// retargetAssertions replaces the interfaces named in the compile-time
+// assertions among the generated declarations with the types of the
+// types they stand in for, e.g., var _ io.Reader = (*SpyReader)(nil),
+// and reports whether any was replaced
+func retargetAssertions(ds []ast.Decl, asserted map[string]ast.Expr) bool {
+	var retargeted bool
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			if ident, ok := valueSpec.Type.(*ast.Ident); ok {
+				if expr, ok := asserted[ident.Name]; ok {
+					valueSpec.Type = expr
+					retargeted = true
+				}
+			}
+		}
+	}
+	return retargeted
+}
@@ -0,0 +1,190 @@
+package fm_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestRunGeneratesSpiesForDeps ensures a spy is generated for each
+// interface-typed field of the struct, whether named, embedded, declared
+// by another package, or an interface literal, skipping the others
+func TestRunGeneratesSpiesForDeps(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+import "io"
+
+type Reader interface {
+	ReadAll() ([]byte, error)
+}
+
+type Notifier interface {
+	Notify(msg string)
+}
+
+type hidden interface {
+	Hide()
+}
+
+type Delegator struct {
+	Notifier
+	local  Reader
+	remote io.Reader
+	again  io.Reader
+	logger interface {
+		Log(msg string)
+	}
+	secret hidden
+	count  int
+}
+`,
+	})
+	defer rmDir()
+
+	warnings := &strings.Builder{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Warnings:      warnings,
+		Deps:          "Delegator",
+	}
+	f := runChecked(t, cmd, dir, "fm_test.go")
+
+	asserted := assertedTypes(f)
+	logger := asserted["SpyDelegatorLogger"]
+	delete(asserted, "SpyDelegatorLogger")
+	want := map[string][]string{
+		"SpyNotifier": {"sample.Notifier"},
+		"SpyReader":   {"sample.Reader"},
+		"SpyIoReader": {"io.Reader"},
+	}
+	if !reflect.DeepEqual(want, asserted) {
+		t.Errorf("want %v, got %v", want, asserted)
+	}
+	if len(logger) != 1 || !strings.HasPrefix(logger[0], "interface{") {
+		t.Errorf("want SpyDelegatorLogger asserted to implement the literal, got %v", logger)
+	}
+
+	wantWarnings := filepath.Join(dir, "sample.go") +
+		":25:2: skipped field Delegator.secret: interface hidden is unexported; use -internal to spy on it\n"
+	gotWarnings := warnings.String()
+
+	if wantWarnings != gotWarnings {
+		t.Errorf("want %v, got %v", wantWarnings, gotWarnings)
+	}
+}
+
+// TestRunNamesInstantiatedDeps ensures the fields of instantiated generic
+// interfaces receive spies named as -iface names them, one for each
+// instantiation
+func TestRunNamesInstantiatedDeps(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type Task struct{}
+
+type Item struct{}
+
+type Repo[T any] interface {
+	Get(id string) (T, error)
+}
+
+type Pair[K comparable, V any] interface {
+	Put(key K, value V)
+}
+
+type Worker struct {
+	tasks Repo[Task]
+	items Repo[*Item]
+	index Pair[string, Task]
+}
+`,
+	})
+	defer rmDir()
+
+	f := runChecked(t, &fm.Cmd{DeclGenerator: buildGen(), Deps: "Worker"}, dir, "fm_test.go")
+
+	want := map[string][]string{
+		"SpyRepoTask":       {"sample.Repo[sample.Task]"},
+		"SpyRepoPtrItem":    {"sample.Repo[*sample.Item]"},
+		"SpyPairStringTask": {"sample.Pair[string, sample.Task]"},
+	}
+	got := assertedTypes(f)
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunRecordsDepsInManifest ensures the spies of interface literals
+// are recorded under the name of their dependency, at its field
+func TestRunRecordsDepsInManifest(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+import "io"
+
+type Delegator struct {
+	remote io.Reader
+	logger interface {
+		Log(msg string)
+	}
+}
+`,
+	})
+	defer rmDir()
+
+	manifest := &fm.Manifest{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Deps:          "Delegator",
+		Manifest:      manifest,
+	}
+	runChecked(t, cmd, dir, "fm_test.go")
+
+	if len(manifest.Packages) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(manifest.Packages))
+	}
+
+	filename := filepath.Join(dir, "sample.go")
+	want := []fm.ManifestInterface{
+		{Name: "Reader", Position: filename + ":6:2", Generated: "SpyReader"},
+		{Name: "DelegatorLogger", Position: filename + ":7:2", Generated: "SpyDelegatorLogger"},
+	}
+	got := manifest.Packages[0].Interfaces
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunRequiresDepsStruct ensures a missing struct is reported
+func TestRunRequiresDepsStruct(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": "package sample\n\ntype Delegator interface{}\n",
+	})
+	defer rmDir()
+
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{},
+		Writer:        &SpyWriter{},
+		ImportWriter:  &SpyImportWriter{},
+		Deps:          "Delegator",
+	}
+
+	err := cmd.Run(dir, "fm_test.go")
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := "no struct Delegator in package sample"
+	got := err.Error()
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
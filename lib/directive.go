@@ -0,0 +1,70 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+const directivePrefix = "//fm:"
+
+// directives control generation for a single interface
+// through comments such as //fm:skip
+type directives struct {
+	// skip excludes the interface, from //fm:skip
+	skip bool
+	// name overrides the name of the generated type, from //fm:name FakeStore
+	name string
+	// kind chooses the kind of test double, from //fm:kind stub
+	kind string
+}
+
+// parseDirectives reads the directives within the doc comments,
+// returning a diagnostic for each one which is unknown or malformed
+func parseDirectives(docs ...*ast.CommentGroup) (directives, []Diagnostic) {
+	var d directives
+	var diags []Diagnostic
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		for _, c := range doc.List {
+			if !strings.HasPrefix(c.Text, directivePrefix) {
+				continue
+			}
+			fields := strings.Fields(strings.TrimPrefix(c.Text, directivePrefix))
+			if len(fields) == 0 {
+				diags = append(diags, Diagnostic{Pos: c.Pos(), Message: "empty fm directive"})
+				continue
+			}
+
+			verb, args := fields[0], fields[1:]
+			switch {
+			case verb == "skip" && len(args) == 0:
+				d.skip = true
+			case verb == "name" && len(args) == 1 && token.IsIdentifier(args[0]):
+				d.name = args[0]
+			case verb == "kind" && len(args) == 1:
+				d.kind = args[0]
+			case verb == "skip" || verb == "name" || verb == "kind":
+				diags = append(diags, Diagnostic{
+					Pos:     c.Pos(),
+					Message: fmt.Sprintf("malformed directive %s", c.Text),
+				})
+			default:
+				diags = append(diags, Diagnostic{
+					Pos:     c.Pos(),
+					Message: fmt.Sprintf("unknown directive %s%s", directivePrefix, verb),
+				})
+			}
+		}
+	}
+	return d, diags
+}
+
+// skipped reports whether the type spec is marked with //fm:skip
+func skipped(genDecl *ast.GenDecl, t *ast.TypeSpec) bool {
+	dirs, _ := parseDirectives(genDecl.Doc, t.Doc)
+	return dirs.skip
+}
@@ -0,0 +1,74 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+const (
+	dummyPrefix = "Dummy"
+)
+
+// DummyGenerator creates dummy implementations of interface declarations,
+// i.e., test doubles which satisfy an interface but are never meant
+// to be called
+type DummyGenerator struct {
+	Converter   StructConverter
+	Implementer FuncImplementer
+}
+
+// Generate transforms all the interfaces in the list of declarations
+// into dummies in the form of empty structs with implemented functions
+func (g *DummyGenerator) Generate(ds []ast.Decl) ([]ast.Decl, []Diagnostic) {
+	return generate(ds, g.Converter, g.Implementer)
+}
+
+// DummyStructConverter converts interfaces into dummies.
+// Meant to be used in conjunction with DummyFuncImplementer
+type DummyStructConverter struct{}
+
+// Convert returns an empty struct type named after the interface
+func (s *DummyStructConverter) Convert(t *ast.TypeSpec, i *ast.InterfaceType) *ast.TypeSpec {
+	return &ast.TypeSpec{
+		Name: ast.NewIdent(dummyPrefix + t.Name.Name),
+		// written as an identifier so that it prints on a single line
+		Type: ast.NewIdent("struct{}"),
+	}
+}
+
+// DummyFuncImplementer creates dummy implementations of an interface's
+// functions. Meant to be used in conjunction with DummyStructConverter
+type DummyFuncImplementer struct{}
+
+// Implement returns function declarations which panic when called
+func (s *DummyFuncImplementer) Implement(name *ast.Ident, i *ast.InterfaceType) []*ast.FuncDecl {
+	var funcDecls []*ast.FuncDecl
+	for _, list := range i.Methods.List {
+		funcType, ok := list.Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+
+		funcDecls = append(funcDecls, &ast.FuncDecl{
+			Recv: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent(recvName)},
+				Type:  &ast.StarExpr{X: name},
+			}}},
+			Name: list.Names[0],
+			Type: funcType,
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				panicStmt(fmt.Sprintf("unexpected call to %s.%s", name.Name, list.Names[0].Name)),
+			}},
+		})
+	}
+	return funcDecls
+}
+
+// panicStmt returns the statement panic(msg)
+func panicStmt(msg string) ast.Stmt {
+	return &ast.ExprStmt{X: &ast.CallExpr{
+		Fun:  ast.NewIdent("panic"),
+		Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("%q", msg)}},
+	}}
+}
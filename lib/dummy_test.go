@@ -0,0 +1,56 @@
+package fm_test
+
+import (
+	"go/ast"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+func TestDummyConvertAddsDummyToTypeSpecName(t *testing.T) {
+	converter := &fm.DummyStructConverter{}
+
+	typeSpec := converter.Convert(
+		&ast.TypeSpec{Name: ast.NewIdent("Tester")},
+		buildInterface(),
+	)
+
+	want := "DummyTester"
+	got := typeSpec.Name.Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestDummyImplementPanics(t *testing.T) {
+	s := &fm.DummyFuncImplementer{}
+	funcDecls := s.Implement(ast.NewIdent("DummyTester"), buildInterface())
+
+	if len(funcDecls) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(funcDecls))
+	}
+
+	stmt, ok := funcDecls[0].Body.List[0].(*ast.ExprStmt)
+	if !ok {
+		t.Fatal("expected first statement to be of type *ast.ExprStmt")
+	}
+	call, ok := stmt.X.(*ast.CallExpr)
+	if !ok {
+		t.Fatal("expected first statement to be a call")
+	}
+
+	want := "panic"
+	got := call.Fun.(*ast.Ident).Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	wantMsg := `"unexpected call to DummyTester.SomeMethod"`
+	gotMsg := call.Args[0].(*ast.BasicLit).Value
+
+	if wantMsg != gotMsg {
+		t.Errorf("want %v, got %v", wantMsg, gotMsg)
+	}
+}
@@ -0,0 +1,60 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// externalProblem describes why the interface, or func type, cannot be
+// implemented from an external test package, or returns an empty string
+// if it can
+func externalProblem(t *ast.TypeSpec) string {
+	if !t.Name.IsExported() {
+		return fmt.Sprintf("%s %s is unexported", typeKind(t), t.Name.Name)
+	}
+
+	for _, field := range methodsOf(t) {
+		if len(field.Names) == 0 {
+			if name := unexportedIdent(field.Type); name != "" {
+				return fmt.Sprintf("interface %s embeds unexported %s", t.Name.Name, name)
+			}
+			continue
+		}
+
+		methodName := field.Names[0].Name
+		if !field.Names[0].IsExported() {
+			return fmt.Sprintf("method %s.%s is unexported", t.Name.Name, methodName)
+		}
+		if name := unexportedIdent(field.Type); name != "" {
+			return fmt.Sprintf("method %s.%s uses unexported type %s", t.Name.Name, methodName, name)
+		}
+	}
+
+	return ""
+}
+
+// unexportedIdent returns the first unexported type name declared in the
+// package which appears within the expression, or an empty string if none do.
+// Names of parameters and types qualified by another package are ignored.
+func unexportedIdent(e ast.Expr) string {
+	var found string
+	ast.Inspect(e, func(n ast.Node) bool {
+		if found != "" {
+			return false
+		}
+		switch node := n.(type) {
+		case *ast.SelectorExpr:
+			return false
+		case *ast.Field:
+			found = unexportedIdent(node.Type)
+			return false
+		case *ast.Ident:
+			if !node.IsExported() && types.Universe.Lookup(node.Name) == nil {
+				found = node.Name
+			}
+		}
+		return true
+	})
+	return found
+}
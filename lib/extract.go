@@ -0,0 +1,176 @@
+package fm
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Extract declares an interface named name holding the exported methods
+// of the type typeName, or only the listed methods, from the package at
+// from, an import path or a directory relative to dir. It returns the
+// source of a file of the package pname within dir, marked as extracted
+// so that it may be overwritten when extracted again, along with the
+// methods left out because they refer to types unexported by their package
+func Extract(dir, pname, from, typeName, name string, methods []string) ([]byte, []string, error) {
+	fset := token.NewFileSet()
+	imp := newSrcImporter(fset, dir)
+	pkg, err := imp.ImportFrom(from, dir, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj, ok := pkg.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return nil, nil, fmt.Errorf("no type %s in package %s", typeName, pkg.Path())
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s.%s is not a named type", pkg.Name(), typeName)
+	}
+	if named.TypeParams().Len() > 0 {
+		return nil, nil, fmt.Errorf("generic type %s.%s is not supported", pkg.Name(), typeName)
+	}
+	if _, ok := named.Underlying().(*types.Interface); ok {
+		return nil, nil, fmt.Errorf("%s.%s is an interface already", pkg.Name(), typeName)
+	}
+
+	// a package imported by directory is known by its directory,
+	// rather than its import path
+	pkgPath := pkg.Path()
+	if build.IsLocalImport(from) || filepath.IsAbs(from) {
+		if !filepath.IsAbs(from) {
+			from = filepath.Join(dir, from)
+		}
+		if p, err := importPath(from); err == nil {
+			pkgPath = p
+		}
+	}
+
+	own, _ := importPath(dir)
+	if pkgPath == own && name == typeName {
+		return nil, nil, fmt.Errorf("interface %s would redeclare the type it is extracted from", name)
+	}
+
+	// the method set of the pointer holds the methods of both receivers
+	available := make(map[string]*types.Func)
+	mset := types.NewMethodSet(types.NewPointer(named))
+	for i := 0; i < mset.Len(); i++ {
+		f := mset.At(i).Obj().(*types.Func)
+		if f.Exported() {
+			available[f.Name()] = f
+		}
+	}
+
+	listed := len(methods) > 0
+	if !listed {
+		for m := range available {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+	}
+
+	imports := newImportSet()
+	qualifier := func(p *types.Package) string {
+		path := p.Path()
+		if p == pkg {
+			path = pkgPath
+		}
+		if path == own {
+			return ""
+		}
+		return imports.add(fileImport{name: p.Name(), path: path})
+	}
+
+	var body bytes.Buffer
+	var skipped []string
+	for _, m := range methods {
+		f, ok := available[m]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s.%s has no exported method %s", pkg.Name(), typeName, m)
+		}
+		sig := f.Type().(*types.Signature)
+		if t := unexportedType(sig, own); t != "" {
+			if listed {
+				return nil, nil, fmt.Errorf("method %s uses unexported type %s", m, t)
+			}
+			skipped = append(skipped, m)
+			continue
+		}
+		fmt.Fprintf(&body, "\t%s%s\n", m, strings.TrimPrefix(types.TypeString(sig, qualifier), "func"))
+	}
+
+	file := &ast.File{Name: ast.NewIdent(pname)}
+	if decl := imports.decl(); decl != nil {
+		file.Decls = append(file.Decls, decl)
+	}
+	// the blank line keeps the header out of the package's documentation
+	var src bytes.Buffer
+	src.WriteString(extractComment + "\n")
+	err = format.Node(&src, token.NewFileSet(), file)
+	if err != nil {
+		return nil, nil, err
+	}
+	src.WriteString("\n")
+	fmt.Fprintf(&src, "// %s holds the methods of %s.%s, as extracted by fm\n", name, pkg.Name(), typeName)
+	fmt.Fprintf(&src, "type %s interface {\n%s}\n", name, body.String())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("extracted interface does not parse: %v", err)
+	}
+	return formatted, skipped, nil
+}
+
+// unexportedType returns the first type within the signature which is
+// unexported by a package other than own, or an empty string if none is
+func unexportedType(sig *types.Signature, own string) string {
+	var found string
+	var visit func(t types.Type)
+	visit = func(t types.Type) {
+		if found != "" {
+			return
+		}
+		switch t := t.(type) {
+		case *types.Named:
+			obj := t.Obj()
+			if obj.Pkg() != nil && obj.Pkg().Path() != own && !obj.Exported() {
+				found = obj.Pkg().Name() + "." + obj.Name()
+				return
+			}
+			for i := 0; i < t.TypeArgs().Len(); i++ {
+				visit(t.TypeArgs().At(i))
+			}
+		case *types.Pointer:
+			visit(t.Elem())
+		case *types.Slice:
+			visit(t.Elem())
+		case *types.Array:
+			visit(t.Elem())
+		case *types.Chan:
+			visit(t.Elem())
+		case *types.Map:
+			visit(t.Key())
+			visit(t.Elem())
+		case *types.Signature:
+			for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+				for i := 0; i < tuple.Len(); i++ {
+					visit(tuple.At(i).Type())
+				}
+			}
+		case *types.Struct:
+			for i := 0; i < t.NumFields(); i++ {
+				visit(t.Field(i).Type())
+			}
+		}
+	}
+	visit(sig)
+	return found
+}
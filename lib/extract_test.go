@@ -0,0 +1,159 @@
+package fm_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestExtractDeclaresInterfaceFromMethodSet ensures the exported methods
+// of both receivers are extracted, leaving out those which refer to types
+// the package does not export
+func TestExtractDeclaresInterfaceFromMethodSet(t *testing.T) {
+	dir, rmDir := writeClientTree(t)
+	defer rmDir()
+
+	src, skipped, err := fm.Extract(filepath.Join(dir, "app"), "app", "../client", "Client", "Client", nil)
+	if err != nil {
+		t.Fatalf("Extract failed with %v", err)
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), "client_interface.go", src, 0)
+	if err != nil {
+		t.Fatalf("extracted source does not parse: %v", err)
+	}
+	if f.Name.Name != "app" {
+		t.Errorf("want package app, got %v", f.Name.Name)
+	}
+	if len(f.Imports) != 2 {
+		t.Errorf("want context and example.com/sample/client imported, got %v", f.Imports)
+	}
+	iface, ok := declaredTypes(f)["Client"].(*ast.InterfaceType)
+	if !ok {
+		t.Fatalf("want interface Client, got %v", declaredTypes(f))
+	}
+	want := map[string]string{
+		"Close": "func() error",
+		"Get":   "func(ctx context.Context, key string) (*client.Item, error)",
+	}
+	got := make(map[string]string)
+	for _, m := range iface.Methods.List {
+		got[m.Names[0].Name] = types.ExprString(m.Type)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if len(skipped) != 1 || skipped[0] != "Options" {
+		t.Errorf("want %v, got %v", []string{"Options"}, skipped)
+	}
+}
+
+// TestExtractLimitsMethods ensures only the listed methods are extracted
+// and that unknown methods are reported
+func TestExtractLimitsMethods(t *testing.T) {
+	dir, rmDir := writeClientTree(t)
+	defer rmDir()
+
+	src, _, err := fm.Extract(filepath.Join(dir, "app"), "app", "../client", "Client", "Closer", []string{"Close"})
+	if err != nil {
+		t.Fatalf("Extract failed with %v", err)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "closer_interface.go", src, 0)
+	if err != nil {
+		t.Fatalf("extracted source does not parse: %v", err)
+	}
+	iface, ok := declaredTypes(f)["Closer"].(*ast.InterfaceType)
+	if !ok || len(iface.Methods.List) != 1 || iface.Methods.List[0].Names[0].Name != "Close" {
+		t.Errorf("want only Close, got %v", declaredTypes(f))
+	}
+
+	_, _, err = fm.Extract(filepath.Join(dir, "app"), "app", "../client", "Client", "Closer", []string{"Put"})
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := "client.Client has no exported method Put"
+	got := err.Error()
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestExtractRerunOverwritesExtractedFile ensures an extracted interface
+// may be extracted again, and that it is parsed like any other source
+func TestExtractRerunOverwritesExtractedFile(t *testing.T) {
+	dir, rmDir := writeClientTree(t)
+	defer rmDir()
+
+	appDir := filepath.Join(dir, "app")
+	filename := filepath.Join(appDir, "client_interface.go")
+	for run := 1; run <= 2; run++ {
+		src, _, err := fm.Extract(appDir, "app", "../client", "Client", "Client", []string{"Close"})
+		if err != nil {
+			t.Fatalf("Extract failed with %v", err)
+		}
+		err = (&fm.FileWriter{}).Write(filename, src)
+		if err != nil {
+			t.Fatalf("run %d: Write failed with %v", run, err)
+		}
+	}
+
+	// the spies of the extracted interface compile
+	runChecked(t, &fm.Cmd{DeclGenerator: buildGen()}, appDir, "fm_test.go")
+
+	pkgs, err := (&fm.SrcFileParser{}).ParseDir(token.NewFileSet(), appDir)
+	if err != nil {
+		t.Fatalf("ParseDir failed with %v", err)
+	}
+	f, ok := pkgs["app"].Files[filename]
+	if !ok {
+		t.Fatalf("want %s parsed, got %v", filename, pkgs["app"].Files)
+	}
+	if f.Doc != nil {
+		t.Errorf("want no package doc, got %v", f.Doc.Text())
+	}
+	var declared bool
+	ast.Inspect(f, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok && spec.Name.Name == "Client" {
+			declared = true
+		}
+		return true
+	})
+	if !declared {
+		t.Error("want Client declared")
+	}
+}
+
+// writeClientTree writes a module holding a concrete client
+// and an application which depends on it
+func writeClientTree(t *testing.T) (string, func()) {
+	return writeModule(t, map[string]string{
+		"client/client.go": `package client
+
+import "context"
+
+type Item struct{}
+
+type options struct{}
+
+type Client struct{}
+
+func (c *Client) Get(ctx context.Context, key string) (*Item, error) { return nil, nil }
+
+func (c Client) Close() error { return nil }
+
+func (c *Client) Options() options { return options{} }
+
+func (c *Client) reset() {}
+`,
+		"app/app.go": "package app\n",
+	})
+}
@@ -3,127 +3,1216 @@
 package fm_test
 
 import (
+	"context"
 	"go/ast"
+	"go/token"
 	"sync"
+
+	fm "github.com/enocom/fm/lib"
 )
 
+type SpyDeclGenerator struct {
+	mu                 sync.Mutex
+	called             chan struct{}
+	Generate_Called    bool
+	Generate_CallCount int
+	Generate_Input     struct {
+		Arg0 []ast.Decl
+	}
+	Generate_Output struct {
+		Ret0 []ast.Decl
+		Ret1 []fm.Diagnostic
+	}
+	generate_gate  chan struct{}
+	generate_rules []func(ds []ast.Decl) (bool, []ast.Decl, []fm.Diagnostic)
+	CallLog        []string
+}
+
+func (f *SpyDeclGenerator) Generate(ds []ast.Decl) ([]ast.Decl, []fm.Diagnostic) {
+	f.mu.Lock()
+	f.Generate_Called = true
+	f.Generate_CallCount++
+	f.CallLog = append(f.CallLog, "Generate")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.Generate_Input.Arg0 = ds
+	gate := f.generate_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.generate_rules, f.Generate_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0, ret1 := rule(ds); ok {
+			return ret0, ret1
+		}
+	}
+	return output.Ret0, output.Ret1
+}
+
+// WaitForGenerate blocks until Generate has been called at least n times
+func (f *SpyDeclGenerator) WaitForGenerate(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Generate_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockGenerate causes calls to Generate to block until ReleaseGenerate is called
+func (f *SpyDeclGenerator) BlockGenerate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.generate_gate == nil {
+		f.generate_gate = make(chan struct{})
+	}
+}
+
+// ReleaseGenerate lets all calls to Generate blocked by BlockGenerate proceed
+func (f *SpyDeclGenerator) ReleaseGenerate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.generate_gate != nil {
+		close(f.generate_gate)
+		f.generate_gate = nil
+	}
+}
+
+// GenerateReturnsWhen makes Generate return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Generate_Output
+func (f *SpyDeclGenerator) GenerateReturnsWhen(match func(ds []ast.Decl) bool, ret0 []ast.Decl, ret1 []fm.Diagnostic) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.generate_rules = append(f.generate_rules, func(ds []ast.Decl) (bool, []ast.Decl, []fm.Diagnostic) {
+		return match(ds), ret0, ret1
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyDeclGenerator) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyDeclGenerator
+	f.Generate_Called = zero.Generate_Called
+	f.Generate_CallCount = zero.Generate_CallCount
+	f.Generate_Input = zero.Generate_Input
+	f.Generate_Output = zero.Generate_Output
+	f.generate_rules = zero.generate_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyDeclGeneratorSnapshot holds a copy of the calls recorded by SpyDeclGenerator
+type SpyDeclGeneratorSnapshot struct {
+	Generate_Called    bool
+	Generate_CallCount int
+	Generate_Input     struct {
+		Arg0 []ast.Decl
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyDeclGenerator) Snapshot() SpyDeclGeneratorSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyDeclGeneratorSnapshot
+	snapshot.Generate_Called = f.Generate_Called
+	snapshot.Generate_CallCount = f.Generate_CallCount
+	snapshot.Generate_Input = f.Generate_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ fm.DeclGenerator = (*SpyDeclGenerator)(nil)
+
+type SpyParser struct {
+	mu                 sync.Mutex
+	called             chan struct{}
+	ParseDir_Called    bool
+	ParseDir_CallCount int
+	ParseDir_Input     struct {
+		Arg0 *token.FileSet
+		Arg1 string
+	}
+	ParseDir_Output struct {
+		Ret0 map[string]*ast.Package
+		Ret1 error
+	}
+	parseDir_gate  chan struct{}
+	parseDir_rules []func(fset *token.FileSet, dir string) (bool, map[string]*ast.Package, error)
+	CallLog        []string
+}
+
+func (f *SpyParser) ParseDir(fset *token.FileSet, dir string) (map[string]*ast.Package, error) {
+	f.mu.Lock()
+	f.ParseDir_Called = true
+	f.ParseDir_CallCount++
+	f.CallLog = append(f.CallLog, "ParseDir")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.ParseDir_Input.Arg0 = fset
+	f.ParseDir_Input.Arg1 = dir
+	gate := f.parseDir_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.parseDir_rules, f.ParseDir_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0, ret1 := rule(fset, dir); ok {
+			return ret0, ret1
+		}
+	}
+	return output.Ret0, output.Ret1
+}
+
+// WaitForParseDir blocks until ParseDir has been called at least n times
+func (f *SpyParser) WaitForParseDir(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.ParseDir_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockParseDir causes calls to ParseDir to block until ReleaseParseDir is called
+func (f *SpyParser) BlockParseDir() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.parseDir_gate == nil {
+		f.parseDir_gate = make(chan struct{})
+	}
+}
+
+// ReleaseParseDir lets all calls to ParseDir blocked by BlockParseDir proceed
+func (f *SpyParser) ReleaseParseDir() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.parseDir_gate != nil {
+		close(f.parseDir_gate)
+		f.parseDir_gate = nil
+	}
+}
+
+// ParseDirReturnsWhen makes ParseDir return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to ParseDir_Output
+func (f *SpyParser) ParseDirReturnsWhen(match func(fset *token.FileSet, dir string) bool, ret0 map[string]*ast.Package, ret1 error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.parseDir_rules = append(f.parseDir_rules, func(fset *token.FileSet, dir string) (bool, map[string]*ast.Package, error) {
+		return match(fset, dir), ret0, ret1
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyParser) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyParser
+	f.ParseDir_Called = zero.ParseDir_Called
+	f.ParseDir_CallCount = zero.ParseDir_CallCount
+	f.ParseDir_Input = zero.ParseDir_Input
+	f.ParseDir_Output = zero.ParseDir_Output
+	f.parseDir_rules = zero.parseDir_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyParserSnapshot holds a copy of the calls recorded by SpyParser
+type SpyParserSnapshot struct {
+	ParseDir_Called    bool
+	ParseDir_CallCount int
+	ParseDir_Input     struct {
+		Arg0 *token.FileSet
+		Arg1 string
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyParser) Snapshot() SpyParserSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyParserSnapshot
+	snapshot.ParseDir_Called = f.ParseDir_Called
+	snapshot.ParseDir_CallCount = f.ParseDir_CallCount
+	snapshot.ParseDir_Input = f.ParseDir_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ fm.Parser = (*SpyParser)(nil)
+
+type SpyWriter struct {
+	mu              sync.Mutex
+	called          chan struct{}
+	Write_Called    bool
+	Write_CallCount int
+	Write_Input     struct {
+		Arg0 string
+		Arg1 []byte
+	}
+	Write_Output struct {
+		Ret0 error
+	}
+	write_gate  chan struct{}
+	write_rules []func(filename string, src []byte) (bool, error)
+	CallLog     []string
+}
+
+func (f *SpyWriter) Write(filename string, src []byte) error {
+	f.mu.Lock()
+	f.Write_Called = true
+	f.Write_CallCount++
+	f.CallLog = append(f.CallLog, "Write")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.Write_Input.Arg0 = filename
+	f.Write_Input.Arg1 = src
+	gate := f.write_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.write_rules, f.Write_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0 := rule(filename, src); ok {
+			return ret0
+		}
+	}
+	return output.Ret0
+}
+
+// WaitForWrite blocks until Write has been called at least n times
+func (f *SpyWriter) WaitForWrite(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Write_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockWrite causes calls to Write to block until ReleaseWrite is called
+func (f *SpyWriter) BlockWrite() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.write_gate == nil {
+		f.write_gate = make(chan struct{})
+	}
+}
+
+// ReleaseWrite lets all calls to Write blocked by BlockWrite proceed
+func (f *SpyWriter) ReleaseWrite() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.write_gate != nil {
+		close(f.write_gate)
+		f.write_gate = nil
+	}
+}
+
+// WriteReturnsWhen makes Write return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Write_Output
+func (f *SpyWriter) WriteReturnsWhen(match func(filename string, src []byte) bool, ret0 error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.write_rules = append(f.write_rules, func(filename string, src []byte) (bool, error) {
+		return match(filename, src), ret0
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyWriter) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyWriter
+	f.Write_Called = zero.Write_Called
+	f.Write_CallCount = zero.Write_CallCount
+	f.Write_Input = zero.Write_Input
+	f.Write_Output = zero.Write_Output
+	f.write_rules = zero.write_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyWriterSnapshot holds a copy of the calls recorded by SpyWriter
+type SpyWriterSnapshot struct {
+	Write_Called    bool
+	Write_CallCount int
+	Write_Input     struct {
+		Arg0 string
+		Arg1 []byte
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyWriter) Snapshot() SpyWriterSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyWriterSnapshot
+	snapshot.Write_Called = f.Write_Called
+	snapshot.Write_CallCount = f.Write_CallCount
+	snapshot.Write_Input = f.Write_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ fm.Writer = (*SpyWriter)(nil)
+
+type SpyImportWriter struct {
+	mu              sync.Mutex
+	called          chan struct{}
+	Write_Called    bool
+	Write_CallCount int
+	Write_Input     struct {
+		Arg0 string
+		Arg1 []byte
+	}
+	Write_Output struct {
+		Ret0 []byte
+		Ret1 error
+	}
+	write_gate  chan struct{}
+	write_rules []func(filename string, src []byte) (bool, []byte, error)
+	CallLog     []string
+}
+
+func (f *SpyImportWriter) Write(filename string, src []byte) ([]byte, error) {
+	f.mu.Lock()
+	f.Write_Called = true
+	f.Write_CallCount++
+	f.CallLog = append(f.CallLog, "Write")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.Write_Input.Arg0 = filename
+	f.Write_Input.Arg1 = src
+	gate := f.write_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.write_rules, f.Write_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0, ret1 := rule(filename, src); ok {
+			return ret0, ret1
+		}
+	}
+	return output.Ret0, output.Ret1
+}
+
+// WaitForWrite blocks until Write has been called at least n times
+func (f *SpyImportWriter) WaitForWrite(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Write_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockWrite causes calls to Write to block until ReleaseWrite is called
+func (f *SpyImportWriter) BlockWrite() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.write_gate == nil {
+		f.write_gate = make(chan struct{})
+	}
+}
+
+// ReleaseWrite lets all calls to Write blocked by BlockWrite proceed
+func (f *SpyImportWriter) ReleaseWrite() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.write_gate != nil {
+		close(f.write_gate)
+		f.write_gate = nil
+	}
+}
+
+// WriteReturnsWhen makes Write return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Write_Output
+func (f *SpyImportWriter) WriteReturnsWhen(match func(filename string, src []byte) bool, ret0 []byte, ret1 error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.write_rules = append(f.write_rules, func(filename string, src []byte) (bool, []byte, error) {
+		return match(filename, src), ret0, ret1
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyImportWriter) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyImportWriter
+	f.Write_Called = zero.Write_Called
+	f.Write_CallCount = zero.Write_CallCount
+	f.Write_Input = zero.Write_Input
+	f.Write_Output = zero.Write_Output
+	f.write_rules = zero.write_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyImportWriterSnapshot holds a copy of the calls recorded by SpyImportWriter
+type SpyImportWriterSnapshot struct {
+	Write_Called    bool
+	Write_CallCount int
+	Write_Input     struct {
+		Arg0 string
+		Arg1 []byte
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyImportWriter) Snapshot() SpyImportWriterSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyImportWriterSnapshot
+	snapshot.Write_Called = f.Write_Called
+	snapshot.Write_CallCount = f.Write_CallCount
+	snapshot.Write_Input = f.Write_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ fm.ImportWriter = (*SpyImportWriter)(nil)
+
+type SpyChecker struct {
+	mu              sync.Mutex
+	called          chan struct{}
+	Check_Called    bool
+	Check_CallCount int
+	Check_Input     struct {
+		Arg0 string
+		Arg1 map[string][]byte
+	}
+	Check_Output struct {
+		Ret0 error
+	}
+	check_gate  chan struct{}
+	check_rules []func(dir string, srcs map[string][]byte) (bool, error)
+	CallLog     []string
+}
+
+func (f *SpyChecker) Check(dir string, srcs map[string][]byte) error {
+	f.mu.Lock()
+	f.Check_Called = true
+	f.Check_CallCount++
+	f.CallLog = append(f.CallLog, "Check")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.Check_Input.Arg0 = dir
+	f.Check_Input.Arg1 = srcs
+	gate := f.check_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.check_rules, f.Check_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0 := rule(dir, srcs); ok {
+			return ret0
+		}
+	}
+	return output.Ret0
+}
+
+// WaitForCheck blocks until Check has been called at least n times
+func (f *SpyChecker) WaitForCheck(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Check_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockCheck causes calls to Check to block until ReleaseCheck is called
+func (f *SpyChecker) BlockCheck() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.check_gate == nil {
+		f.check_gate = make(chan struct{})
+	}
+}
+
+// ReleaseCheck lets all calls to Check blocked by BlockCheck proceed
+func (f *SpyChecker) ReleaseCheck() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.check_gate != nil {
+		close(f.check_gate)
+		f.check_gate = nil
+	}
+}
+
+// CheckReturnsWhen makes Check return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Check_Output
+func (f *SpyChecker) CheckReturnsWhen(match func(dir string, srcs map[string][]byte) bool, ret0 error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.check_rules = append(f.check_rules, func(dir string, srcs map[string][]byte) (bool, error) {
+		return match(dir, srcs), ret0
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyChecker) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyChecker
+	f.Check_Called = zero.Check_Called
+	f.Check_CallCount = zero.Check_CallCount
+	f.Check_Input = zero.Check_Input
+	f.Check_Output = zero.Check_Output
+	f.check_rules = zero.check_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyCheckerSnapshot holds a copy of the calls recorded by SpyChecker
+type SpyCheckerSnapshot struct {
+	Check_Called    bool
+	Check_CallCount int
+	Check_Input     struct {
+		Arg0 string
+		Arg1 map[string][]byte
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyChecker) Snapshot() SpyCheckerSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyCheckerSnapshot
+	snapshot.Check_Called = f.Check_Called
+	snapshot.Check_CallCount = f.Check_CallCount
+	snapshot.Check_Input = f.Check_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ fm.Checker = (*SpyChecker)(nil)
+
 type SpyStructConverter struct {
-	mu             sync.Mutex
-	Convert_Called bool
-	Convert_Input  struct {
+	mu                sync.Mutex
+	called            chan struct{}
+	Convert_Called    bool
+	Convert_CallCount int
+	Convert_Input     struct {
 		Arg0 *ast.TypeSpec
 		Arg1 *ast.InterfaceType
 	}
 	Convert_Output struct {
 		Ret0 *ast.TypeSpec
 	}
+	convert_gate  chan struct{}
+	convert_rules []func(t *ast.TypeSpec, i *ast.InterfaceType) (bool, *ast.TypeSpec)
+	CallLog       []string
 }
 
 func (f *SpyStructConverter) Convert(t *ast.TypeSpec, i *ast.InterfaceType) *ast.TypeSpec {
 	f.mu.Lock()
-	defer f.mu.Unlock()
 	f.Convert_Called = true
+	f.Convert_CallCount++
+	f.CallLog = append(f.CallLog, "Convert")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
 	f.Convert_Input.Arg0 = t
 	f.Convert_Input.Arg1 = i
-	return f.Convert_Output.Ret0
+	gate := f.convert_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.convert_rules, f.Convert_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0 := rule(t, i); ok {
+			return ret0
+		}
+	}
+	return output.Ret0
+}
+
+// WaitForConvert blocks until Convert has been called at least n times
+func (f *SpyStructConverter) WaitForConvert(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Convert_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockConvert causes calls to Convert to block until ReleaseConvert is called
+func (f *SpyStructConverter) BlockConvert() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.convert_gate == nil {
+		f.convert_gate = make(chan struct{})
+	}
+}
+
+// ReleaseConvert lets all calls to Convert blocked by BlockConvert proceed
+func (f *SpyStructConverter) ReleaseConvert() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.convert_gate != nil {
+		close(f.convert_gate)
+		f.convert_gate = nil
+	}
+}
+
+// ConvertReturnsWhen makes Convert return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Convert_Output
+func (f *SpyStructConverter) ConvertReturnsWhen(match func(t *ast.TypeSpec, i *ast.InterfaceType) bool, ret0 *ast.TypeSpec) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.convert_rules = append(f.convert_rules, func(t *ast.TypeSpec, i *ast.InterfaceType) (bool, *ast.TypeSpec) {
+		return match(t, i), ret0
+	})
 }
 
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyStructConverter) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyStructConverter
+	f.Convert_Called = zero.Convert_Called
+	f.Convert_CallCount = zero.Convert_CallCount
+	f.Convert_Input = zero.Convert_Input
+	f.Convert_Output = zero.Convert_Output
+	f.convert_rules = zero.convert_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyStructConverterSnapshot holds a copy of the calls recorded by SpyStructConverter
+type SpyStructConverterSnapshot struct {
+	Convert_Called    bool
+	Convert_CallCount int
+	Convert_Input     struct {
+		Arg0 *ast.TypeSpec
+		Arg1 *ast.InterfaceType
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyStructConverter) Snapshot() SpyStructConverterSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyStructConverterSnapshot
+	snapshot.Convert_Called = f.Convert_Called
+	snapshot.Convert_CallCount = f.Convert_CallCount
+	snapshot.Convert_Input = f.Convert_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ fm.StructConverter = (*SpyStructConverter)(nil)
+
 type SpyFuncImplementer struct {
-	mu               sync.Mutex
-	Implement_Called bool
-	Implement_Input  struct {
+	mu                  sync.Mutex
+	called              chan struct{}
+	Implement_Called    bool
+	Implement_CallCount int
+	Implement_Input     struct {
 		Arg0 *ast.Ident
 		Arg1 *ast.InterfaceType
 	}
 	Implement_Output struct {
 		Ret0 []*ast.FuncDecl
 	}
+	implement_gate  chan struct{}
+	implement_rules []func(name *ast.Ident, i *ast.InterfaceType) (bool, []*ast.FuncDecl)
+	CallLog         []string
 }
 
 func (f *SpyFuncImplementer) Implement(name *ast.Ident, i *ast.InterfaceType) []*ast.FuncDecl {
 	f.mu.Lock()
-	defer f.mu.Unlock()
 	f.Implement_Called = true
+	f.Implement_CallCount++
+	f.CallLog = append(f.CallLog, "Implement")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
 	f.Implement_Input.Arg0 = name
 	f.Implement_Input.Arg1 = i
-	return f.Implement_Output.Ret0
+	gate := f.implement_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.implement_rules, f.Implement_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0 := rule(name, i); ok {
+			return ret0
+		}
+	}
+	return output.Ret0
 }
 
-type SpyDeclGenerator struct {
-	mu              sync.Mutex
-	Generate_Called bool
-	Generate_Input  struct {
-		Arg0 []ast.Decl
+// WaitForImplement blocks until Implement has been called at least n times
+func (f *SpyFuncImplementer) WaitForImplement(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.Implement_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	Generate_Output struct {
-		Ret0 []ast.Decl
+}
+
+// BlockImplement causes calls to Implement to block until ReleaseImplement is called
+func (f *SpyFuncImplementer) BlockImplement() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.implement_gate == nil {
+		f.implement_gate = make(chan struct{})
 	}
 }
 
-func (f *SpyDeclGenerator) Generate(ds []ast.Decl) []ast.Decl {
+// ReleaseImplement lets all calls to Implement blocked by BlockImplement proceed
+func (f *SpyFuncImplementer) ReleaseImplement() {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	f.Generate_Called = true
-	f.Generate_Input.Arg0 = ds
-	return f.Generate_Output.Ret0
+	if f.implement_gate != nil {
+		close(f.implement_gate)
+		f.implement_gate = nil
+	}
 }
 
-type SpyParser struct {
-	mu              sync.Mutex
-	ParseDir_Called bool
-	ParseDir_Input  struct {
-		Arg0 string
+// ImplementReturnsWhen makes Implement return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to Implement_Output
+func (f *SpyFuncImplementer) ImplementReturnsWhen(match func(name *ast.Ident, i *ast.InterfaceType) bool, ret0 []*ast.FuncDecl) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.implement_rules = append(f.implement_rules, func(name *ast.Ident, i *ast.InterfaceType) (bool, []*ast.FuncDecl) {
+		return match(name, i), ret0
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyFuncImplementer) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyFuncImplementer
+	f.Implement_Called = zero.Implement_Called
+	f.Implement_CallCount = zero.Implement_CallCount
+	f.Implement_Input = zero.Implement_Input
+	f.Implement_Output = zero.Implement_Output
+	f.implement_rules = zero.implement_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyFuncImplementerSnapshot holds a copy of the calls recorded by SpyFuncImplementer
+type SpyFuncImplementerSnapshot struct {
+	Implement_Called    bool
+	Implement_CallCount int
+	Implement_Input     struct {
+		Arg0 *ast.Ident
+		Arg1 *ast.InterfaceType
 	}
-	ParseDir_Output struct {
-		Ret0 map[string]*ast.Package
-		Ret1 error
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyFuncImplementer) Snapshot() SpyFuncImplementerSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyFuncImplementerSnapshot
+	snapshot.Implement_Called = f.Implement_Called
+	snapshot.Implement_CallCount = f.Implement_CallCount
+	snapshot.Implement_Input = f.Implement_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
+}
+
+var _ fm.FuncImplementer = (*SpyFuncImplementer)(nil)
+
+type SpyFuncTypeConverter struct {
+	mu                        sync.Mutex
+	called                    chan struct{}
+	ConvertFuncType_Called    bool
+	ConvertFuncType_CallCount int
+	ConvertFuncType_Input     struct {
+		Arg0 *ast.TypeSpec
+		Arg1 *ast.InterfaceType
+	}
+	ConvertFuncType_Output struct {
+		Ret0 *ast.TypeSpec
 	}
+	convertFuncType_gate  chan struct{}
+	convertFuncType_rules []func(t *ast.TypeSpec, i *ast.InterfaceType) (bool, *ast.TypeSpec)
+	CallLog               []string
 }
 
-func (f *SpyParser) ParseDir(dir string) (map[string]*ast.Package, error) {
+func (f *SpyFuncTypeConverter) ConvertFuncType(t *ast.TypeSpec, i *ast.InterfaceType) *ast.TypeSpec {
+	f.mu.Lock()
+	f.ConvertFuncType_Called = true
+	f.ConvertFuncType_CallCount++
+	f.CallLog = append(f.CallLog, "ConvertFuncType")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.ConvertFuncType_Input.Arg0 = t
+	f.ConvertFuncType_Input.Arg1 = i
+	gate := f.convertFuncType_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.convertFuncType_rules, f.ConvertFuncType_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0 := rule(t, i); ok {
+			return ret0
+		}
+	}
+	return output.Ret0
+}
+
+// WaitForConvertFuncType blocks until ConvertFuncType has been called at least n times
+func (f *SpyFuncTypeConverter) WaitForConvertFuncType(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.ConvertFuncType_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockConvertFuncType causes calls to ConvertFuncType to block until ReleaseConvertFuncType is called
+func (f *SpyFuncTypeConverter) BlockConvertFuncType() {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	f.ParseDir_Called = true
-	f.ParseDir_Input.Arg0 = dir
-	return f.ParseDir_Output.Ret0, f.ParseDir_Output.Ret1
+	if f.convertFuncType_gate == nil {
+		f.convertFuncType_gate = make(chan struct{})
+	}
 }
 
-type SpyWriter struct {
-	mu           sync.Mutex
-	Write_Called bool
-	Write_Input  struct {
-		Arg0 *ast.File
-		Arg1 string
+// ReleaseConvertFuncType lets all calls to ConvertFuncType blocked by BlockConvertFuncType proceed
+func (f *SpyFuncTypeConverter) ReleaseConvertFuncType() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.convertFuncType_gate != nil {
+		close(f.convertFuncType_gate)
+		f.convertFuncType_gate = nil
 	}
-	Write_Output struct {
-		Ret0 error
+}
+
+// ConvertFuncTypeReturnsWhen makes ConvertFuncType return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to ConvertFuncType_Output
+func (f *SpyFuncTypeConverter) ConvertFuncTypeReturnsWhen(match func(t *ast.TypeSpec, i *ast.InterfaceType) bool, ret0 *ast.TypeSpec) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.convertFuncType_rules = append(f.convertFuncType_rules, func(t *ast.TypeSpec, i *ast.InterfaceType) (bool, *ast.TypeSpec) {
+		return match(t, i), ret0
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyFuncTypeConverter) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyFuncTypeConverter
+	f.ConvertFuncType_Called = zero.ConvertFuncType_Called
+	f.ConvertFuncType_CallCount = zero.ConvertFuncType_CallCount
+	f.ConvertFuncType_Input = zero.ConvertFuncType_Input
+	f.ConvertFuncType_Output = zero.ConvertFuncType_Output
+	f.convertFuncType_rules = zero.convertFuncType_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyFuncTypeConverterSnapshot holds a copy of the calls recorded by SpyFuncTypeConverter
+type SpyFuncTypeConverterSnapshot struct {
+	ConvertFuncType_Called    bool
+	ConvertFuncType_CallCount int
+	ConvertFuncType_Input     struct {
+		Arg0 *ast.TypeSpec
+		Arg1 *ast.InterfaceType
 	}
+	CallLog []string
 }
 
-func (f *SpyWriter) Write(file *ast.File, filename string) error {
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyFuncTypeConverter) Snapshot() SpyFuncTypeConverterSnapshot {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	f.Write_Called = true
-	f.Write_Input.Arg0 = file
-	f.Write_Input.Arg1 = filename
-	return f.Write_Output.Ret0
+	var snapshot SpyFuncTypeConverterSnapshot
+	snapshot.ConvertFuncType_Called = f.ConvertFuncType_Called
+	snapshot.ConvertFuncType_CallCount = f.ConvertFuncType_CallCount
+	snapshot.ConvertFuncType_Input = f.ConvertFuncType_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
 }
 
-type SpyImportWriter struct {
-	mu           sync.Mutex
-	Write_Called bool
-	Write_Input  struct {
-		Arg0 string
+var _ fm.FuncTypeConverter = (*SpyFuncTypeConverter)(nil)
+
+type SpyFuncTypeImplementer struct {
+	mu                          sync.Mutex
+	called                      chan struct{}
+	ImplementFuncType_Called    bool
+	ImplementFuncType_CallCount int
+	ImplementFuncType_Input     struct {
+		Arg0 *ast.Ident
+		Arg1 *ast.InterfaceType
 	}
-	Write_Output struct {
-		Ret0 error
+	ImplementFuncType_Output struct {
+		Ret0 []*ast.FuncDecl
 	}
+	implementFuncType_gate  chan struct{}
+	implementFuncType_rules []func(name *ast.Ident, i *ast.InterfaceType) (bool, []*ast.FuncDecl)
+	CallLog                 []string
 }
 
-func (f *SpyImportWriter) Write(filename string) error {
+func (f *SpyFuncTypeImplementer) ImplementFuncType(name *ast.Ident, i *ast.InterfaceType) []*ast.FuncDecl {
+	f.mu.Lock()
+	f.ImplementFuncType_Called = true
+	f.ImplementFuncType_CallCount++
+	f.CallLog = append(f.CallLog, "ImplementFuncType")
+	if f.called != nil {
+		close(f.called)
+		f.called = nil
+	}
+	f.ImplementFuncType_Input.Arg0 = name
+	f.ImplementFuncType_Input.Arg1 = i
+	gate := f.implementFuncType_gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	rules, output := f.implementFuncType_rules, f.ImplementFuncType_Output
+	f.mu.Unlock()
+	for _, rule := range rules {
+		if ok, ret0 := rule(name, i); ok {
+			return ret0
+		}
+	}
+	return output.Ret0
+}
+
+// WaitForImplementFuncType blocks until ImplementFuncType has been called at least n times
+func (f *SpyFuncTypeImplementer) WaitForImplementFuncType(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		if f.ImplementFuncType_CallCount >= n {
+			f.mu.Unlock()
+			return nil
+		}
+		if f.called == nil {
+			f.called = make(chan struct{})
+		}
+		called := f.called
+		f.mu.Unlock()
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BlockImplementFuncType causes calls to ImplementFuncType to block until ReleaseImplementFuncType is called
+func (f *SpyFuncTypeImplementer) BlockImplementFuncType() {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	f.Write_Called = true
-	f.Write_Input.Arg0 = filename
-	return f.Write_Output.Ret0
+	if f.implementFuncType_gate == nil {
+		f.implementFuncType_gate = make(chan struct{})
+	}
+}
+
+// ReleaseImplementFuncType lets all calls to ImplementFuncType blocked by BlockImplementFuncType proceed
+func (f *SpyFuncTypeImplementer) ReleaseImplementFuncType() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.implementFuncType_gate != nil {
+		close(f.implementFuncType_gate)
+		f.implementFuncType_gate = nil
+	}
+}
+
+// ImplementFuncTypeReturnsWhen makes ImplementFuncType return the given values when match reports true
+// for its arguments. Rules apply in the order added, falling back to ImplementFuncType_Output
+func (f *SpyFuncTypeImplementer) ImplementFuncTypeReturnsWhen(match func(name *ast.Ident, i *ast.InterfaceType) bool, ret0 []*ast.FuncDecl) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.implementFuncType_rules = append(f.implementFuncType_rules, func(name *ast.Ident, i *ast.InterfaceType) (bool, []*ast.FuncDecl) {
+		return match(name, i), ret0
+	})
+}
+
+// Reset clears the calls recorded so far along with the configured results,
+// so that the spy may be reused. Calls which are blocked stay blocked
+func (f *SpyFuncTypeImplementer) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero SpyFuncTypeImplementer
+	f.ImplementFuncType_Called = zero.ImplementFuncType_Called
+	f.ImplementFuncType_CallCount = zero.ImplementFuncType_CallCount
+	f.ImplementFuncType_Input = zero.ImplementFuncType_Input
+	f.ImplementFuncType_Output = zero.ImplementFuncType_Output
+	f.implementFuncType_rules = zero.implementFuncType_rules
+	f.CallLog = zero.CallLog
+}
+
+// SpyFuncTypeImplementerSnapshot holds a copy of the calls recorded by SpyFuncTypeImplementer
+type SpyFuncTypeImplementerSnapshot struct {
+	ImplementFuncType_Called    bool
+	ImplementFuncType_CallCount int
+	ImplementFuncType_Input     struct {
+		Arg0 *ast.Ident
+		Arg1 *ast.InterfaceType
+	}
+	CallLog []string
+}
+
+// Snapshot returns a copy of the calls recorded so far, which is safe
+// to inspect while calls are still being made
+func (f *SpyFuncTypeImplementer) Snapshot() SpyFuncTypeImplementerSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshot SpyFuncTypeImplementerSnapshot
+	snapshot.ImplementFuncType_Called = f.ImplementFuncType_Called
+	snapshot.ImplementFuncType_CallCount = f.ImplementFuncType_CallCount
+	snapshot.ImplementFuncType_Input = f.ImplementFuncType_Input
+	snapshot.CallLog = append([]string(nil), f.CallLog...)
+	return snapshot
 }
+
+var _ fm.FuncTypeImplementer = (*SpyFuncTypeImplementer)(nil)
@@ -1,6 +1,12 @@
 package fm
 
-import "go/ast"
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
 
 // StructConverter converts an interface type into a struct
 type StructConverter interface {
@@ -13,6 +19,20 @@ type FuncImplementer interface {
 	Implement(name *ast.Ident, i *ast.InterfaceType) []*ast.FuncDecl
 }
 
+// FuncTypeConverter is implemented by a StructConverter which converts
+// named func types, passed as an interface with a single method named
+// after the type, other than interfaces
+type FuncTypeConverter interface {
+	ConvertFuncType(t *ast.TypeSpec, i *ast.InterfaceType) *ast.TypeSpec
+}
+
+// FuncTypeImplementer is implemented by a FuncImplementer which
+// implements the method standing in for a named func type other than
+// the methods of interfaces
+type FuncTypeImplementer interface {
+	ImplementFuncType(name *ast.Ident, i *ast.InterfaceType) []*ast.FuncDecl
+}
+
 // SpyGenerator creates spy implementations of interface declarations
 type SpyGenerator struct {
 	Converter   StructConverter
@@ -20,41 +40,293 @@ type SpyGenerator struct {
 }
 
 // Generate transforms all the interfaces in the list of declarations
-// into spies in the form of structs with implemented functions
-func (g *SpyGenerator) Generate(ds []ast.Decl) []ast.Decl {
+// into spies in the form of structs with implemented functions, each
+// of which may be reset and inspected through a snapshot
+func (g *SpyGenerator) Generate(ds []ast.Decl) ([]ast.Decl, []Diagnostic) {
+	decls, diags := generate(ds, g.Converter, g.Implementer)
+	return withResets(decls), diags
+}
+
+// generate converts all the interfaces in the list of declarations into
+// structs and implements their functions on the resulting structs
+func generate(ds []ast.Decl, c StructConverter, i FuncImplementer) ([]ast.Decl, []Diagnostic) {
 	var decls []ast.Decl
+	interfaces, diags := findInterfaces(ds)
+	for _, found := range interfaces {
+		typeSpec := found.spec
+		interfaceType := typeSpec.Type.(*ast.InterfaceType)
+
+		var structTypeSpec *ast.TypeSpec
+		if fc, ok := c.(FuncTypeConverter); ok && found.fn {
+			structTypeSpec = fc.ConvertFuncType(typeSpec, interfaceType)
+		} else {
+			structTypeSpec = c.Convert(typeSpec, interfaceType)
+		}
+		if found.name != "" {
+			structTypeSpec.Name = ast.NewIdent(found.name)
+		}
+		decls = append(decls, &ast.GenDecl{
+			Tok:   token.TYPE,
+			Specs: []ast.Spec{structTypeSpec},
+		})
+
+		var funcDecls []*ast.FuncDecl
+		if fi, ok := i.(FuncTypeImplementer); ok && found.fn {
+			funcDecls = fi.ImplementFuncType(structTypeSpec.Name, interfaceType)
+		} else {
+			funcDecls = i.Implement(structTypeSpec.Name, interfaceType)
+		}
+		for _, fd := range funcDecls {
+			decls = append(decls, fd)
+		}
+
+		decls = append(decls, found.assertion(structTypeSpec.Name.Name))
+	}
+
+	return decls, diags
+}
+
+// foundInterface is an interface to generate a test double for
+type foundInterface struct {
+	spec *ast.TypeSpec
+	// name overrides the name of the generated type when set
+	name string
+	// fn marks an interface standing in for a named func type
+	fn bool
+}
+
+// assertion returns the compile-time assertion that the generated type
+// implements the interface or, for a func type, provides it as a method
+func (found foundInterface) assertion(structName string) ast.Decl {
+	if found.fn {
+		return funcAssertionDecl(found.spec.Name.Name, structName)
+	}
+	return assertionDecl(found.spec.Name.Name, structName)
+}
+
+// doubledType reports whether test doubles are generated for the type:
+// interfaces, and named func types such as type Clock func() time.Time
+func doubledType(t *ast.TypeSpec) bool {
+	switch t.Type.(type) {
+	case *ast.InterfaceType, *ast.FuncType:
+		return true
+	}
+	return false
+}
+
+// methodsOf returns the methods of the interface, or the single method,
+// named after the type, which stands in for the func type
+func methodsOf(t *ast.TypeSpec) []*ast.Field {
+	switch typ := t.Type.(type) {
+	case *ast.InterfaceType:
+		return typ.Methods.List
+	case *ast.FuncType:
+		return []*ast.Field{{Names: []*ast.Ident{ast.NewIdent(t.Name.Name)}, Type: typ}}
+	}
+	return nil
+}
+
+// funcInterface returns a copy of the func type's spec as an interface
+// with a single method named after the type, e.g., Clock() time.Time for
+// Clock, so that test doubles provide the func as a method value
+func funcInterface(t *ast.TypeSpec) *ast.TypeSpec {
+	copied := *t
+	copied.Type = &ast.InterfaceType{Methods: &ast.FieldList{List: methodsOf(t)}}
+	return &copied
+}
+
+// findInterfaces returns copies of the type specs of all interfaces
+// declared in the list of declarations, including those grouped within
+// a single declaration, along with diagnostics for unsupported interfaces
+// and unknown directives. Named func types are returned as interfaces with
+// a single method. Interfaces marked with //fm:skip are left out.
+func findInterfaces(ds []ast.Decl) ([]foundInterface, []Diagnostic) {
+	var found []foundInterface
+	var diags []Diagnostic
 	for _, d := range ds {
 		genDecl, ok := d.(*ast.GenDecl)
 		if !ok {
 			continue
 		}
 
-		if len(genDecl.Specs) != 1 {
-			continue // TODO: would this ever happen?
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+
+			if !doubledType(typeSpec) {
+				continue
+			}
+
+			dirs, dirDiags := parseDirectives(genDecl.Doc, typeSpec.Doc)
+			diags = append(diags, dirDiags...)
+			if dirs.skip {
+				continue
+			}
+
+			if diag, ok := unsupported(typeSpec); !ok {
+				diags = append(diags, diag)
+				continue
+			}
+
+			typeSpec = stripPos(typeSpec).(*ast.TypeSpec)
+			_, fn := typeSpec.Type.(*ast.FuncType)
+			if fn {
+				typeSpec = funcInterface(typeSpec)
+			}
+			nameParams(typeSpec.Type.(*ast.InterfaceType))
+			renameReceiverClashes(typeSpec.Type.(*ast.InterfaceType))
+			found = append(found, foundInterface{spec: typeSpec, name: dirs.name, fn: fn})
+		}
+	}
+
+	return found, diags
+}
+
+// unsupported returns a diagnostic and false when the interface
+// cannot be implemented by the generators
+func unsupported(t *ast.TypeSpec) (Diagnostic, bool) {
+	if params := typeParams(t); len(params) > 0 {
+		message := fmt.Sprintf("skipped generic %s %s; instantiate it with -iface", typeKind(t), t.Name.Name)
+		// suggest an instantiation only when every constraint is
+		// satisfied by a predeclared type
+		if args, ok := placeholders(t.TypeParams); ok {
+			message += fmt.Sprintf(", e.g., %s[%s]", t.Name.Name, strings.Join(args, ", "))
 		}
+		return Diagnostic{Pos: t.Pos(), Message: message}, false
+	}
 
-		spec := genDecl.Specs[0]
-		typeSpec, ok := spec.(*ast.TypeSpec)
-		if !ok {
+	for _, field := range methodsOf(t) {
+		if len(field.Names) > 0 {
 			continue
 		}
+		switch embedded := field.Type.(type) {
+		case *ast.Ident, *ast.SelectorExpr:
+			return Diagnostic{
+				Pos:     field.Pos(),
+				Message: fmt.Sprintf("skipped interface %s: embedded interface %s is not supported", t.Name.Name, types.ExprString(embedded)),
+			}, false
+		default:
+			return Diagnostic{
+				Pos:     field.Pos(),
+				Message: fmt.Sprintf("skipped constraint interface %s", t.Name.Name),
+			}, false
+		}
+	}
 
-		interfaceType, ok := typeSpec.Type.(*ast.InterfaceType)
+	return Diagnostic{}, true
+}
+
+// placeholders returns a predeclared type satisfying the constraint of
+// each type parameter, e.g., int for any and string for ~string, or false
+// when a constraint is beyond a union of predeclared types, e.g., one
+// declaring methods or referring to another type parameter
+func placeholders(params *ast.FieldList) ([]string, bool) {
+	var args []string
+	for _, field := range params.List {
+		arg, ok := placeholder(field.Type)
 		if !ok {
-			continue
+			return nil, false
 		}
+		for range field.Names {
+			args = append(args, arg)
+		}
+	}
+	return args, true
+}
 
-		structTypeSpec := g.Converter.Convert(typeSpec, interfaceType)
-		decls = append(decls, &ast.GenDecl{
-			Tok:   genDecl.Tok,
-			Specs: []ast.Spec{structTypeSpec},
-		})
+// placeholder returns a predeclared type satisfying the constraint
+func placeholder(constraint ast.Expr) (string, bool) {
+	switch c := constraint.(type) {
+	case *ast.Ident:
+		switch obj := types.Universe.Lookup(c.Name).(type) {
+		case *types.TypeName:
+			if _, ok := obj.Type().Underlying().(*types.Interface); !ok {
+				return c.Name, true
+			}
+			if c.Name == "any" || c.Name == "comparable" {
+				return "int", true
+			}
+		}
+	case *ast.UnaryExpr:
+		// ~string is satisfied by string itself
+		if c.Op == token.TILDE {
+			return placeholder(c.X)
+		}
+	case *ast.BinaryExpr:
+		// any term satisfies a union
+		if c.Op == token.OR {
+			return placeholder(c.X)
+		}
+	case *ast.ParenExpr:
+		return placeholder(c.X)
+	case *ast.InterfaceType:
+		switch len(c.Methods.List) {
+		case 0:
+			return "int", true
+		case 1:
+			// e.g., interface{ ~int | ~string }
+			if field := c.Methods.List[0]; len(field.Names) == 0 {
+				return placeholder(field.Type)
+			}
+		}
+	}
+	return "", false
+}
 
-		funcDecls := g.Implementer.Implement(structTypeSpec.Name, interfaceType)
-		for _, fd := range funcDecls {
-			decls = append(decls, fd)
+// typeKind describes the kind of the type, i.e., interface or func type
+func typeKind(t *ast.TypeSpec) string {
+	if _, ok := t.Type.(*ast.FuncType); ok {
+		return "func type"
+	}
+	return "interface"
+}
+
+// nameParams names the unnamed and blank parameters of the interface's
+// methods, e.g., Do(string, int) becomes Do(arg0 string, arg1 int),
+// so that generated implementations may refer to them
+func nameParams(i *ast.InterfaceType) {
+	for _, field := range i.Methods.List {
+		funcType, ok := field.Type.(*ast.FuncType)
+		if !ok || funcType.Params == nil {
+			continue
+		}
+		idx := 0
+		for _, f := range funcType.Params.List {
+			if len(f.Names) == 0 {
+				f.Names = []*ast.Ident{ast.NewIdent("")}
+			}
+			for _, n := range f.Names {
+				if n.Name == "" || n.Name == "_" {
+					n.Name = uniqueName(fmt.Sprintf("%s%d", strings.ToLower(argPrefix), idx), funcType)
+				}
+				idx++
+			}
 		}
 	}
+}
 
-	return decls
+// renameReceiverClashes renames the parameters and results of the
+// interface's methods which would shadow the receiver of a generated
+// implementation
+func renameReceiverClashes(i *ast.InterfaceType) {
+	for _, field := range i.Methods.List {
+		funcType, ok := field.Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+		for _, list := range []*ast.FieldList{funcType.Params, funcType.Results} {
+			if list == nil {
+				continue
+			}
+			for _, f := range list.List {
+				for _, n := range f.Names {
+					if n.Name == recvName {
+						n.Name = uniqueName(recvName, funcType)
+					}
+				}
+			}
+		}
+	}
 }
@@ -3,24 +3,32 @@ package fm_test
 import (
 	"go/ast"
 	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
 	"testing"
 
 	fm "github.com/enocom/fm/lib"
 )
 
 // TestGenerateReturnsSliceOfSpyDecls ensures the generator produces
-// two declarations for a single interface with a single method:
-// 1) a struct with fields to store the result of a function call, and
-// 2) a spy implementation of the interface's single method.
+// nine declarations for a single interface with a single method:
+// 1) a struct with fields to store the result of a function call,
+// 2) a spy implementation of the interface's single method,
+// 3) a function to wait for calls to that method,
+// 4) functions to block and release calls to that method,
+// 5) a function to reset the spy,
+// 6) a snapshot type and a function returning a snapshot, and
+// 7) an assertion that the spy implements the interface.
 func TestGenerateReturnsSliceOfSpyDecls(t *testing.T) {
 	gen := &fm.SpyGenerator{
 		Converter:   &fm.SpyStructConverter{},
 		Implementer: &fm.SpyFuncImplementer{},
 	}
 	interfaceDecls := buildInterfaceAST()
-	spyDecls := gen.Generate(interfaceDecls)
+	spyDecls, _ := gen.Generate(interfaceDecls)
 
-	want := 2
+	want := 9
 	got := len(spyDecls)
 
 	if want != got {
@@ -35,7 +43,7 @@ func TestGenerateSkipsDeclsThatAreNotGenDecls(t *testing.T) {
 		Implementer: &fm.SpyFuncImplementer{},
 	}
 	decls := buildFuncDeclAST()
-	spyDecls := gen.Generate(decls)
+	spyDecls, _ := gen.Generate(decls)
 
 	want := 0
 	got := len(spyDecls)
@@ -52,7 +60,7 @@ func TestGenerateSkipsSpecsThatAreNotTypeSpecs(t *testing.T) {
 		Implementer: &fm.SpyFuncImplementer{},
 	}
 	decls := buildValueSpecAST()
-	spyDecls := gen.Generate(decls)
+	spyDecls, _ := gen.Generate(decls)
 
 	want := 0
 	got := len(spyDecls)
@@ -69,7 +77,7 @@ func TestGenerateSkipsTypeSpecsThatAreNotInterfaceTypes(t *testing.T) {
 		Implementer: &fm.SpyFuncImplementer{},
 	}
 	decls := buildStructAST()
-	spyDecls := gen.Generate(decls)
+	spyDecls, _ := gen.Generate(decls)
 
 	want := 0
 	got := len(spyDecls)
@@ -82,7 +90,7 @@ func TestGenerateSkipsTypeSpecsThatAreNotInterfaceTypes(t *testing.T) {
 func TestGenerateReturnsEmptySliceForNoInput(t *testing.T) {
 	gen := &fm.SpyGenerator{}
 
-	result := gen.Generate(make([]ast.Decl, 0))
+	result, _ := gen.Generate(make([]ast.Decl, 0))
 
 	want := 0
 	got := len(result)
@@ -186,3 +194,204 @@ func buildValueSpecAST() []ast.Decl {
 
 	return decls
 }
+
+// TestGenerateNamesUnnamedParams ensures implementations can refer
+// to every argument
+func TestGenerateNamesUnnamedParams(t *testing.T) {
+	gen := &fm.SpyGenerator{
+		Converter:   &fm.SpyStructConverter{},
+		Implementer: &fm.SpyFuncImplementer{},
+	}
+	spyDecls, _ := gen.Generate(parseDecls(t, `package sample
+
+type Doer interface {
+	Do(string, int) error
+}`))
+
+	funcDecl := spyDecls[1].(*ast.FuncDecl)
+	var names []string
+	for _, field := range funcDecl.Type.Params.List {
+		for _, n := range field.Names {
+			names = append(names, n.Name)
+		}
+	}
+
+	want := "arg0 arg1"
+	got := strings.Join(names, " ")
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestGenerateRenamesParamsClashingWithReceiver ensures arguments
+// do not shadow the receiver of the implementation
+func TestGenerateRenamesParamsClashingWithReceiver(t *testing.T) {
+	gen := &fm.SpyGenerator{
+		Converter:   &fm.SpyStructConverter{},
+		Implementer: &fm.SpyFuncImplementer{},
+	}
+	spyDecls, _ := gen.Generate(parseDecls(t, `package sample
+
+type Walker interface {
+	Walk(f func() bool)
+}`))
+
+	funcDecl := spyDecls[1].(*ast.FuncDecl)
+
+	want := "f_"
+	got := funcDecl.Type.Params.List[0].Names[0].Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestGenerateReportsUnsupportedInterfaces ensures skipped interfaces
+// are reported with their position
+func TestGenerateReportsUnsupportedInterfaces(t *testing.T) {
+	gen := &fm.SpyGenerator{
+		Converter:   &fm.SpyStructConverter{},
+		Implementer: &fm.SpyFuncImplementer{},
+	}
+	decls := parseDecls(t, `package sample
+
+type (
+	Doer interface {
+		Do() error
+	}
+
+	Number interface {
+		~int | ~float64
+	}
+)`)
+	spyDecls, diags := gen.Generate(decls)
+
+	want := 10 // spy declarations for Doer only
+	got := len(spyDecls)
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if len(diags) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(diags))
+	}
+
+	wantMessage := "skipped constraint interface Number"
+	gotMessage := diags[0].Message
+
+	if wantMessage != gotMessage {
+		t.Errorf("want %v, got %v", wantMessage, gotMessage)
+	}
+
+	if !diags[0].Pos.IsValid() {
+		t.Error("want a valid position, got none")
+	}
+}
+
+// TestGenerateFollowsDirectives ensures interfaces marked //fm:skip are
+// left out, //fm:name renames the spy, and unknown directives are reported
+func TestGenerateFollowsDirectives(t *testing.T) {
+	gen := &fm.SpyGenerator{
+		Converter:   &fm.SpyStructConverter{},
+		Implementer: &fm.SpyFuncImplementer{},
+	}
+	spyDecls, diags := gen.Generate(parseDecls(t, `package sample
+
+//fm:skip
+type Skipped interface {
+	Do()
+}
+
+type (
+	// Store keeps things
+	//fm:name FakeStore
+	Store interface {
+		Put()
+	}
+)
+
+//fm:frobnicate
+type Doer interface {
+	Do()
+}`))
+
+	var names []string
+	for _, d := range spyDecls {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		names = append(names, genDecl.Specs[0].(*ast.TypeSpec).Name.Name)
+	}
+
+	want := "FakeStore FakeStoreSnapshot SpyDoer SpyDoerSnapshot"
+	got := strings.Join(names, " ")
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if len(diags) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(diags))
+	}
+
+	wantMessage := "unknown directive //fm:frobnicate"
+	gotMessage := diags[0].Message
+
+	if wantMessage != gotMessage {
+		t.Errorf("want %v, got %v", wantMessage, gotMessage)
+	}
+}
+
+// TestGenerateSpiesForFuncTypes ensures a named func type is spied on
+// through a method of its type, asserted to be usable as the func
+func TestGenerateSpiesForFuncTypes(t *testing.T) {
+	gen := &fm.SpyGenerator{
+		Converter:   &fm.SpyStructConverter{},
+		Implementer: &fm.SpyFuncImplementer{},
+	}
+	spyDecls, diags := gen.Generate(parseDecls(t, `package sample
+
+type HandlerFunc func(string, int) error`))
+	if len(diags) != 0 {
+		t.Fatalf("want no diagnostics, got %v", diags)
+	}
+	f := &ast.File{Name: ast.NewIdent("sample"), Decls: spyDecls}
+
+	if _, ok := declaredTypes(f)["SpyHandlerFunc"]; !ok {
+		t.Errorf("want SpyHandlerFunc, got %v", declaredTypes(f))
+	}
+	method, ok := declaredMethods(f)["SpyHandlerFunc.HandlerFunc"]
+	if !ok {
+		t.Fatalf("want SpyHandlerFunc.HandlerFunc, got %v", declaredMethods(f))
+	}
+	if want, got := "func(arg0 string, arg1 int) error", types.ExprString(method.Type); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := []string{"HandlerFunc"}, assertedTypes(f)["SpyHandlerFunc"]; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunGeneratesCheckedSpiesForFuncTypes ensures the spy of a func type,
+// whose method is passed in its place, compiles from an external test
+// package, including variadic parameters and named results
+func TestRunGeneratesCheckedSpiesForFuncTypes(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+import "time"
+
+type Clock func() time.Time
+
+type Formatter func(format string, args ...interface{}) (s string, err error)
+`,
+	})
+	defer rmDir()
+
+	// the spies are asserted to implement their func types, which
+	// runChecked fails on if they do not compile
+	runChecked(t, &fm.Cmd{DeclGenerator: buildGen()}, dir, "fm_test.go")
+}
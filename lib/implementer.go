@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
+	"strconv"
 )
 
 const (
@@ -15,8 +16,17 @@ const (
 type SpyFuncImplementer struct{}
 
 // Implement returns a function declaration whose arguments are saved
-// as properties and whose return values are properties on a spy struct
+// as properties and whose return values are properties on a spy struct.
+// Each function is accompanied by a WaitFor function which blocks until
+// the function has been called a given number of times, by Block and
+// Release functions which hold calls to the function until released, and,
+// when the function returns values, by a ReturnsWhen function which sets
+// return values for matching arguments. A WaitFor or ReturnsWhen function
+// is left out when the interface declares a method of the same name, which
+// is spied on instead, as are Block and Release functions when it declares
+// either, and calls are not logged when it declares a CallLog method
 func (s *SpyFuncImplementer) Implement(name *ast.Ident, i *ast.InterfaceType) []*ast.FuncDecl {
+	declared := methodNames(i)
 	var funcDecls []*ast.FuncDecl
 	for _, list := range i.Methods.List {
 		recv := &ast.FieldList{
@@ -36,49 +46,45 @@ func (s *SpyFuncImplementer) Implement(name *ast.Ident, i *ast.InterfaceType) []
 			Recv: recv,
 			Name: list.Names[0],
 			Type: funcType,
-			Body: createBlockStmt(list.Names[0].Name, funcType),
+			Body: createBlockStmt(list.Names[0].Name, funcType, !declared[callLogField]),
 		})
+		if !declared[waitPrefix+list.Names[0].Name] {
+			funcDecls = append(funcDecls, createWaitFor(recv, list.Names[0].Name))
+		}
+		if !declared[blockPrefix+list.Names[0].Name] && !declared[releasePrefix+list.Names[0].Name] {
+			funcDecls = append(funcDecls, createBlock(recv, list.Names[0].Name))
+			funcDecls = append(funcDecls, createRelease(recv, list.Names[0].Name))
+		}
+		if len(resultTypes(funcType)) > 0 && !declared[list.Names[0].Name+returnsWhenSuffix] {
+			funcDecls = append(funcDecls, createReturnsWhen(recv, list.Names[0].Name, funcType))
+		}
 	}
 	return funcDecls
 }
 
-func createBlockStmt(fname string, f *ast.FuncType) *ast.BlockStmt {
+// methodNames returns the names of the interface's methods
+func methodNames(i *ast.InterfaceType) map[string]bool {
+	names := make(map[string]bool)
+	for _, field := range i.Methods.List {
+		for _, n := range field.Names {
+			names[n.Name] = true
+		}
+	}
+	return names
+}
+
+func createBlockStmt(fname string, f *ast.FuncType, logged bool) *ast.BlockStmt {
 	var list []ast.Stmt
 
 	// x.mu.Lock()
-	lockStmt := &ast.ExprStmt{
-		X: &ast.CallExpr{
-			Fun: &ast.SelectorExpr{
-				X: &ast.SelectorExpr{
-					X:   ast.NewIdent(recvName),
-					Sel: ast.NewIdent("mu"),
-				},
-				Sel: ast.NewIdent("Lock"),
-			},
-		},
-	}
-	list = append(list, lockStmt)
-
-	// defer x.mu.Unlock()
-	deferStmt := &ast.DeferStmt{
-		Call: &ast.CallExpr{
-			Fun: &ast.SelectorExpr{
-				X: &ast.SelectorExpr{
-					X:   ast.NewIdent(recvName),
-					Sel: ast.NewIdent("mu"),
-				},
-				Sel: ast.NewIdent("Unlock"),
-			},
-		},
-	}
-	list = append(list, deferStmt)
+	list = append(list, lockStmt())
 
 	// add called assignment statement
 	calledStmt := &ast.AssignStmt{
 		Lhs: []ast.Expr{
 			&ast.SelectorExpr{
 				X:   ast.NewIdent(recvName),
-				Sel: ast.NewIdent(fname + "_Called"),
+				Sel: ast.NewIdent(fname + calledSuffix),
 			},
 		},
 		Tok: token.ASSIGN,
@@ -86,61 +92,446 @@ func createBlockStmt(fname string, f *ast.FuncType) *ast.BlockStmt {
 	}
 	list = append(list, calledStmt)
 
+	// x.Foo_CallCount++
+	list = append(list, &ast.IncDecStmt{
+		X:   recvSelector(fname + callCountSuffix),
+		Tok: token.INC,
+	})
+
+	// x.CallLog = append(x.CallLog, "Foo")
+	if logged {
+		list = append(list, &ast.AssignStmt{
+			Lhs: []ast.Expr{recvSelector(callLogField)},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{&ast.CallExpr{
+				Fun: ast.NewIdent("append"),
+				Args: []ast.Expr{
+					recvSelector(callLogField),
+					&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(fname)},
+				},
+			}},
+		})
+	}
+
+	// wake up anyone waiting on a call
+	list = append(list, notifyStmt())
+
 	// add assignment for each param
-	offset := 0
-	for idx, field := range f.Params.List {
-		// make assignments for multiple fields with same type
-		if len(field.Names) > 1 {
-			for _, name := range field.Names {
-				assignStmt := &ast.AssignStmt{
-					Lhs: []ast.Expr{
-						&ast.SelectorExpr{
-							X: &ast.SelectorExpr{
-								X:   ast.NewIdent(recvName),
-								Sel: ast.NewIdent(fname + inputSuffix),
-							},
-							Sel: ast.NewIdent(fmt.Sprintf("%s%d", argPrefix, idx+offset)),
-						},
-					},
-					Tok: token.ASSIGN,
-					Rhs: []ast.Expr{name},
-				}
-				list = append(list, assignStmt)
-
-				offset++
-			}
-		} else {
-			assignStmt := &ast.AssignStmt{
-				Lhs: []ast.Expr{
-					&ast.SelectorExpr{
-						X: &ast.SelectorExpr{
-							X:   ast.NewIdent(recvName),
-							Sel: ast.NewIdent(fname + inputSuffix),
+	list = append(list, createInputStmts(fname, f)...)
+
+	// hold the call outside of the lock while the function is blocked
+	list = append(list, createGateStmts(fname, f)...)
+
+	// add return statement if there are values to return
+	if len(resultTypes(f)) > 0 {
+		// copy the rules and the results while holding the lock, so that
+		// rules may call the spy, e.g., its Snapshot, without deadlocking.
+		// Rules are appended or cleared but never changed in place
+		rules := ast.NewIdent(uniqueName("rules", f))
+		output := ast.NewIdent(uniqueName("output", f))
+
+		// x.mu.Lock()
+		list = append(list, lockStmt())
+		list = append(list, &ast.AssignStmt{
+			Lhs: []ast.Expr{rules, output},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{
+				recvSelector(unexported(fname) + rulesSuffix),
+				recvSelector(fname + outputSuffix),
+			},
+		})
+		// x.mu.Unlock()
+		list = append(list, unlockStmt())
+
+		// return the values of the first matching rule, if any
+		list = append(list, createRulesStmt(rules, f))
+
+		var results []ast.Expr
+		for idx := range resultTypes(f) {
+			results = append(results, &ast.SelectorExpr{
+				X:   output,
+				Sel: ast.NewIdent(fmt.Sprintf("%s%d", retPrefix, idx)),
+			})
+		}
+		list = append(list, &ast.ReturnStmt{Results: results})
+	}
+
+	return &ast.BlockStmt{List: list}
+}
+
+// createInputStmts saves each argument on the receiver:
+//
+//	f.Bar_Input.Arg0 = task
+//	f.Bar_Input.Arg1 = graciously
+func createInputStmts(fname string, f *ast.FuncType) []ast.Stmt {
+	var list []ast.Stmt
+	for idx, name := range paramNames(f) {
+		list = append(list, &ast.AssignStmt{
+			Lhs: []ast.Expr{
+				recvSelector(fname+inputSuffix, fmt.Sprintf("%s%d", argPrefix, idx)),
+			},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{name},
+		})
+	}
+	return list
+}
+
+// createRulesStmt returns the values of the first of the rules which
+// matches the function's arguments:
+//
+//	for _, rule := range rules {
+//		if ok, ret0, ret1 := rule(task, graciously); ok {
+//			return ret0, ret1
+//		}
+//	}
+func createRulesStmt(rules *ast.Ident, f *ast.FuncType) ast.Stmt {
+	rule := ast.NewIdent(uniqueName("rule", f))
+	ok := ast.NewIdent(uniqueName("ok", f))
+
+	lhs := []ast.Expr{ok}
+	var rets []ast.Expr
+	for idx := range resultTypes(f) {
+		ret := ast.NewIdent(uniqueName(fmt.Sprintf("ret%d", idx), f))
+		lhs = append(lhs, ret)
+		rets = append(rets, ret)
+	}
+
+	return &ast.RangeStmt{
+		Key:   ast.NewIdent("_"),
+		Value: rule,
+		Tok:   token.DEFINE,
+		X:     rules,
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.IfStmt{
+				Init: &ast.AssignStmt{
+					Lhs: lhs,
+					Tok: token.DEFINE,
+					Rhs: []ast.Expr{callWithParams(rule, f)},
+				},
+				Cond: ok,
+				Body: &ast.BlockStmt{List: []ast.Stmt{
+					&ast.ReturnStmt{Results: rets},
+				}},
+			},
+		}},
+	}
+}
+
+// createReturnsWhen builds a function which adds a rule for the values
+// the named function returns when match reports true for its arguments:
+//
+//	func (f *SpyFoo) BarReturnsWhen(match func(task string) bool, ret0 int, ret1 error) {
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//		f.bar_rules = append(f.bar_rules, func(task string) (bool, int, error) {
+//			return match(task), ret0, ret1
+//		})
+//	}
+func createReturnsWhen(recv *ast.FieldList, fname string, f *ast.FuncType) *ast.FuncDecl {
+	match := ast.NewIdent(uniqueName("match", f))
+
+	params := []*ast.Field{{
+		Names: []*ast.Ident{match},
+		Type:  matchFuncType(f),
+	}}
+	rets := []ast.Expr{callWithParams(match, f)}
+	for idx, t := range resultTypes(f) {
+		ret := ast.NewIdent(uniqueName(fmt.Sprintf("ret%d", idx), f))
+		params = append(params, &ast.Field{
+			Names: []*ast.Ident{ret},
+			Type:  t,
+		})
+		rets = append(rets, ret)
+	}
+
+	return &ast.FuncDecl{
+		Doc: docComment(
+			fmt.Sprintf("%s%s makes %s return the given values when match reports true", fname, returnsWhenSuffix, fname),
+			fmt.Sprintf("for its arguments. Rules apply in the order added, falling back to %s%s", fname, outputSuffix),
+		),
+		Recv: recv,
+		Name: ast.NewIdent(fname + returnsWhenSuffix),
+		Type: &ast.FuncType{Params: &ast.FieldList{List: params}},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			lockStmt(),
+			deferUnlockStmt(),
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{recvSelector(unexported(fname) + rulesSuffix)},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{&ast.CallExpr{
+					Fun: ast.NewIdent("append"),
+					Args: []ast.Expr{
+						recvSelector(unexported(fname) + rulesSuffix),
+						&ast.FuncLit{
+							Type: ruleFuncType(f),
+							Body: &ast.BlockStmt{List: []ast.Stmt{
+								&ast.ReturnStmt{Results: rets},
+							}},
 						},
-						Sel: ast.NewIdent(fmt.Sprintf("%s%d", argPrefix, idx+offset)),
 					},
+				}},
+			},
+		}},
+	}
+}
+
+// matchFuncType returns a function type with the same parameters as f
+// which reports whether a rule applies, e.g., func(task string) bool
+func matchFuncType(f *ast.FuncType) *ast.FuncType {
+	return &ast.FuncType{
+		Params: f.Params,
+		Results: &ast.FieldList{List: []*ast.Field{
+			{Type: ast.NewIdent("bool")},
+		}},
+	}
+}
+
+// ruleFuncType returns a function type with the same parameters as f
+// which reports whether a rule applies along with the rule's values,
+// e.g., func(task string) (bool, int, error)
+func ruleFuncType(f *ast.FuncType) *ast.FuncType {
+	results := []*ast.Field{{Type: ast.NewIdent("bool")}}
+	for _, t := range resultTypes(f) {
+		results = append(results, &ast.Field{Type: t})
+	}
+	return &ast.FuncType{
+		Params:  f.Params,
+		Results: &ast.FieldList{List: results},
+	}
+}
+
+// createGateStmts releases the lock and then waits on the function's gate,
+// if there is one. When the first parameter is a context.Context, the wait
+// ends early and the function returns the context's error:
+//
+//	gate := f.bar_gate
+//	f.mu.Unlock()
+//	if gate != nil {
+//		select {
+//		case <-gate:
+//		case <-ctx.Done():
+//			return *new(int), ctx.Err()
+//		}
+//	}
+func createGateStmts(fname string, f *ast.FuncType) []ast.Stmt {
+	gate := ast.NewIdent(uniqueName("gate", f))
+	copyStmt := &ast.AssignStmt{
+		Lhs: []ast.Expr{gate},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{recvSelector(unexported(fname) + gateSuffix)},
+	}
+
+	var waitStmt ast.Stmt = &ast.ExprStmt{X: &ast.UnaryExpr{Op: token.ARROW, X: gate}}
+	if ctx := contextParam(f); ctx != nil {
+		waitStmt = &ast.SelectStmt{
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				&ast.CommClause{Comm: waitStmt},
+				&ast.CommClause{
+					Comm: &ast.ExprStmt{X: &ast.UnaryExpr{
+						Op: token.ARROW,
+						X:  &ast.CallExpr{Fun: &ast.SelectorExpr{X: ctx, Sel: ast.NewIdent("Done")}},
+					}},
+					Body: []ast.Stmt{cancelledReturnStmt(ctx, f)},
 				},
-				Tok: token.ASSIGN,
-				Rhs: []ast.Expr{field.Names[0]},
-			}
-			list = append(list, assignStmt)
+			}},
 		}
 	}
 
-	// add return statement if there are values to return
+	return []ast.Stmt{
+		copyStmt,
+		unlockStmt(),
+		&ast.IfStmt{
+			Cond: &ast.BinaryExpr{X: gate, Op: token.NEQ, Y: ast.NewIdent("nil")},
+			Body: &ast.BlockStmt{List: []ast.Stmt{waitStmt}},
+		},
+	}
+}
+
+// cancelledReturnStmt returns zero values for all results, except for
+// a trailing error, which is set to ctx.Err()
+func cancelledReturnStmt(ctx *ast.Ident, f *ast.FuncType) ast.Stmt {
+	if f.Results == nil {
+		return &ast.ReturnStmt{}
+	}
+
 	var results []ast.Expr
-	for idx := range f.Results.List {
-		results = append(results, &ast.SelectorExpr{
-			X: &ast.SelectorExpr{
-				X:   ast.NewIdent(recvName), // for spy
-				Sel: ast.NewIdent(fname + outputSuffix),
+	types := resultTypes(f)
+	for idx, t := range types {
+		if idx == len(types)-1 && isIdent(t, "error") {
+			results = append(results, &ast.CallExpr{
+				Fun: &ast.SelectorExpr{X: ctx, Sel: ast.NewIdent("Err")},
+			})
+			continue
+		}
+		results = append(results, zeroValue(t))
+	}
+	return &ast.ReturnStmt{Results: results}
+}
+
+// contextParam returns the name of the function's first parameter
+// when its type is context.Context, and nil otherwise
+func contextParam(f *ast.FuncType) *ast.Ident {
+	if f.Params == nil || len(f.Params.List) == 0 {
+		return nil
+	}
+	first := f.Params.List[0]
+	if len(first.Names) == 0 {
+		return nil
+	}
+	sel, ok := first.Type.(*ast.SelectorExpr)
+	if !ok || !isIdent(sel.X, "context") || sel.Sel.Name != "Context" {
+		return nil
+	}
+	return first.Names[0]
+}
+
+// createBlock builds a function which causes calls to the named function
+// to block until they are released:
+//
+//	func (f *SpyFoo) BlockBar() {
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//		if f.bar_gate == nil {
+//			f.bar_gate = make(chan struct{})
+//		}
+//	}
+func createBlock(recv *ast.FieldList, fname string) *ast.FuncDecl {
+	return &ast.FuncDecl{
+		Doc: docComment(fmt.Sprintf("%s%s causes calls to %s to block until %s%s is called",
+			blockPrefix, fname, fname, releasePrefix, fname)),
+		Recv: recv,
+		Name: ast.NewIdent(blockPrefix + fname),
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			lockStmt(),
+			deferUnlockStmt(),
+			makeStmt(recvSelector(unexported(fname) + gateSuffix)),
+		}},
+	}
+}
+
+// createRelease builds a function which lets all blocked calls to the
+// named function proceed:
+//
+//	func (f *SpyFoo) ReleaseBar() {
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//		if f.bar_gate != nil {
+//			close(f.bar_gate)
+//			f.bar_gate = nil
+//		}
+//	}
+func createRelease(recv *ast.FieldList, fname string) *ast.FuncDecl {
+	return &ast.FuncDecl{
+		Doc: docComment(fmt.Sprintf("%s%s lets all calls to %s blocked by %s%s proceed",
+			releasePrefix, fname, fname, blockPrefix, fname)),
+		Recv: recv,
+		Name: ast.NewIdent(releasePrefix + fname),
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			lockStmt(),
+			deferUnlockStmt(),
+			closeStmt(recvSelector(unexported(fname) + gateSuffix)),
+		}},
+	}
+}
+
+// createWaitFor builds a function which blocks until the named function
+// has been called at least n times or the context is done:
+//
+//	func (f *SpyFoo) WaitForBar(ctx context.Context, n int) error {
+//		for {
+//			f.mu.Lock()
+//			if f.Bar_CallCount >= n {
+//				f.mu.Unlock()
+//				return nil
+//			}
+//			if f.called == nil {
+//				f.called = make(chan struct{})
+//			}
+//			called := f.called
+//			f.mu.Unlock()
+//
+//			select {
+//			case <-called:
+//			case <-ctx.Done():
+//				return ctx.Err()
+//			}
+//		}
+//	}
+func createWaitFor(recv *ast.FieldList, fname string) *ast.FuncDecl {
+	doneStmt := &ast.IfStmt{
+		Cond: &ast.BinaryExpr{
+			X:  recvSelector(fname + callCountSuffix),
+			Op: token.GEQ,
+			Y:  ast.NewIdent("n"),
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			unlockStmt(),
+			&ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent("nil")}},
+		}},
+	}
+
+	copyStmt := &ast.AssignStmt{
+		Lhs: []ast.Expr{ast.NewIdent(calledField)},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{recvSelector(calledField)},
+	}
+
+	selectStmt := &ast.SelectStmt{
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.CommClause{
+				Comm: &ast.ExprStmt{X: &ast.UnaryExpr{
+					Op: token.ARROW,
+					X:  ast.NewIdent(calledField),
+				}},
 			},
-			Sel: ast.NewIdent(fmt.Sprintf("%s%d", retPrefix, idx)),
-		})
+			&ast.CommClause{
+				Comm: &ast.ExprStmt{X: &ast.UnaryExpr{
+					Op: token.ARROW,
+					X:  &ast.CallExpr{Fun: selector("ctx", "Done")},
+				}},
+				Body: []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{
+					&ast.CallExpr{Fun: selector("ctx", "Err")},
+				}}},
+			},
+		}},
 	}
-	if len(results) > 0 {
-		list = append(list, &ast.ReturnStmt{Results: results})
+
+	return &ast.FuncDecl{
+		Doc:  docComment(fmt.Sprintf("%s%s blocks until %s has been called at least n times", waitPrefix, fname, fname)),
+		Recv: recv,
+		Name: ast.NewIdent(waitPrefix + fname),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{List: []*ast.Field{
+				{
+					Names: []*ast.Ident{ast.NewIdent("ctx")},
+					Type:  selector("context", "Context"),
+				},
+				{
+					Names: []*ast.Ident{ast.NewIdent("n")},
+					Type:  ast.NewIdent("int"),
+				},
+			}},
+			Results: &ast.FieldList{List: []*ast.Field{
+				{Type: ast.NewIdent("error")},
+			}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.ForStmt{Body: &ast.BlockStmt{List: []ast.Stmt{
+				lockStmt(),
+				doneStmt,
+				makeStmt(recvSelector(calledField)),
+				copyStmt,
+				unlockStmt(),
+				selectStmt,
+			}}},
+		}},
 	}
+}
 
-	return &ast.BlockStmt{List: list}
+// notifyStmt closes the channel of any waiting callers
+func notifyStmt() ast.Stmt {
+	return closeStmt(recvSelector(calledField))
 }
@@ -1,7 +1,11 @@
 package fm_test
 
 import (
+	"bytes"
 	"go/ast"
+	"go/format"
+	"go/token"
+	"strings"
 	"testing"
 
 	fm "github.com/enocom/fm/lib"
@@ -13,13 +17,107 @@ func TestImplementAssignsCalledField(t *testing.T) {
 	funcDecls := s.Implement(ast.NewIdent("SomeStruct"), someInterface)
 
 	got := len(funcDecls)
-	want := 1
+	want := 4
 
 	if want != got {
 		t.Fatalf("want %v, got %v", want, got)
 	}
 }
 
+func TestImplementAddsWaitForFunction(t *testing.T) {
+	someInterface := buildInterface()
+	s := &fm.SpyFuncImplementer{}
+	funcDecls := s.Implement(ast.NewIdent("SomeStruct"), someInterface)
+
+	want := "WaitForSomeMethod"
+	got := funcDecls[1].Name.Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestImplementAddsBlockAndReleaseFunctions(t *testing.T) {
+	someInterface := buildInterface()
+	s := &fm.SpyFuncImplementer{}
+	funcDecls := s.Implement(ast.NewIdent("SomeStruct"), someInterface)
+
+	want := "BlockSomeMethod"
+	got := funcDecls[2].Name.Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	want = "ReleaseSomeMethod"
+	got = funcDecls[3].Name.Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestImplementAddsReturnsWhenFunctionForResults(t *testing.T) {
+	resultInterface := &ast.InterfaceType{Methods: &ast.FieldList{List: []*ast.Field{{
+		Names: []*ast.Ident{ast.NewIdent("SomeMethod")},
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{
+				{Type: ast.NewIdent("int")},
+			}},
+		},
+	}}}}
+	s := &fm.SpyFuncImplementer{}
+	funcDecls := s.Implement(ast.NewIdent("SomeStruct"), resultInterface)
+
+	if len(funcDecls) != 5 {
+		t.Fatalf("want %v, got %v", 5, len(funcDecls))
+	}
+
+	want := "SomeMethodReturnsWhen"
+	got := funcDecls[4].Name.Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// a blocked call returns early with the context's error when the
+// function's first parameter is a context.Context
+func TestImplementReturnsContextErrorFromBlockedCall(t *testing.T) {
+	ctxInterface := &ast.InterfaceType{Methods: &ast.FieldList{List: []*ast.Field{{
+		Names: []*ast.Ident{ast.NewIdent("SomeMethod")},
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent("ctx")},
+				Type: &ast.SelectorExpr{
+					X:   ast.NewIdent("context"),
+					Sel: ast.NewIdent("Context"),
+				},
+			}}},
+			Results: &ast.FieldList{List: []*ast.Field{
+				{Type: ast.NewIdent("int")},
+				{Type: ast.NewIdent("error")},
+			}},
+		},
+	}}}}
+	s := &fm.SpyFuncImplementer{}
+	funcDecls := s.Implement(ast.NewIdent("SomeStruct"), ctxInterface)
+
+	var buf bytes.Buffer
+	err := format.Node(&buf, token.NewFileSet(), funcDecls[0])
+	if err != nil {
+		t.Fatalf("format.Node failed with %v", err)
+	}
+
+	want := "return *new(int), ctx.Err()"
+	got := buf.String()
+
+	if !strings.Contains(got, want) {
+		t.Errorf("want %v in %v", want, got)
+	}
+}
+
 func buildInterface() *ast.InterfaceType {
 	params := []*ast.Field{}
 
@@ -40,3 +138,95 @@ func buildInterface() *ast.InterfaceType {
 // TODO assigns s.Foo_Input.Arg0 = arg, etc.
 // TODO adds return values, e.g., return Foo_Output.Ret0, etc.
 // TODO doesn't add return value when there is none (doesn't blow up)
+
+// TestRunSpiesOnMethodsNamedLikeWaitFor ensures a WaitFor function is
+// left out when the interface declares a method of the same name, which
+// is spied on instead
+func TestRunSpiesOnMethodsNamedLikeWaitFor(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+import "context"
+
+type Doer interface {
+	Do()
+	WaitForDo(ctx context.Context, n int) error
+}
+`,
+	})
+	defer rmDir()
+
+	f := runChecked(t, &fm.Cmd{DeclGenerator: buildGen()}, dir, "fm_test.go")
+
+	waitFor, ok := declaredMethods(f)["SpyDoer.WaitForDo"]
+	if !ok {
+		t.Fatalf("want SpyDoer.WaitForDo, got %v", declaredMethods(f))
+	}
+	if got := assignedFields(waitFor); !contains(got, "f.WaitForDo_Called") {
+		t.Errorf("want SpyDoer.WaitForDo to record its call, got %v", got)
+	}
+}
+
+// TestRunSpiesOnMethodsNamedLikeBlock ensures the Block and Release
+// functions are left out when the interface declares either of them
+func TestRunSpiesOnMethodsNamedLikeBlock(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type Doer interface {
+	Do()
+	BlockDo()
+}
+`,
+	})
+	defer rmDir()
+
+	f := runChecked(t, &fm.Cmd{DeclGenerator: buildGen()}, dir, "fm_test.go")
+
+	methods := declaredMethods(f)
+	block, ok := methods["SpyDoer.BlockDo"]
+	if !ok {
+		t.Fatalf("want SpyDoer.BlockDo, got %v", methods)
+	}
+	if got := assignedFields(block); !contains(got, "f.BlockDo_Called") {
+		t.Errorf("want SpyDoer.BlockDo to record its call, got %v", got)
+	}
+	if _, ok := methods["SpyDoer.ReleaseDo"]; ok {
+		t.Error("want no SpyDoer.ReleaseDo without SpyDoer.BlockDo")
+	}
+}
+
+// TestRunSpiesOnMethodsNamedLikeReturnsWhenAndCallLog ensures the
+// ReturnsWhen function and the log are left out when the interface
+// declares a method of the same name
+func TestRunSpiesOnMethodsNamedLikeReturnsWhenAndCallLog(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type Counter interface {
+	Count() int
+	CountReturnsWhen(match func() bool, n int)
+	CallLog() []string
+}
+`,
+	})
+	defer rmDir()
+
+	f := runChecked(t, &fm.Cmd{DeclGenerator: buildGen()}, dir, "fm_test.go")
+
+	methods := declaredMethods(f)
+	for _, method := range []string{"CountReturnsWhen", "CallLog"} {
+		funcDecl, ok := methods["SpyCounter."+method]
+		if !ok {
+			t.Fatalf("want SpyCounter.%v, got %v", method, methods)
+		}
+		if got := assignedFields(funcDecl); !contains(got, "f."+method+"_Called") {
+			t.Errorf("want SpyCounter.%v to record its call, got %v", method, got)
+		}
+	}
+	for _, field := range declaredTypes(f)["SpyCounter"].(*ast.StructType).Fields.List {
+		if field.Names[0].Name == "CallLog" {
+			t.Error("want no CallLog field in SpyCounter")
+		}
+	}
+}
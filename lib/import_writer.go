@@ -1,13 +1,32 @@
 package fm
 
-import "os/exec"
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
 
 // GoImportsWriter uses the goimports command line tool to add import statements
-// to a Go source file
+// to Go source
 type GoImportsWriter struct{}
 
-// Write passes the specified filanme through to the goimports tool
-func (*GoImportsWriter) Write(filename string) error {
-	cmd := exec.Command("goimports", "-w", filename)
-	return cmd.Run()
+// Write passes the source through the goimports tool, resolving imports
+// as if the source were saved to the specified filename
+func (*GoImportsWriter) Write(filename string, src []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("goimports", "-srcdir", filepath.Dir(filename))
+	cmd.Stdin = bytes.NewReader(src)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("goimports %s: %v: %s", filename, err, msg)
+		}
+		return nil, fmt.Errorf("goimports %s: %v", filename, err)
+	}
+	return stdout.Bytes(), nil
 }
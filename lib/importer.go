@@ -0,0 +1,105 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+)
+
+// srcImporter imports packages from source like the importer for the
+// "source" compiler, except that import paths are resolved within the
+// module, or GOPATH, of its directory rather than of the working directory
+type srcImporter struct {
+	fset     *token.FileSet
+	ctx      build.Context
+	packages map[string]*types.Package
+	// importing holds the packages being imported, to report cycles
+	importing map[string]bool
+}
+
+// newSrcImporter returns an importer of packages as seen from dir
+func newSrcImporter(fset *token.FileSet, dir string) *srcImporter {
+	ctx := build.Default
+	// the go command resolves import paths from ctx.Dir, which must be
+	// absolute for the relative srcDir of local imports to be rejected
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	ctx.Dir = dir
+	// packages using cgo are imported from their pure Go files, if any,
+	// rather than running cgo
+	ctx.CgoEnabled = false
+	return &srcImporter{
+		fset:      fset,
+		ctx:       ctx,
+		packages:  make(map[string]*types.Package),
+		importing: make(map[string]bool),
+	}
+}
+
+// Import returns the package at path, as imported from the importer's
+// directory
+func (i *srcImporter) Import(path string) (*types.Package, error) {
+	return i.ImportFrom(path, i.ctx.Dir, 0)
+}
+
+// ImportFrom returns the package at path, as imported from srcDir, which
+// matters for local imports such as ./sample and for vendored packages
+func (i *srcImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	if abs, err := filepath.Abs(srcDir); err == nil {
+		srcDir = abs
+	}
+	bp, err := i.ctx.Import(path, srcDir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// package unsafe is known to the type checker
+	if bp.ImportPath == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, ok := i.packages[bp.ImportPath]; ok {
+		return pkg, nil
+	}
+	if i.importing[bp.ImportPath] {
+		return nil, fmt.Errorf("import cycle through package %q", bp.ImportPath)
+	}
+	i.importing[bp.ImportPath] = true
+	defer delete(i.importing, bp.ImportPath)
+
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(i.fset, filepath.Join(bp.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	// only the declarations of imported packages matter, and the first
+	// hard error is reported in place of any soft one
+	var firstHardErr error
+	conf := types.Config{
+		IgnoreFuncBodies: true,
+		FakeImportC:      true,
+		Importer:         i,
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok && firstHardErr == nil && !typeErr.Soft {
+				firstHardErr = err
+			}
+		},
+	}
+	pkg, err := conf.Check(bp.ImportPath, i.fset, files, nil)
+	if firstHardErr != nil {
+		return nil, fmt.Errorf("type-checking package %q failed (%v)", bp.ImportPath, firstHardErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("type-checking package %q failed (%v)", bp.ImportPath, err)
+	}
+	i.packages[bp.ImportPath] = pkg
+	return pkg, nil
+}
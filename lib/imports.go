@@ -0,0 +1,178 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// generatorImports are the packages which the generated code itself
+// refers to, whose names are never given to other imports
+var generatorImports = []string{"context", "reflect", "sync", "testing"}
+
+// fileImport is an import of a source file under its local name
+type fileImport struct {
+	name  string
+	path  string
+	alias bool
+}
+
+// fileImports maps the local name of each import of the file to the
+// import, e.g., pb to github.com/org/api/v2/proto. Blank and dot
+// imports are left out, as no selector refers to them
+func fileImports(f *ast.File) map[string]fileImport {
+	imports := make(map[string]fileImport)
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		imp := fileImport{name: assumedName(p), path: p}
+		if spec.Name != nil {
+			if spec.Name.Name == "_" || spec.Name.Name == "." {
+				continue
+			}
+			imp.name, imp.alias = spec.Name.Name, true
+		}
+		imports[imp.name] = imp
+	}
+	return imports
+}
+
+// assumedName returns the name a package is assumed to have from its
+// import path, as goimports does, e.g., proto for example.com/proto/v2
+// and yaml for gopkg.in/yaml.v2
+func assumedName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil {
+			if dir := path.Dir(importPath); dir != "." {
+				base = path.Base(dir)
+			}
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// importSet holds the imports of a generated file by their local names
+type importSet struct {
+	paths   map[string]string // local name to path
+	names   map[string]string // path to local name
+	aliased map[string]bool
+	used    map[string]bool
+}
+
+// newImportSet returns a set holding the packages of the generator
+func newImportSet() *importSet {
+	s := &importSet{
+		paths:   make(map[string]string),
+		names:   make(map[string]string),
+		aliased: make(map[string]bool),
+		used:    make(map[string]bool),
+	}
+	for _, p := range generatorImports {
+		s.reserve(p, p)
+	}
+	return s
+}
+
+// reserve holds the name for the path, which is only imported once used,
+// e.g., the source package
+func (s *importSet) reserve(name, p string) {
+	s.paths[name] = p
+	s.names[p] = name
+	s.aliased[p] = path.Base(p) != name
+}
+
+// use marks the reserved path as imported
+func (s *importSet) use(p string) {
+	s.used[p] = true
+}
+
+// add records the import and returns the local name of the path within
+// the generated file, which differs from that of the import when another
+// path holds its name already, e.g., proto2
+func (s *importSet) add(imp fileImport) string {
+	s.used[imp.path] = true
+	if name, ok := s.names[imp.path]; ok {
+		return name
+	}
+
+	name := imp.name
+	for i := 2; ; i++ {
+		if _, taken := s.paths[name]; !taken {
+			break
+		}
+		name = fmt.Sprintf("%s%d", imp.name, i)
+	}
+	s.paths[name] = imp.path
+	s.names[imp.path] = name
+	s.aliased[imp.path] = imp.alias || name != assumedName(imp.path)
+	return name
+}
+
+// decl returns a declaration of the imports in use, in order of path,
+// or nil when there are none
+func (s *importSet) decl() *ast.GenDecl {
+	var paths []string
+	for p := range s.used {
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	sort.Strings(paths)
+
+	decl := &ast.GenDecl{Tok: token.IMPORT}
+	for _, p := range paths {
+		spec := &ast.ImportSpec{
+			Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(p)},
+		}
+		if s.aliased[p] {
+			spec.Name = ast.NewIdent(s.names[p])
+		}
+		decl.Specs = append(decl.Specs, spec)
+	}
+	return decl
+}
+
+// resolveImports records the imports of the file which its interfaces
+// and func types refer to. When the name of an import is taken by another
+// path within the generated file, the selectors referring to it are
+// renamed in place.
+func resolveImports(ds []ast.Decl, imports map[string]fileImport, s *importSet) {
+	for _, typeSpec := range doubledSpecs(ds) {
+		for _, field := range methodsOf(typeSpec) {
+			if len(field.Names) == 0 {
+				continue // embedded interfaces are not implemented
+			}
+			ast.Inspect(field.Type, func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				ident, ok := sel.X.(*ast.Ident)
+				if !ok {
+					return true
+				}
+				if imp, ok := imports[ident.Name]; ok {
+					if name := s.add(imp); name != ident.Name {
+						sel.X = ast.NewIdent(name)
+					}
+				}
+				return false
+			})
+		}
+	}
+}
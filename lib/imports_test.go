@@ -0,0 +1,77 @@
+package fm_test
+
+import (
+	"go/types"
+	"strconv"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestRunCarriesOverImports ensures the spies import the exact paths and
+// aliases of their source files, renaming imports whose names collide
+// in the order of their files
+func TestRunCarriesOverImports(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"api/v2/proto/pb.go": "package proto\n\ntype Message struct{}\n",
+		"legacy/pb/pb.go":    "package pb\n\ntype Message struct{}\n",
+		"yaml.v3/yaml.go":    "package yaml\n\ntype Node struct{}\n",
+		"sender.go": `package sample
+
+import pb "example.com/sample/api/v2/proto"
+
+type Sender interface {
+	Send(m pb.Message) error
+}
+`,
+		"receiver.go": `package sample
+
+import (
+	"example.com/sample/legacy/pb"
+	yaml "example.com/sample/yaml.v3"
+)
+
+type Receiver interface {
+	Receive() (pb.Message, yaml.Node)
+}
+`,
+	})
+	defer rmDir()
+
+	cmd := &fm.Cmd{DeclGenerator: buildGen()}
+	f := runChecked(t, cmd, dir, "fm_test.go")
+
+	imports := make(map[string]string)
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		imports[path] = ""
+		if spec.Name != nil {
+			imports[path] = spec.Name.Name
+		}
+	}
+	for path, name := range map[string]string{
+		"example.com/sample/api/v2/proto": "pb2",
+		"example.com/sample/legacy/pb":    "",
+		"example.com/sample/yaml.v3":      "yaml",
+		"example.com/sample":              "",
+	} {
+		if got, ok := imports[path]; !ok || name != got {
+			t.Errorf("want %s imported as %q, got %v", path, name, imports)
+		}
+	}
+
+	methods := declaredMethods(f)
+	for method, want := range map[string]string{
+		"SpyReceiver.Receive": "func() (pb.Message, yaml.Node)",
+		"SpySender.Send":      "func(m pb2.Message) error",
+	} {
+		funcDecl, ok := methods[method]
+		if !ok {
+			t.Errorf("want %v, got %v", method, methods)
+			continue
+		}
+		if got := types.ExprString(funcDecl.Type); want != got {
+			t.Errorf("want %v for %v, got %v", want, method, got)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// instance is an instantiation of a generic interface, e.g., Repo[User],
+// which receives a test double of its own, e.g., SpyRepoUser
+type instance struct {
+	// name is that of the instantiated interface, e.g., RepoUser
+	name    string
+	generic string
+	// args are the type arguments, whose types of the source package
+	// are unqualified, just as they are within the package
+	args []ast.Expr
+}
+
+// typeParams returns the names of the type parameters of the type
+// in order, e.g., K and V for Cache[K comparable, V any]
+func typeParams(t *ast.TypeSpec) []string {
+	var names []string
+	if t.TypeParams == nil {
+		return names
+	}
+	for _, field := range t.TypeParams.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+// parseInstances parses instantiations of the generic interfaces declared
+// by the package, such as Repo[example.User] or Repo[User], in which the
+// types of the package may be qualified with its name or not
+func parseInstances(p *ast.Package, instantiations []string) ([]instance, error) {
+	generics := make(map[string]*ast.TypeSpec)
+	for _, f := range p.Files {
+		for _, spec := range doubledSpecs(f.Decls) {
+			if len(typeParams(spec)) > 0 {
+				generics[spec.Name.Name] = spec
+			}
+		}
+	}
+
+	var instances []instance
+	named := make(map[string]string)
+	for _, instantiation := range instantiations {
+		expr, err := parser.ParseExpr(instantiation)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse instantiation %s: %v", instantiation, err)
+		}
+
+		var x ast.Expr
+		var args []ast.Expr
+		switch e := expr.(type) {
+		case *ast.IndexExpr:
+			x, args = e.X, []ast.Expr{e.Index}
+		case *ast.IndexListExpr:
+			x, args = e.X, e.Indices
+		default:
+			return nil, fmt.Errorf("%s is not an instantiation, e.g., Repo[User]", instantiation)
+		}
+
+		ident, ok := x.(*ast.Ident)
+		if !ok {
+			return nil, fmt.Errorf("instantiation %s does not name an interface of package %s", instantiation, p.Name)
+		}
+		spec, ok := generics[ident.Name]
+		if !ok {
+			return nil, fmt.Errorf("no generic interface %s in package %s", ident.Name, p.Name)
+		}
+		if params := typeParams(spec); len(params) != len(args) {
+			return nil, fmt.Errorf("%s has %d type parameter(s), got %d in %s", ident.Name, len(params), len(args), instantiation)
+		}
+
+		inst := instance{generic: ident.Name}
+		for _, arg := range args {
+			inst.args = append(inst.args, unqualify(stripPos(arg).(ast.Expr), p.Name))
+		}
+		inst.name = instanceName(ident.Name, inst.args)
+
+		if other, ok := named[inst.name]; ok {
+			return nil, fmt.Errorf("instantiations %s and %s would both be named %s", other, instantiation, inst.name)
+		}
+		named[inst.name] = instantiation
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+// instanceName names the instantiation of the generic type with the type
+// arguments, e.g., RepoUser for Repo[example.User] and RepoPtrUser for
+// Repo[*example.User], so that distinct arguments give distinct names
+func instanceName(generic string, args []ast.Expr) string {
+	name := generic
+	for _, arg := range args {
+		name += typeName(arg)
+	}
+	return name
+}
+
+// unqualify removes the package name from the types of the package
+// within the expression, e.g., example.User becomes User
+func unqualify(e ast.Expr, pkg string) ast.Expr {
+	switch t := e.(type) {
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok && x.Name == pkg {
+			return t.Sel
+		}
+	case *ast.StarExpr:
+		t.X = unqualify(t.X, pkg)
+	case *ast.ParenExpr:
+		t.X = unqualify(t.X, pkg)
+	case *ast.ArrayType:
+		t.Elt = unqualify(t.Elt, pkg)
+	case *ast.MapType:
+		t.Key = unqualify(t.Key, pkg)
+		t.Value = unqualify(t.Value, pkg)
+	case *ast.ChanType:
+		t.Value = unqualify(t.Value, pkg)
+	case *ast.IndexExpr:
+		t.X = unqualify(t.X, pkg)
+		t.Index = unqualify(t.Index, pkg)
+	case *ast.IndexListExpr:
+		t.X = unqualify(t.X, pkg)
+		for i := range t.Indices {
+			t.Indices[i] = unqualify(t.Indices[i], pkg)
+		}
+	case *ast.FuncType:
+		for _, fl := range []*ast.FieldList{t.Params, t.Results} {
+			if fl == nil {
+				continue
+			}
+			for _, field := range fl.List {
+				field.Type = unqualify(field.Type, pkg)
+			}
+		}
+	}
+	return e
+}
+
+// typeName returns a name for the type, made of the exported names of
+// the types within it, leaving out package names, and of the kinds of
+// types they are composed into, e.g., SliceUser for []example.User
+func typeName(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return exported(t.Name)
+	case *ast.SelectorExpr:
+		return exported(t.Sel.Name)
+	case *ast.ParenExpr:
+		return typeName(t.X)
+	case *ast.StarExpr:
+		return "Ptr" + typeName(t.X)
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "Slice" + typeName(t.Elt)
+		}
+		if lit, ok := t.Len.(*ast.BasicLit); ok {
+			return "Array" + lit.Value + typeName(t.Elt)
+		}
+		return "Array" + typeName(t.Elt)
+	case *ast.MapType:
+		return "Map" + typeName(t.Key) + typeName(t.Value)
+	case *ast.ChanType:
+		return "Chan" + typeName(t.Value)
+	case *ast.IndexExpr:
+		return typeName(t.X) + typeName(t.Index)
+	case *ast.IndexListExpr:
+		name := typeName(t.X)
+		for _, index := range t.Indices {
+			name += typeName(index)
+		}
+		return name
+	case *ast.FuncType:
+		return "Func"
+	case *ast.StructType:
+		return "Struct"
+	case *ast.InterfaceType:
+		return "Interface"
+	}
+	return ""
+}
+
+// instantiatedDecls replaces each generic interface among ds which is
+// instantiated with an interface for every instantiation, e.g., RepoUser
+// with the methods of Repo[T] where T is User
+func instantiatedDecls(ds []ast.Decl, instances []instance) []ast.Decl {
+	if len(instances) == 0 {
+		return ds
+	}
+
+	var decls []ast.Decl
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			decls = append(decls, d)
+			continue
+		}
+
+		var specs []ast.Spec
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok || !doubledType(typeSpec) || len(typeParams(typeSpec)) == 0 {
+				specs = append(specs, spec)
+				continue
+			}
+
+			var instantiated bool
+			for _, inst := range instances {
+				if inst.generic != typeSpec.Name.Name {
+					continue
+				}
+				instantiated = true
+				specs = append(specs, inst.spec(typeSpec))
+			}
+			if !instantiated {
+				specs = append(specs, spec) // reported as unsupported
+			}
+		}
+
+		filtered := *genDecl
+		filtered.Specs = specs
+		decls = append(decls, &filtered)
+	}
+	return decls
+}
+
+// spec returns the generic interface, or func type, instantiated with the
+// type arguments, positioned at the generic one
+func (inst instance) spec(generic *ast.TypeSpec) *ast.TypeSpec {
+	args := make(map[string]ast.Expr)
+	for i, name := range typeParams(generic) {
+		args[name] = inst.args[i]
+	}
+	return &ast.TypeSpec{
+		Doc:  generic.Doc,
+		Name: &ast.Ident{Name: inst.name, NamePos: generic.Name.Pos()},
+		Type: substitute(stripPos(generic.Type).(ast.Expr), args),
+	}
+}
+
+// substitute returns the type expression with each type parameter
+// replaced by a copy of its type argument
+func substitute(e ast.Expr, args map[string]ast.Expr) ast.Expr {
+	switch t := e.(type) {
+	case *ast.Ident:
+		if arg, ok := args[t.Name]; ok {
+			return stripPos(arg).(ast.Expr)
+		}
+	case *ast.StarExpr:
+		t.X = substitute(t.X, args)
+	case *ast.ParenExpr:
+		t.X = substitute(t.X, args)
+	case *ast.ArrayType:
+		t.Elt = substitute(t.Elt, args)
+	case *ast.Ellipsis:
+		t.Elt = substitute(t.Elt, args)
+	case *ast.MapType:
+		t.Key = substitute(t.Key, args)
+		t.Value = substitute(t.Value, args)
+	case *ast.ChanType:
+		t.Value = substitute(t.Value, args)
+	case *ast.IndexExpr:
+		t.X = substitute(t.X, args)
+		t.Index = substitute(t.Index, args)
+	case *ast.IndexListExpr:
+		t.X = substitute(t.X, args)
+		for i := range t.Indices {
+			t.Indices[i] = substitute(t.Indices[i], args)
+		}
+	case *ast.FuncType:
+		substituteFields(t.Params, args)
+		substituteFields(t.Results, args)
+	case *ast.StructType:
+		substituteFields(t.Fields, args)
+	case *ast.InterfaceType:
+		substituteFields(t.Methods, args)
+	}
+	return e
+}
+
+// substituteFields substitutes the type arguments within every field
+func substituteFields(fl *ast.FieldList, args map[string]ast.Expr) {
+	if fl == nil {
+		return
+	}
+	for _, field := range fl.List {
+		field.Type = substitute(field.Type, args)
+	}
+}
+
+// instanceTypes maps the name of each instantiated interface to its
+// instantiation, e.g., RepoUser to Repo[User], qualified with pkg
+// unless it is empty
+func instanceTypes(instances []instance, pkg string) map[string]ast.Expr {
+	exprs := make(map[string]ast.Expr)
+	for _, inst := range instances {
+		var x ast.Expr = ast.NewIdent(inst.generic)
+		var args []ast.Expr
+		var qualified bool
+		for _, arg := range inst.args {
+			arg = stripPos(arg).(ast.Expr)
+			if pkg != "" {
+				arg = qualify(arg, pkg, &qualified)
+			}
+			args = append(args, arg)
+		}
+		if pkg != "" {
+			x = &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: ast.NewIdent(inst.generic)}
+		}
+
+		if len(args) == 1 {
+			exprs[inst.name] = &ast.IndexExpr{X: x, Index: args[0]}
+		} else {
+			exprs[inst.name] = &ast.IndexListExpr{X: x, Indices: args}
+		}
+	}
+	return exprs
+}
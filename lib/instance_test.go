@@ -0,0 +1,211 @@
+package fm_test
+
+import (
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestRunInstantiatesGenericInterfaces ensures each instantiation of a
+// generic interface receives a spy with the type arguments substituted
+// into every method, asserted to implement the instantiation, and that
+// generic interfaces left uninstantiated are reported with an example
+// instantiation satisfying their constraints, where there is one
+func TestRunInstantiatesGenericInterfaces(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type User struct{}
+
+type Cache[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Put(key K, values ...V)
+}
+
+type Pair[K, V any] interface {
+	Left() K
+	Right() V
+}
+
+type Index[K ~string, V interface{ ~int | ~float64 }] interface {
+	Lookup(key K) V
+}
+
+type Sorter[T interface{ Less(T) bool }] interface {
+	Sort(items []T)
+}
+`,
+	})
+	defer rmDir()
+
+	warnings := &strings.Builder{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Warnings:      warnings,
+		Instantiate:   []string{"Cache[string, sample.User]", "Cache[int, *User]"},
+	}
+	f := runChecked(t, cmd, dir, "fm_test.go")
+
+	asserted := assertedTypes(f)
+	for spy, want := range map[string][]string{
+		"SpyCacheStringUser": {"sample.Cache[string, sample.User]"},
+		"SpyCacheIntPtrUser": {"sample.Cache[int, *sample.User]"},
+	} {
+		if got := asserted[spy]; !reflect.DeepEqual(want, got) {
+			t.Errorf("want %v for %v, got %v", want, spy, got)
+		}
+	}
+
+	methods := declaredMethods(f)
+	for method, want := range map[string]string{
+		"SpyCacheStringUser.Get": "func(key string) (sample.User, bool)",
+		"SpyCacheStringUser.Put": "func(key string, values ...sample.User)",
+		"SpyCacheIntPtrUser.Get": "func(key int) (*sample.User, bool)",
+		"SpyCacheIntPtrUser.Put": "func(key int, values ...*sample.User)",
+	} {
+		funcDecl, ok := methods[method]
+		if !ok {
+			t.Errorf("want %v, got none", method)
+			continue
+		}
+		if got := types.ExprString(funcDecl.Type); want != got {
+			t.Errorf("want %v for %v, got %v", want, method, got)
+		}
+	}
+
+	filename := filepath.Join(dir, "sample.go")
+	wantWarnings := filename + ":10:6: skipped generic interface Pair; instantiate it with -iface, e.g., Pair[int, int]\n" +
+		filename + ":15:6: skipped generic interface Index; instantiate it with -iface, e.g., Index[string, int]\n" +
+		// no predeclared type has the method of the constraint
+		filename + ":19:6: skipped generic interface Sorter; instantiate it with -iface\n"
+	gotWarnings := warnings.String()
+
+	if wantWarnings != gotWarnings {
+		t.Errorf("want %v, got %v", wantWarnings, gotWarnings)
+	}
+}
+
+// TestRunRecordsInstancesInManifest ensures each instantiation is
+// recorded as written, at its generic interface
+func TestRunRecordsInstancesInManifest(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type User struct{}
+
+type Repo[T any] interface {
+	Get(id string) (T, error)
+}
+
+type Cache[K comparable, V any] interface {
+	Put(key K, value V)
+}
+`,
+	})
+	defer rmDir()
+
+	manifest := &fm.Manifest{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Instantiate:   []string{"Repo[sample.User]", "Cache[string, User]"},
+		Manifest:      manifest,
+	}
+	runChecked(t, cmd, dir, "fm_test.go")
+
+	if len(manifest.Packages) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(manifest.Packages))
+	}
+
+	filename := filepath.Join(dir, "sample.go")
+	want := []fm.ManifestInterface{
+		{Name: "Repo[User]", Position: filename + ":5:6", Generated: "SpyRepoUser"},
+		{Name: "Cache[string, User]", Position: filename + ":9:6", Generated: "SpyCacheStringUser"},
+	}
+	got := manifest.Packages[0].Interfaces
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunNamesInstancesAfterTheirStructure ensures instantiations with
+// the same named types in different structures, or with no named type
+// at all, receive distinct spies
+func TestRunNamesInstancesAfterTheirStructure(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type Item struct{}
+
+type Repo[T any] interface {
+	Get(id string) (T, error)
+}
+`,
+	})
+	defer rmDir()
+
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Instantiate: []string{
+			"Repo[Item]",
+			"Repo[*Item]",
+			"Repo[[]*Item]",
+			"Repo[map[string][2]Item]",
+			"Repo[chan struct{}]",
+		},
+	}
+	f := runChecked(t, cmd, dir, "fm_test.go")
+
+	want := map[string][]string{
+		"SpyRepoItem":                {"sample.Repo[sample.Item]"},
+		"SpyRepoPtrItem":             {"sample.Repo[*sample.Item]"},
+		"SpyRepoSlicePtrItem":        {"sample.Repo[[]*sample.Item]"},
+		"SpyRepoMapStringArray2Item": {"sample.Repo[map[string][2]sample.Item]"},
+		"SpyRepoChanStruct":          {"sample.Repo[chan struct{}]"},
+	}
+	got := assertedTypes(f)
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunRejectsInvalidInstantiations ensures instantiations of unknown
+// interfaces, or with the wrong number of type arguments, fail the run
+func TestRunRejectsInvalidInstantiations(t *testing.T) {
+	dir, rmDir := writeTree(t, map[string]string{
+		"sample.go": "package sample\n\ntype Repo[T any] interface {\n\tGet() T\n}\n",
+	})
+	defer rmDir()
+
+	for instantiation, want := range map[string]string{
+		"Store[int]":       "no generic interface Store in package sample",
+		"Repo[int, bool]":  "Repo has 1 type parameter(s), got 2 in Repo[int, bool]",
+		"Repo":             "Repo is not an instantiation, e.g., Repo[User]",
+		"other.Repo[User]": "instantiation other.Repo[User] does not name an interface of package sample",
+	} {
+		cmd := &fm.Cmd{
+			DeclGenerator: buildGen(),
+			Parser:        &fm.SrcFileParser{},
+			Writer:        &SpyWriter{},
+			ImportWriter:  &SpyImportWriter{},
+			Instantiate:   []string{instantiation},
+		}
+
+		err := cmd.Run(dir, "fm_test.go")
+		if err == nil {
+			t.Errorf("want error for %v, got nil", instantiation)
+			continue
+		}
+
+		got := err.Error()
+
+		if want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+}
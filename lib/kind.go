@@ -0,0 +1,74 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// KindGenerator generates the kind of test double chosen for each
+// interface by its //fm:kind directive, e.g., //fm:kind stub, or the
+// default kind for interfaces without one
+type KindGenerator struct {
+	// Default is the kind of test double generated when
+	// an interface has no //fm:kind directive
+	Default string
+	// Explicit marks a run generating the default kind only, e.g., one
+	// of several runs writing a file per kind. Interfaces with a //fm:kind
+	// directive are left out, as the run which is not explicit generates
+	// them, so that they are not declared twice
+	Explicit bool
+	// Generators maps each kind of test double to its generator
+	Generators map[string]DeclGenerator
+}
+
+// Generate passes each interface in the list of declarations to the
+// generator of its kind, in order, collecting the results
+func (g *KindGenerator) Generate(ds []ast.Decl) ([]ast.Decl, []Diagnostic) {
+	var decls []ast.Decl
+	var diags []Diagnostic
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			if !doubledType(typeSpec) {
+				continue
+			}
+
+			kind := g.Default
+			if dirs, _ := parseDirectives(genDecl.Doc, typeSpec.Doc); dirs.kind != "" {
+				if g.Explicit {
+					continue
+				}
+				kind = dirs.kind
+			}
+			gen, ok := g.Generators[kind]
+			if !ok {
+				diags = append(diags, Diagnostic{
+					Pos:     typeSpec.Pos(),
+					Message: fmt.Sprintf("skipped %s: unknown kind %q", typeSpec.Name.Name, kind),
+				})
+				continue
+			}
+
+			// each interface is generated on its own, keeping
+			// the doc comment which holds its directives
+			single := &ast.GenDecl{
+				Doc:   genDecl.Doc,
+				Tok:   token.TYPE,
+				Specs: []ast.Spec{typeSpec},
+			}
+			generated, generatedDiags := gen.Generate([]ast.Decl{single})
+			decls = append(decls, generated...)
+			diags = append(diags, generatedDiags...)
+		}
+	}
+	return decls, diags
+}
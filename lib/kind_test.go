@@ -0,0 +1,126 @@
+package fm_test
+
+import (
+	"go/ast"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestKindGeneratorFollowsKindDirective ensures each interface is passed
+// to the generator of the kind it asks for, or of the default kind
+func TestKindGeneratorFollowsKindDirective(t *testing.T) {
+	gen := &fm.KindGenerator{
+		Default: "spy",
+		Generators: map[string]fm.DeclGenerator{
+			"spy": buildGen(),
+			"stub": &fm.StubGenerator{
+				Converter:   &fm.StubStructConverter{},
+				Implementer: &fm.StubFuncImplementer{},
+			},
+		},
+	}
+	decls, diags := gen.Generate(parseDecls(t, `package sample
+
+type Doer interface {
+	Do() error
+}
+
+//fm:kind stub
+type Store interface {
+	Get() error
+}
+
+//fm:kind fake
+type Faker interface {
+	Fake()
+}`))
+
+	var names []string
+	for _, d := range decls {
+		if genDecl, ok := d.(*ast.GenDecl); ok && len(genDecl.Specs) == 1 {
+			if typeSpec, ok := genDecl.Specs[0].(*ast.TypeSpec); ok {
+				names = append(names, typeSpec.Name.Name)
+			}
+		}
+	}
+
+	want := "SpyDoer SpyDoerSnapshot StubStore"
+	got := strings.Join(names, " ")
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if len(diags) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(diags))
+	}
+
+	wantMessage := `skipped Faker: unknown kind "fake"`
+	gotMessage := diags[0].Message
+
+	if wantMessage != gotMessage {
+		t.Errorf("want %v, got %v", wantMessage, gotMessage)
+	}
+}
+
+// TestRunDeclaresDirectiveKindsOnceAcrossKindRuns ensures a run per kind,
+// each writing its own file, declares the double of an interface with a
+// //fm:kind directive in the run without the kind flag only
+func TestRunDeclaresDirectiveKindsOnceAcrossKindRuns(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type Doer interface {
+	Do() error
+}
+
+//fm:kind stub
+type Store interface {
+	Get() error
+}
+`,
+	})
+	defer rmDir()
+
+	generators := map[string]fm.DeclGenerator{
+		"spy":  buildGen(),
+		"mock": &fm.MockGenerator{},
+		"stub": &fm.StubGenerator{
+			Converter:   &fm.StubStructConverter{},
+			Implementer: &fm.StubFuncImplementer{},
+		},
+	}
+	runs := []struct {
+		kind     string
+		explicit bool
+		filename string
+	}{
+		{"spy", false, "fm_test.go"},
+		{"mock", true, "fm_mock_test.go"},
+		{"stub", true, "fm_stub_test.go"},
+	}
+
+	declared := make(map[string][]string)
+	for _, r := range runs {
+		gen := &fm.KindGenerator{Default: r.kind, Explicit: r.explicit, Generators: generators}
+		f := runChecked(t, &fm.Cmd{DeclGenerator: gen}, dir, r.filename)
+		for name := range declaredTypes(f) {
+			declared[name] = append(declared[name], r.filename)
+		}
+	}
+
+	want := "fm_test.go"
+	got := strings.Join(declared["StubStore"], " ")
+
+	if want != got {
+		t.Errorf("want StubStore in %v, got %v", want, got)
+	}
+
+	for _, name := range []string{"SpyDoer", "MockDoer", "StubDoer"} {
+		if len(declared[name]) != 1 {
+			t.Errorf("want %v declared once, got %v", name, declared[name])
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package fm
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// InterfaceInfo describes an interface found within a package and
+// whether test doubles can be generated for it
+type InterfaceInfo struct {
+	Package   string
+	Name      string
+	Position  token.Position
+	Methods   int
+	Supported bool
+	// Reason explains why an unsupported interface is skipped
+	Reason string
+}
+
+// List parses the directory and returns every interface it declares, in
+// order of position, applying the same filtering as Run to decide which
+// interfaces are supported
+func (c *Cmd) List(directory string) ([]InterfaceInfo, error) {
+	fset := token.NewFileSet()
+	pkgs, err := c.ParseDir(fset, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []InterfaceInfo
+	for _, pname := range sortedPackageNames(pkgs) {
+		for _, f := range sortedFiles(pkgs[pname]) {
+			var diags []Diagnostic
+			if !c.Internal {
+				_, diags = externalDecls(f.Decls)
+			}
+			_, generated := findInterfaces(f.Decls)
+			diags = append(diags, generated...)
+
+			for _, typeSpec := range doubledSpecs(f.Decls) {
+				info := InterfaceInfo{
+					Package:   pname,
+					Name:      typeSpec.Name.Name,
+					Position:  fset.Position(typeSpec.Pos()),
+					Methods:   methodCount(typeSpec),
+					Supported: true,
+				}
+				dirs, _ := parseDirectives(docOf(f.Decls, typeSpec), typeSpec.Doc)
+				if !selected(info.Name, c.Include, c.Exclude) {
+					info.Supported = false
+					info.Reason = "excluded by configuration"
+				}
+				if info.Supported && dirs.skip {
+					info.Supported = false
+					info.Reason = "skipped by " + directivePrefix + "skip"
+				}
+				for _, d := range diags {
+					if info.Supported && d.Pos >= typeSpec.Pos() && d.Pos < typeSpec.End() {
+						info.Supported = false
+						info.Reason = d.Message
+						break
+					}
+				}
+				infos = append(infos, info)
+			}
+		}
+	}
+	return infos, nil
+}
+
+// doubledSpecs returns the type specs of all interfaces and func types
+// declared in the list of declarations
+func doubledSpecs(ds []ast.Decl) []*ast.TypeSpec {
+	var specs []*ast.TypeSpec
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			if doubledType(typeSpec) {
+				specs = append(specs, typeSpec)
+			}
+		}
+	}
+	return specs
+}
+
+// docOf returns the doc comment of the declaration
+// which holds the type spec
+func docOf(ds []ast.Decl, t *ast.TypeSpec) *ast.CommentGroup {
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			if spec == t {
+				return genDecl.Doc
+			}
+		}
+	}
+	return nil
+}
+
+// methodCount returns the number of methods declared directly within
+// the interface, i.e., excluding those of embedded interfaces, or one
+// for a func type
+func methodCount(t *ast.TypeSpec) int {
+	var n int
+	for _, field := range methodsOf(t) {
+		n += len(field.Names)
+	}
+	return n
+}
@@ -0,0 +1,61 @@
+package fm_test
+
+import (
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestListReportsEachInterface ensures every interface is listed with its
+// method count and whether test doubles can be generated for it
+func TestListReportsEachInterface(t *testing.T) {
+	wd, err, rmTempFile := writeTmpFile(`package sample
+
+import "io"
+
+type Doer interface {
+	Do() error
+	Undo() error
+}
+
+type ReadDoer interface {
+	io.Reader
+	Do() error
+}
+
+type notADoer struct{}`)
+	defer rmTempFile()
+	if err != nil {
+		t.Fatalf("writeTmpFile failed with %v", err)
+	}
+
+	cmd := &fm.Cmd{Parser: &fm.SrcFileParser{}}
+	infos, err := cmd.List(wd)
+	if err != nil {
+		t.Fatalf("List failed with %v", err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("want %v, got %v", 2, len(infos))
+	}
+
+	doer := infos[0]
+	if doer.Package != "sample" || doer.Name != "Doer" || doer.Methods != 2 || !doer.Supported {
+		t.Errorf("want supported sample.Doer with 2 methods, got %+v", doer)
+	}
+	if doer.Position.Line != 5 {
+		t.Errorf("want %v, got %v", 5, doer.Position.Line)
+	}
+
+	readDoer := infos[1]
+	if readDoer.Name != "ReadDoer" || readDoer.Methods != 1 || readDoer.Supported {
+		t.Errorf("want unsupported ReadDoer with 1 method, got %+v", readDoer)
+	}
+
+	want := "skipped interface ReadDoer: embedded interface io.Reader is not supported"
+	got := readDoer.Reason
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,125 @@
+package fm
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// Manifest describes the test doubles generated by one or more runs,
+// in a form suitable for encoding as JSON
+type Manifest struct {
+	Packages []ManifestPackage `json:"packages"`
+}
+
+// ManifestPackage describes the test doubles generated for a package
+type ManifestPackage struct {
+	Name       string              `json:"name"`
+	Dir        string              `json:"dir"`
+	Output     string              `json:"output"`
+	Interfaces []ManifestInterface `json:"interfaces"`
+	Skipped    []ManifestSkipped   `json:"skipped"`
+}
+
+// ManifestInterface describes a source interface and the test double
+// generated from it
+type ManifestInterface struct {
+	Name      string `json:"name"`
+	Position  string `json:"position"`
+	Generated string `json:"generated"`
+}
+
+// ManifestSkipped describes a declaration which was skipped and why
+type ManifestSkipped struct {
+	Position string `json:"position"`
+	Reason   string `json:"reason"`
+}
+
+// add records the test doubles generated from the source declarations
+// of a package, pairing each interface with the type asserted to
+// implement it, along with the diagnostics for skipped declarations.
+// Doubled names the source declaration of generated structs asserted
+// to implement another type, e.g., an interface literal.
+func (m *Manifest) add(fset *token.FileSet, pname, dir, output string, sources []ast.Decl, doubled map[string]string, generated []ast.Decl, diags []Diagnostic) {
+	pkg := ManifestPackage{
+		Name:       pname,
+		Dir:        dir,
+		Output:     output,
+		Interfaces: []ManifestInterface{},
+		Skipped:    []ManifestSkipped{},
+	}
+
+	positions := make(map[string]token.Pos)
+	for _, d := range sources {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+				positions[typeSpec.Name.Name] = typeSpec.Pos()
+			}
+		}
+	}
+
+	for _, d := range generated {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec, ok := spec.(*ast.ValueSpec)
+			if !ok || len(valueSpec.Values) != 1 {
+				continue
+			}
+			structName := assertedStruct(valueSpec.Values[0])
+			if structName == "" {
+				continue
+			}
+
+			var name string
+			switch t := valueSpec.Type.(type) {
+			case *ast.Ident:
+				name = t.Name
+			case *ast.SelectorExpr:
+				name = t.Sel.Name
+			case *ast.IndexExpr, *ast.IndexListExpr:
+				// e.g., Repo[User] for example.Repo[example.User]
+				name = types.ExprString(unqualify(stripPos(t).(ast.Expr), pname))
+			}
+			// the source declaration is positioned, e.g., at the field
+			// of a dependency, and names those without a name of their own
+			source, ok := doubled[structName]
+			if !ok {
+				source = name
+			}
+			if name == "" {
+				name = source
+			}
+			if name == "" {
+				continue
+			}
+			pkg.Interfaces = append(pkg.Interfaces, ManifestInterface{
+				Name:      name,
+				Position:  fset.Position(positions[source]).String(),
+				Generated: structName,
+			})
+		}
+	}
+
+	for _, d := range diags {
+		pkg.Skipped = append(pkg.Skipped, ManifestSkipped{
+			Position: fset.Position(d.Pos).String(),
+			Reason:   d.Message,
+		})
+	}
+
+	m.Packages = append(m.Packages, pkg)
+	sort.SliceStable(m.Packages, func(i, j int) bool {
+		if m.Packages[i].Dir != m.Packages[j].Dir {
+			return m.Packages[i].Dir < m.Packages[j].Dir
+		}
+		return m.Packages[i].Name < m.Packages[j].Name
+	})
+}
@@ -0,0 +1,839 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+const (
+	mockPrefix      = "Mock"
+	expectPrefix    = "Expect"
+	callSuffix      = "Call"
+	expectedSuffix  = "_expected"
+	matchSuffix     = "_match"
+	matchPrefix     = "Match"
+	anyPrefix       = "Any"
+	callRecvName    = "c"
+	mockConstructor = "New"
+)
+
+// MockGenerator creates mock implementations of interface declarations.
+// Unlike a spy, a mock is told up front which calls to expect. It fails
+// the test on any unexpected call, which it answers with zero values, and
+// checks that all expected calls were made once the test has finished.
+// Mocks only ever call Errorf, so they may be called from any goroutine.
+type MockGenerator struct{}
+
+// Generate transforms all the interfaces in the list of declarations
+// into mocks, each with a constructor, a struct for every method's
+// expected calls, and implemented functions
+func (g *MockGenerator) Generate(ds []ast.Decl) ([]ast.Decl, []Diagnostic) {
+	var decls []ast.Decl
+	interfaces, diags := findInterfaces(ds)
+	for _, found := range interfaces {
+		typeSpec := found.spec
+		interfaceType := typeSpec.Type.(*ast.InterfaceType)
+		mockName := mockPrefix + typeSpec.Name.Name
+		if found.name != "" {
+			mockName = found.name
+		}
+		methods := mockMethods(interfaceType)
+
+		decls = append(decls, &ast.GenDecl{
+			Tok:   token.TYPE,
+			Specs: []ast.Spec{buildMockStruct(mockName, methods)},
+		})
+		decls = append(decls, createMockConstructor(mockName))
+		decls = append(decls, createInOrder(mockName))
+
+		for _, m := range methods {
+			callName := mockName + m.Names[0].Name + callSuffix
+			decls = append(decls, &ast.GenDecl{
+				Tok:   token.TYPE,
+				Specs: []ast.Spec{buildCallStruct(mockName, callName, m)},
+			})
+			decls = append(decls, createExpect(mockName, callName, m))
+			for idx, t := range paramTypes(m.Type.(*ast.FuncType)) {
+				decls = append(decls, createMatch(callName, idx, t))
+				decls = append(decls, createAny(callName, idx, t))
+			}
+			if len(resultTypes(m.Type.(*ast.FuncType))) > 0 {
+				decls = append(decls, createReturn(callName, m))
+			}
+			decls = append(decls, createTimes(callName))
+			decls = append(decls, createMockFunc(mockName, m))
+		}
+
+		decls = append(decls, createVerify(mockName, methods))
+		decls = append(decls, found.assertion(mockName))
+	}
+
+	return decls, diags
+}
+
+// mockMethods returns the interface's methods which can be mocked
+func mockMethods(i *ast.InterfaceType) []*ast.Field {
+	var methods []*ast.Field
+	for _, field := range i.Methods.List {
+		if _, ok := field.Type.(*ast.FuncType); !ok {
+			continue
+		}
+		if len(field.Names) != 1 {
+			continue
+		}
+		methods = append(methods, field)
+	}
+	return methods
+}
+
+// buildMockStruct writes the mock's struct type, which holds the
+// test to fail along with the expected calls to each method
+func buildMockStruct(mockName string, methods []*ast.Field) *ast.TypeSpec {
+	list := []*ast.Field{
+		{
+			Names: []*ast.Ident{ast.NewIdent("mu")},
+			Type:  selector("sync", "Mutex"),
+		},
+		{
+			Names: []*ast.Ident{ast.NewIdent("t")},
+			Type:  selector("testing", "TB"),
+		},
+		{
+			Names: []*ast.Ident{ast.NewIdent("ordered")},
+			Type:  ast.NewIdent("bool"),
+		},
+		{
+			// seq numbers expected calls in the order they were declared
+			Names: []*ast.Ident{ast.NewIdent("seq"), ast.NewIdent("last")},
+			Type:  ast.NewIdent("int"),
+		},
+	}
+
+	for _, m := range methods {
+		callName := mockName + m.Names[0].Name + callSuffix
+		list = append(list, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(unexported(m.Names[0].Name) + expectedSuffix)},
+			Type:  &ast.ArrayType{Elt: &ast.StarExpr{X: ast.NewIdent(callName)}},
+		})
+	}
+
+	return &ast.TypeSpec{
+		Name: ast.NewIdent(mockName),
+		Type: &ast.StructType{Fields: &ast.FieldList{List: list}},
+	}
+}
+
+// buildCallStruct writes a struct type for an expected call to a method,
+// holding the expected arguments, the values to return, and any funcs
+// matching arguments in place of the expected ones
+func buildCallStruct(mockName, callName string, m *ast.Field) *ast.TypeSpec {
+	funcType := m.Type.(*ast.FuncType)
+	list := []*ast.Field{
+		{
+			Names: []*ast.Ident{ast.NewIdent("mock")},
+			Type:  &ast.StarExpr{X: ast.NewIdent(mockName)},
+		},
+		{
+			Names: []*ast.Ident{
+				ast.NewIdent("seq"),
+				ast.NewIdent("times"),
+				ast.NewIdent("calls"),
+			},
+			Type: ast.NewIdent("int"),
+		},
+	}
+
+	if len(funcType.Params.List) > 0 {
+		list = append(list, buildStruct("Input", argPrefix, funcType.Params.List))
+	}
+	if funcType.Results != nil && len(funcType.Results.List) > 0 {
+		list = append(list, buildStruct("Output", retPrefix, funcType.Results.List))
+	}
+	for idx, t := range paramTypes(funcType) {
+		list = append(list, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(matchField(idx))},
+			Type:  matcherType(t),
+		})
+	}
+
+	return &ast.TypeSpec{
+		Name: ast.NewIdent(callName),
+		Type: &ast.StructType{Fields: &ast.FieldList{List: list}},
+	}
+}
+
+// createMockConstructor builds a function which returns a mock that
+// reports to t:
+//
+//	func NewMockFoo(t testing.TB) *MockFoo {
+//		f := &MockFoo{t: t}
+//		t.Cleanup(f.verify)
+//		return f
+//	}
+func createMockConstructor(mockName string) *ast.FuncDecl {
+	return &ast.FuncDecl{
+		Doc: docComment(
+			fmt.Sprintf("%s%s returns a %s which fails t on any unexpected call", mockConstructor, mockName, mockName),
+			"and checks that all expected calls were made when t finishes",
+		),
+		Name: ast.NewIdent(mockConstructor + mockName),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent("t")},
+				Type:  selector("testing", "TB"),
+			}}},
+			Results: &ast.FieldList{List: []*ast.Field{{
+				Type: &ast.StarExpr{X: ast.NewIdent(mockName)},
+			}}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent(recvName)},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{&ast.UnaryExpr{
+					Op: token.AND,
+					X: &ast.CompositeLit{
+						Type: ast.NewIdent(mockName),
+						Elts: []ast.Expr{&ast.KeyValueExpr{
+							Key:   ast.NewIdent("t"),
+							Value: ast.NewIdent("t"),
+						}},
+					},
+				}},
+			},
+			&ast.ExprStmt{X: &ast.CallExpr{
+				Fun:  selector("t", "Cleanup"),
+				Args: []ast.Expr{recvSelector("verify")},
+			}},
+			&ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent(recvName)}},
+		}},
+	}
+}
+
+// createInOrder builds a function which makes the mock require that
+// expected calls are made in the order they were declared
+func createInOrder(mockName string) *ast.FuncDecl {
+	return &ast.FuncDecl{
+		Doc:  docComment("InOrder requires expected calls to be made in the order they were declared"),
+		Recv: mockRecv(mockName),
+		Name: ast.NewIdent("InOrder"),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{{
+				Type: &ast.StarExpr{X: ast.NewIdent(mockName)},
+			}}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			lockStmt(),
+			deferUnlockStmt(),
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{recvSelector("ordered")},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{ast.NewIdent("true")},
+			},
+			&ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent(recvName)}},
+		}},
+	}
+}
+
+// createExpect builds a function which declares an expected call to
+// a method with the given arguments:
+//
+//	func (f *MockFoo) ExpectBar(task string) *MockFooBarCall {
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//		f.seq++
+//		call := &MockFooBarCall{mock: f, seq: f.seq, times: 1}
+//		call.Input.Arg0 = task
+//		f.bar_expected = append(f.bar_expected, call)
+//		return call
+//	}
+func createExpect(mockName, callName string, m *ast.Field) *ast.FuncDecl {
+	fname := m.Names[0].Name
+	funcType := m.Type.(*ast.FuncType)
+	call := ast.NewIdent(uniqueName("call", funcType))
+
+	list := []ast.Stmt{
+		lockStmt(),
+		deferUnlockStmt(),
+		&ast.IncDecStmt{X: recvSelector("seq"), Tok: token.INC},
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{call},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.UnaryExpr{
+				Op: token.AND,
+				X: &ast.CompositeLit{
+					Type: ast.NewIdent(callName),
+					Elts: []ast.Expr{
+						&ast.KeyValueExpr{Key: ast.NewIdent("mock"), Value: ast.NewIdent(recvName)},
+						&ast.KeyValueExpr{Key: ast.NewIdent("seq"), Value: recvSelector("seq")},
+						&ast.KeyValueExpr{Key: ast.NewIdent("times"), Value: &ast.BasicLit{Kind: token.INT, Value: "1"}},
+					},
+				},
+			}},
+		},
+	}
+	for idx, arg := range paramNames(funcType) {
+		list = append(list, &ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.SelectorExpr{
+				X:   &ast.SelectorExpr{X: call, Sel: ast.NewIdent("Input")},
+				Sel: ast.NewIdent(fmt.Sprintf("%s%d", argPrefix, idx)),
+			}},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{arg},
+		})
+	}
+	expected := recvSelector(unexported(fname) + expectedSuffix)
+	list = append(list,
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{expected},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{&ast.CallExpr{
+				Fun:  ast.NewIdent("append"),
+				Args: []ast.Expr{expected, call},
+			}},
+		},
+		&ast.ReturnStmt{Results: []ast.Expr{call}},
+	)
+
+	return &ast.FuncDecl{
+		Doc: docComment(
+			fmt.Sprintf("%s%s declares an expected call to %s with the given arguments.", expectPrefix, fname, fname),
+			"The call is expected once unless set otherwise with Times",
+		),
+		Recv: mockRecv(mockName),
+		Name: ast.NewIdent(expectPrefix + fname),
+		Type: &ast.FuncType{
+			Params: funcType.Params,
+			Results: &ast.FieldList{List: []*ast.Field{{
+				Type: &ast.StarExpr{X: ast.NewIdent(callName)},
+			}}},
+		},
+		Body: &ast.BlockStmt{List: list},
+	}
+}
+
+// createMatch builds a function which matches an argument of the
+// expected call with a func in place of the expected value:
+//
+//	func (c *MockFooBarCall) MatchArg0(match func(string) bool) *MockFooBarCall {
+//		c.mock.mu.Lock()
+//		defer c.mock.mu.Unlock()
+//		c.arg0_match = match
+//		return c
+//	}
+func createMatch(callName string, idx int, t ast.Expr) *ast.FuncDecl {
+	name := fmt.Sprintf("%s%s%d", matchPrefix, argPrefix, idx)
+	return &ast.FuncDecl{
+		Doc: docComment(
+			fmt.Sprintf("%s matches argument %d of the call with match in place of the", name, idx),
+			"expected value, e.g., for a value which the code under test builds itself",
+		),
+		Recv: callRecv(callName),
+		Name: ast.NewIdent(name),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent("match")},
+				Type:  matcherType(t),
+			}}},
+			Results: &ast.FieldList{List: []*ast.Field{{
+				Type: &ast.StarExpr{X: ast.NewIdent(callName)},
+			}}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			callLockStmt(),
+			callDeferUnlockStmt(),
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{selector(callRecvName, matchField(idx))},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{ast.NewIdent("match")},
+			},
+			&ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent(callRecvName)}},
+		}},
+	}
+}
+
+// createAny builds a function which matches any value of an argument
+// of the expected call:
+//
+//	func (c *MockFooBarCall) AnyArg0() *MockFooBarCall {
+//		return c.MatchArg0(func(string) bool { return true })
+//	}
+func createAny(callName string, idx int, t ast.Expr) *ast.FuncDecl {
+	name := fmt.Sprintf("%s%s%d", anyPrefix, argPrefix, idx)
+	return &ast.FuncDecl{
+		Doc:  docComment(fmt.Sprintf("%s matches the call whatever its argument %d", name, idx)),
+		Recv: callRecv(callName),
+		Name: ast.NewIdent(name),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{{
+				Type: &ast.StarExpr{X: ast.NewIdent(callName)},
+			}}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.ReturnStmt{Results: []ast.Expr{&ast.CallExpr{
+				Fun: selector(callRecvName, fmt.Sprintf("%s%s%d", matchPrefix, argPrefix, idx)),
+				Args: []ast.Expr{&ast.FuncLit{
+					Type: matcherType(t),
+					Body: &ast.BlockStmt{List: []ast.Stmt{
+						&ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent("true")}},
+					}},
+				}},
+			}}},
+		}},
+	}
+}
+
+// matchField returns the name of the field holding the matcher of an
+// argument, e.g., arg0_match
+func matchField(idx int) string {
+	return fmt.Sprintf("%s%d%s", unexported(argPrefix), idx, matchSuffix)
+}
+
+// matcherType returns the type of a func matching an argument of the
+// given type, e.g., func(string) bool
+func matcherType(t ast.Expr) *ast.FuncType {
+	return &ast.FuncType{
+		Params:  &ast.FieldList{List: []*ast.Field{{Type: storedType(t)}}},
+		Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent("bool")}}},
+	}
+}
+
+// createReturn builds a function which sets the values an expected call
+// returns:
+//
+//	func (c *MockFooBarCall) Return(ret0 int, ret1 error) *MockFooBarCall {
+//		c.mock.mu.Lock()
+//		defer c.mock.mu.Unlock()
+//		c.Output.Ret0 = ret0
+//		c.Output.Ret1 = ret1
+//		return c
+//	}
+func createReturn(callName string, m *ast.Field) *ast.FuncDecl {
+	var params []*ast.Field
+	list := []ast.Stmt{callLockStmt(), callDeferUnlockStmt()}
+	for idx, t := range resultTypes(m.Type.(*ast.FuncType)) {
+		ret := ast.NewIdent(fmt.Sprintf("ret%d", idx))
+		params = append(params, &ast.Field{Names: []*ast.Ident{ret}, Type: t})
+		list = append(list, &ast.AssignStmt{
+			Lhs: []ast.Expr{selector(callRecvName, "Output", fmt.Sprintf("%s%d", retPrefix, idx))},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{ret},
+		})
+	}
+	list = append(list, &ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent(callRecvName)}})
+
+	return &ast.FuncDecl{
+		Doc:  docComment("Return sets the values returned by the expected call"),
+		Recv: callRecv(callName),
+		Name: ast.NewIdent("Return"),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{List: params},
+			Results: &ast.FieldList{List: []*ast.Field{{
+				Type: &ast.StarExpr{X: ast.NewIdent(callName)},
+			}}},
+		},
+		Body: &ast.BlockStmt{List: list},
+	}
+}
+
+// createTimes builds a function which sets how many times a call
+// is expected to be made
+func createTimes(callName string) *ast.FuncDecl {
+	return &ast.FuncDecl{
+		Doc:  docComment("Times sets the number of times the call is expected to be made"),
+		Recv: callRecv(callName),
+		Name: ast.NewIdent("Times"),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent("n")},
+				Type:  ast.NewIdent("int"),
+			}}},
+			Results: &ast.FieldList{List: []*ast.Field{{
+				Type: &ast.StarExpr{X: ast.NewIdent(callName)},
+			}}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			callLockStmt(),
+			callDeferUnlockStmt(),
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{selector(callRecvName, "times")},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{ast.NewIdent("n")},
+			},
+			&ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent(callRecvName)}},
+		}},
+	}
+}
+
+// createMockFunc builds the mock's implementation of a method, which
+// returns the values of the first expected call matching its arguments.
+// The arguments are matched against copies of the expected calls outside
+// of the lock, so that matchers may call the mock, unless there are none
+// to match. Unexpected calls fail the test with Errorf rather than Fatalf,
+// which must not be called from goroutines the code under test starts,
+// and return zero values:
+//
+//	func (f *MockFoo) Bar(task string) (int, error) {
+//		f.t.Helper()
+//		f.mu.Lock()
+//		expected := make([]MockFooBarCall, len(f.bar_expected))
+//		for i, call := range f.bar_expected {
+//			expected[i] = *call
+//		}
+//		f.mu.Unlock()
+//		matched := make([]bool, len(expected))
+//		for i, call := range expected {
+//			if call.arg0_match != nil {
+//				if !call.arg0_match(task) {
+//					continue
+//				}
+//			} else if !reflect.DeepEqual(call.Input.Arg0, task) {
+//				continue
+//			}
+//			matched[i] = true
+//		}
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//		for i, call := range f.bar_expected[:len(matched)] {
+//			if !matched[i] || call.calls >= call.times {
+//				continue
+//			}
+//			if f.ordered && call.seq < f.last {
+//				f.t.Errorf("call to Bar(%#v) made out of order", task)
+//			}
+//			f.last = call.seq
+//			call.calls++
+//			return call.Output.Ret0, call.Output.Ret1
+//		}
+//		f.t.Errorf("unexpected call to Bar(%#v)", task)
+//		return *new(int), *new(error)
+//	}
+func createMockFunc(mockName string, m *ast.Field) *ast.FuncDecl {
+	fname := m.Names[0].Name
+	funcType := m.Type.(*ast.FuncType)
+	callName := mockName + fname + callSuffix
+	call := ast.NewIdent(uniqueName("call", funcType))
+	idx := ast.NewIdent(uniqueName("i", funcType))
+	expected := ast.NewIdent(uniqueName("expected", funcType))
+	matched := ast.NewIdent(uniqueName("matched", funcType))
+	args := paramNames(funcType)
+	argTypes := paramTypes(funcType)
+
+	// copy the expected calls while holding the lock
+	copyStmts := []ast.Stmt{
+		lockStmt(),
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{expected},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.CallExpr{
+				Fun: ast.NewIdent("make"),
+				Args: []ast.Expr{
+					&ast.ArrayType{Elt: ast.NewIdent(callName)},
+					lenCall(recvSelector(unexported(fname) + expectedSuffix)),
+				},
+			}},
+		},
+		&ast.RangeStmt{
+			Key:   idx,
+			Value: call,
+			Tok:   token.DEFINE,
+			X:     recvSelector(unexported(fname) + expectedSuffix),
+			Body: &ast.BlockStmt{List: []ast.Stmt{&ast.AssignStmt{
+				Lhs: []ast.Expr{&ast.IndexExpr{X: expected, Index: idx}},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{&ast.StarExpr{X: call}},
+			}}},
+		},
+		unlockStmt(),
+	}
+
+	// match the arguments against the copies without holding the lock
+	var matchLoop []ast.Stmt
+	for i, arg := range args {
+		matchLoop = append(matchLoop, matchStmt(call, i, arg, argTypes[i]))
+	}
+	matchLoop = append(matchLoop, &ast.AssignStmt{
+		Lhs: []ast.Expr{&ast.IndexExpr{X: matched, Index: idx}},
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{ast.NewIdent("true")},
+	})
+	matchStmts := []ast.Stmt{
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{matched},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.CallExpr{
+				Fun:  ast.NewIdent("make"),
+				Args: []ast.Expr{&ast.ArrayType{Elt: ast.NewIdent("bool")}, lenCall(expected)},
+			}},
+		},
+		&ast.RangeStmt{
+			Key:   idx,
+			Value: call,
+			Tok:   token.DEFINE,
+			X:     expected,
+			Body:  &ast.BlockStmt{List: matchLoop},
+		},
+	}
+
+	var rets []ast.Expr
+	var zeros []ast.Expr
+	for i, t := range resultTypes(funcType) {
+		rets = append(rets, &ast.SelectorExpr{
+			X:   &ast.SelectorExpr{X: call, Sel: ast.NewIdent("Output")},
+			Sel: ast.NewIdent(fmt.Sprintf("%s%d", retPrefix, i)),
+		})
+		zeros = append(zeros, zeroValue(t))
+	}
+
+	var skipCond ast.Expr = &ast.BinaryExpr{
+		X:  &ast.SelectorExpr{X: call, Sel: ast.NewIdent("calls")},
+		Op: token.GEQ,
+		Y:  &ast.SelectorExpr{X: call, Sel: ast.NewIdent("times")},
+	}
+	var key ast.Expr = ast.NewIdent("_")
+	var expectedCalls ast.Expr = recvSelector(unexported(fname) + expectedSuffix)
+	if len(args) > 0 {
+		skipCond = &ast.BinaryExpr{
+			X:  &ast.UnaryExpr{Op: token.NOT, X: &ast.IndexExpr{X: matched, Index: idx}},
+			Op: token.LOR,
+			Y:  skipCond,
+		}
+		key = idx
+		// expected calls are only ever appended, so the matched ones are
+		// the first len(matched) of them
+		expectedCalls = &ast.SliceExpr{X: expectedCalls, High: lenCall(matched)}
+	}
+	loop := []ast.Stmt{
+		&ast.IfStmt{
+			Cond: skipCond,
+			Body: &ast.BlockStmt{List: []ast.Stmt{&ast.BranchStmt{Tok: token.CONTINUE}}},
+		},
+		&ast.IfStmt{
+			Cond: &ast.BinaryExpr{
+				X:  recvSelector("ordered"),
+				Op: token.LAND,
+				Y: &ast.BinaryExpr{
+					X:  &ast.SelectorExpr{X: call, Sel: ast.NewIdent("seq")},
+					Op: token.LSS,
+					Y:  recvSelector("last"),
+				},
+			},
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				failStmt("Errorf", "call to "+callFormat(fname, argTypes)+" made out of order", args...),
+			}},
+		},
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{recvSelector("last")},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{&ast.SelectorExpr{X: call, Sel: ast.NewIdent("seq")}},
+		},
+		&ast.IncDecStmt{
+			X:   &ast.SelectorExpr{X: call, Sel: ast.NewIdent("calls")},
+			Tok: token.INC,
+		},
+		&ast.ReturnStmt{Results: rets},
+	}
+
+	list := []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{Fun: recvSelector("t", "Helper")}}}
+	if len(args) > 0 {
+		list = append(list, copyStmts...)
+		list = append(list, matchStmts...)
+	}
+	list = append(list,
+		lockStmt(),
+		deferUnlockStmt(),
+		&ast.RangeStmt{
+			Key:   key,
+			Value: call,
+			Tok:   token.DEFINE,
+			X:     expectedCalls,
+			Body:  &ast.BlockStmt{List: loop},
+		},
+		failStmt("Errorf", "unexpected call to "+callFormat(fname, argTypes), args...),
+		&ast.ReturnStmt{Results: zeros},
+	)
+
+	return &ast.FuncDecl{
+		Doc:  docComment(fmt.Sprintf("%s returns the values of the first expected call matching its arguments", fname)),
+		Recv: mockRecv(mockName),
+		Name: m.Names[0],
+		Type: funcType,
+		Body: &ast.BlockStmt{List: list},
+	}
+}
+
+// lenCall returns the expression len(x)
+func lenCall(x ast.Expr) ast.Expr {
+	return &ast.CallExpr{Fun: ast.NewIdent("len"), Args: []ast.Expr{x}}
+}
+
+// matchStmt returns a statement which skips the expected call unless
+// the argument matches, either by the call's matcher or by being equal
+// to the expected value. Functions cannot be compared, so unless there
+// is a matcher, any function matches
+func matchStmt(call *ast.Ident, idx int, arg, t ast.Expr) ast.Stmt {
+	matcher := &ast.SelectorExpr{X: call, Sel: ast.NewIdent(matchField(idx))}
+	continueBlock := &ast.BlockStmt{List: []ast.Stmt{&ast.BranchStmt{Tok: token.CONTINUE}}}
+	notMatched := &ast.UnaryExpr{
+		Op: token.NOT,
+		X:  &ast.CallExpr{Fun: matcher, Args: []ast.Expr{arg}},
+	}
+	if isFuncType(t) {
+		return &ast.IfStmt{
+			Cond: &ast.BinaryExpr{
+				X:  &ast.BinaryExpr{X: matcher, Op: token.NEQ, Y: ast.NewIdent("nil")},
+				Op: token.LAND,
+				Y:  notMatched,
+			},
+			Body: continueBlock,
+		}
+	}
+
+	return &ast.IfStmt{
+		Cond: &ast.BinaryExpr{X: matcher, Op: token.NEQ, Y: ast.NewIdent("nil")},
+		Body: &ast.BlockStmt{List: []ast.Stmt{&ast.IfStmt{Cond: notMatched, Body: continueBlock}}},
+		Else: &ast.IfStmt{
+			Cond: &ast.UnaryExpr{
+				Op: token.NOT,
+				X: &ast.CallExpr{
+					Fun: selector("reflect", "DeepEqual"),
+					Args: []ast.Expr{
+						&ast.SelectorExpr{
+							X:   &ast.SelectorExpr{X: call, Sel: ast.NewIdent("Input")},
+							Sel: ast.NewIdent(fmt.Sprintf("%s%d", argPrefix, idx)),
+						},
+						arg,
+					},
+				},
+			},
+			Body: continueBlock,
+		},
+	}
+}
+
+// createVerify builds a function, run when the test finishes, which
+// fails the test for every expected call that was not made:
+//
+//	func (f *MockFoo) verify() {
+//		f.t.Helper()
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//		for _, call := range f.bar_expected {
+//			if call.calls < call.times {
+//				f.t.Errorf("expected %d call(s) to Bar(%#v), got %d", call.times, call.Input.Arg0, call.calls)
+//			}
+//		}
+//	}
+func createVerify(mockName string, methods []*ast.Field) *ast.FuncDecl {
+	list := []ast.Stmt{
+		&ast.ExprStmt{X: &ast.CallExpr{Fun: recvSelector("t", "Helper")}},
+		lockStmt(),
+		deferUnlockStmt(),
+	}
+
+	for _, m := range methods {
+		fname := m.Names[0].Name
+		funcType := m.Type.(*ast.FuncType)
+		call := ast.NewIdent("call")
+
+		args := []ast.Expr{&ast.SelectorExpr{X: call, Sel: ast.NewIdent("times")}}
+		argTypes := paramTypes(funcType)
+		for idx := range argTypes {
+			args = append(args, &ast.SelectorExpr{
+				X:   &ast.SelectorExpr{X: call, Sel: ast.NewIdent("Input")},
+				Sel: ast.NewIdent(fmt.Sprintf("%s%d", argPrefix, idx)),
+			})
+		}
+		args = append(args, &ast.SelectorExpr{X: call, Sel: ast.NewIdent("calls")})
+
+		list = append(list, &ast.RangeStmt{
+			Key:   ast.NewIdent("_"),
+			Value: call,
+			Tok:   token.DEFINE,
+			X:     recvSelector(unexported(fname) + expectedSuffix),
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				&ast.IfStmt{
+					Cond: &ast.BinaryExpr{
+						X:  &ast.SelectorExpr{X: call, Sel: ast.NewIdent("calls")},
+						Op: token.LSS,
+						Y:  &ast.SelectorExpr{X: call, Sel: ast.NewIdent("times")},
+					},
+					Body: &ast.BlockStmt{List: []ast.Stmt{
+						failStmt("Errorf", "expected %d call(s) to "+callFormat(fname, argTypes)+", got %d", args...),
+					}},
+				},
+			}},
+		})
+	}
+
+	return &ast.FuncDecl{
+		Doc:  docComment("verify fails the test for every expected call that was not made"),
+		Recv: mockRecv(mockName),
+		Name: ast.NewIdent("verify"),
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{List: list},
+	}
+}
+
+// callFormat returns a format string describing a call to the named
+// function with arguments of the given types, e.g., Bar(%#v, %T).
+// Functions are described by their type alone
+func callFormat(fname string, argTypes []ast.Expr) string {
+	verbs := make([]string, len(argTypes))
+	for i, t := range argTypes {
+		verbs[i] = "%#v"
+		if isFuncType(t) {
+			verbs[i] = "%T"
+		}
+	}
+	return fmt.Sprintf("%s(%s)", fname, strings.Join(verbs, ", "))
+}
+
+// isFuncType reports whether the type expression is a function type
+func isFuncType(t ast.Expr) bool {
+	if paren, ok := t.(*ast.ParenExpr); ok {
+		return isFuncType(paren.X)
+	}
+	_, ok := t.(*ast.FuncType)
+	return ok
+}
+
+// failStmt returns a call to the mock's test, e.g., f.t.Errorf(format, args...)
+func failStmt(method, format string, args ...ast.Expr) ast.Stmt {
+	callArgs := []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("%q", format)}}
+	callArgs = append(callArgs, args...)
+	return &ast.ExprStmt{X: &ast.CallExpr{
+		Fun:  recvSelector("t", method),
+		Args: callArgs,
+	}}
+}
+
+// mockRecv returns the receiver of a mock's functions
+func mockRecv(mockName string) *ast.FieldList {
+	return &ast.FieldList{List: []*ast.Field{{
+		Names: []*ast.Ident{ast.NewIdent(recvName)},
+		Type:  &ast.StarExpr{X: ast.NewIdent(mockName)},
+	}}}
+}
+
+// callRecv returns the receiver of an expected call's functions
+func callRecv(callName string) *ast.FieldList {
+	return &ast.FieldList{List: []*ast.Field{{
+		Names: []*ast.Ident{ast.NewIdent(callRecvName)},
+		Type:  &ast.StarExpr{X: ast.NewIdent(callName)},
+	}}}
+}
+
+// callLockStmt returns the statement c.mock.mu.Lock()
+func callLockStmt() ast.Stmt {
+	return &ast.ExprStmt{X: &ast.CallExpr{Fun: selector(callRecvName, "mock", "mu", "Lock")}}
+}
+
+// callDeferUnlockStmt returns the statement defer c.mock.mu.Unlock()
+func callDeferUnlockStmt() ast.Stmt {
+	return &ast.DeferStmt{Call: &ast.CallExpr{Fun: selector(callRecvName, "mock", "mu", "Unlock")}}
+}
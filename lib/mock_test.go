@@ -0,0 +1,166 @@
+package fm_test
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestMockGenerateReturnsSliceOfMockDecls ensures the generator produces
+// the following declarations for a single interface with a single method
+// that has no arguments and no return values:
+// 1) a struct for the mock,
+// 2) a constructor and an InOrder function,
+// 3) a struct for expected calls of the method along with a Times function,
+// 4) a mock implementation of the interface's single method,
+// 5) a function to verify all expected calls were made, and
+// 6) an assertion that the mock implements the interface.
+func TestMockGenerateReturnsSliceOfMockDecls(t *testing.T) {
+	gen := &fm.MockGenerator{}
+	interfaceDecls := buildInterfaceAST()
+	mockDecls, _ := gen.Generate(interfaceDecls)
+
+	want := 9
+	got := len(mockDecls)
+
+	if want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	wantName := "NewMockTester"
+	gotName := mockDecls[1].(*ast.FuncDecl).Name.Name
+
+	if wantName != gotName {
+		t.Errorf("want %v, got %v", wantName, gotName)
+	}
+}
+
+func TestMockGenerateAddsExpectFunction(t *testing.T) {
+	gen := &fm.MockGenerator{}
+	mockDecls, _ := gen.Generate(buildInterfaceAST())
+
+	var names []string
+	for _, d := range mockDecls {
+		if fd, ok := d.(*ast.FuncDecl); ok {
+			names = append(names, fd.Name.Name)
+		}
+	}
+
+	want := "ExpectTest"
+	for _, got := range names {
+		if want == got {
+			return
+		}
+	}
+	t.Errorf("want %v in %v", want, names)
+}
+
+func TestMockGenerateSkipsTypeSpecsThatAreNotInterfaceTypes(t *testing.T) {
+	gen := &fm.MockGenerator{}
+	mockDecls, _ := gen.Generate(buildStructAST())
+
+	want := 0
+	got := len(mockDecls)
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestMockGenerateMatchesAnyFunctionArgument ensures function arguments,
+// which cannot be compared, are described by type and left out of matching
+func TestMockGenerateMatchesAnyFunctionArgument(t *testing.T) {
+	gen := &fm.MockGenerator{}
+	mockDecls, _ := gen.Generate(parseDecls(t, `package sample
+
+type Walker interface {
+	Walk(fn func(string) bool)
+}`))
+
+	var buf bytes.Buffer
+	err := format.Node(&buf, token.NewFileSet(), &ast.File{
+		Name:  ast.NewIdent("sample"),
+		Decls: mockDecls,
+	})
+	if err != nil {
+		t.Fatalf("format failed with %v", err)
+	}
+	src := buf.String()
+
+	if strings.Contains(src, "reflect.DeepEqual") {
+		t.Errorf("want no comparison of function arguments, got %v", src)
+	}
+
+	want := `"unexpected call to Walk(%T)", fn`
+	if !strings.Contains(src, want) {
+		t.Errorf("want %v in %v", want, src)
+	}
+}
+
+// TestMockGenerateAddsMatchersPerArgument ensures each argument may be
+// matched by a func, or by anything, and that unexpected calls fail the
+// test without stopping the goroutine which made them
+func TestMockGenerateAddsMatchersPerArgument(t *testing.T) {
+	gen := &fm.MockGenerator{}
+	mockDecls, _ := gen.Generate(parseDecls(t, `package sample
+
+type Getter interface {
+	Get(ctx context.Context, key string) error
+}`))
+
+	matchers := make(map[string]string)
+	var failures []string
+	for _, d := range mockDecls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if fd.Recv != nil {
+			var buf bytes.Buffer
+			format.Node(&buf, token.NewFileSet(), fd.Type)
+			matchers[fd.Name.Name] = buf.String()
+		}
+		ast.Inspect(fd, func(n ast.Node) bool {
+			// calls on the mock's test, e.g., f.t.Errorf
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if x, ok := sel.X.(*ast.SelectorExpr); ok && x.Sel.Name == "t" && sel.Sel.Name != "Helper" {
+					failures = append(failures, sel.Sel.Name)
+				}
+			}
+			return true
+		})
+	}
+
+	for name, want := range map[string]string{
+		"MatchArg0": "func(match func(context.Context) bool) *MockGetterGetCall",
+		"AnyArg0":   "func() *MockGetterGetCall",
+		"MatchArg1": "func(match func(string) bool) *MockGetterGetCall",
+		"AnyArg1":   "func() *MockGetterGetCall",
+	} {
+		if got := matchers[name]; want != got {
+			t.Errorf("want %v for %v, got %v", want, name, got)
+		}
+	}
+	if len(failures) == 0 {
+		t.Error("want calls to Errorf")
+	}
+	for _, got := range failures {
+		if got != "Errorf" {
+			t.Errorf("want only Errorf, got %v", got)
+		}
+	}
+}
+
+func parseDecls(t *testing.T, src string) []ast.Decl {
+	f, err := parser.ParseFile(token.NewFileSet(), "sample.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("ParseFile failed with %v", err)
+	}
+	return f.Decls
+}
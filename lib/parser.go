@@ -2,22 +2,61 @@ package fm
 
 import (
 	"go/ast"
+	"go/build"
 	"go/parser"
 	"go/token"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
 // SrcFileParser parses the ASTs of source files only
-type SrcFileParser struct{}
+type SrcFileParser struct {
+	// Context decides which files are built, by their names and build
+	// constraints, e.g., GOOS, GOARCH, and tags. Defaults to build.Default
+	Context *build.Context
+	// Tests includes test files, both those of the package itself,
+	// e.g., export_test.go, and those of its external test package
+	Tests bool
+	// Include and Exclude select files by name with patterns such as
+	// *.pb.go, as understood by path.Match. All files are included
+	// when Include is empty
+	Include []string
+	Exclude []string
+}
 
-// ParseDir returns AST representations of all source files (excluding test files)
-// within a directory.
-func (s *SrcFileParser) ParseDir(dir string) (map[string]*ast.Package, error) {
-	return parser.ParseDir(token.NewFileSet(), dir, isSrcFile, parser.ParseComments)
+// ParseDir returns AST representations of all source files (excluding test files,
+// unless the parser includes them) within a directory which are built in the
+// parser's context. Files generated by fm are always excluded.
+func (s *SrcFileParser) ParseDir(fset *token.FileSet, dir string) (map[string]*ast.Package, error) {
+	return parser.ParseDir(fset, dir, s.filter(dir), parser.ParseComments)
 }
 
-// isSrcFile is an ast.Filter which removes all test files
-func isSrcFile(info os.FileInfo) bool {
-	return !strings.HasSuffix(info.Name(), "_test.go")
+// filter returns an ast.Filter which removes the files of dir
+// the parser does not select
+func (s *SrcFileParser) filter(dir string) func(os.FileInfo) bool {
+	ctx := s.Context
+	if ctx == nil {
+		ctx = &build.Default
+	}
+	return func(info os.FileInfo) bool {
+		name := info.Name()
+		if !s.Tests && strings.HasSuffix(name, "_test.go") {
+			return false
+		}
+		if !selected(name, s.Include, s.Exclude) {
+			return false
+		}
+
+		// a file which cannot be read is kept, so that parsing reports it
+		ok, err := ctx.MatchFile(dir, name)
+		if err != nil {
+			return true
+		}
+		if !ok {
+			return false
+		}
+		generated, err := isGenerated(filepath.Join(dir, name))
+		return err != nil || !generated
+	}
 }
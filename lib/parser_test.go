@@ -0,0 +1,74 @@
+package fm_test
+
+import (
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestSrcFileParserSelectsFiles ensures test files are parsed on request,
+// files are selected by pattern, and files generated by fm never are
+func TestSrcFileParserSelectsFiles(t *testing.T) {
+	generated := "// Spies generated by fm. Do not edit.\n// Regenerate by running fm instead.\npackage sample\n"
+	dir, rmDir := writeTree(t, map[string]string{
+		"sample.go":      "package sample\n",
+		"sample.pb.go":   "package sample\n",
+		"export_test.go": "package sample\n",
+		"fm_test.go":     generated,
+		"fm.go":          generated,
+	})
+	defer rmDir()
+
+	parser := &fm.SrcFileParser{Tests: true, Exclude: []string{"*.pb.go"}}
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir)
+	if err != nil {
+		t.Fatalf("ParseDir failed with %v", err)
+	}
+
+	var got []string
+	for name := range pkgs["sample"].Files {
+		got = append(got, filepath.Base(name))
+	}
+	sort.Strings(got)
+
+	want := "export_test.go sample.go"
+	if strings.Join(got, " ") != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestRunIncludesTestFiles ensures interfaces of test files are spied on,
+// with those of the external test package left unqualified
+func TestRunIncludesTestFiles(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go":      "package sample\n\ntype Doer interface {\n\tDo() error\n}\n",
+		"export_test.go": "package sample\n\ntype Counter interface {\n\tCount() int\n}\n",
+		"helper_test.go": "package sample_test\n\ntype Logger interface {\n\tLog(msg string)\n}\n",
+	})
+	defer rmDir()
+
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Parser:        &fm.SrcFileParser{Tests: true},
+	}
+	f := runChecked(t, cmd, dir, "fm_test.go")
+
+	if f.Name.Name != "sample_test" {
+		t.Errorf("want package sample_test, got %v", f.Name.Name)
+	}
+	want := map[string][]string{
+		"SpyDoer":    {"sample.Doer"},
+		"SpyCounter": {"sample.Counter"},
+		"SpyLogger":  {"Logger"},
+	}
+	got := assertedTypes(f)
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
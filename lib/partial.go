@@ -0,0 +1,153 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// partialDecls narrows the interfaces among ds to the methods selected by
+// name, with patterns as understood by path.Match, returning the narrowed
+// declarations along with the methods left out of each interface. Interfaces
+// without any selected method are skipped with a diagnostic. All methods are
+// selected when methods is empty
+func partialDecls(ds []ast.Decl, methods []string) ([]ast.Decl, map[string][]*ast.Field, []Diagnostic) {
+	if len(methods) == 0 {
+		return ds, nil, nil
+	}
+
+	var kept []ast.Decl
+	var diags []Diagnostic
+	omitted := make(map[string][]*ast.Field)
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			kept = append(kept, d)
+			continue
+		}
+
+		var specs []ast.Spec
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok || !doubledType(typeSpec) || skipped(genDecl, typeSpec) {
+				specs = append(specs, spec)
+				continue
+			}
+
+			var selected, others []*ast.Field
+			for _, field := range methodsOf(typeSpec) {
+				if len(field.Names) == 0 || matchAny(methods, field.Names[0].Name) {
+					selected = append(selected, field)
+				} else {
+					others = append(others, field)
+				}
+			}
+			if len(selected) == 0 {
+				diags = append(diags, Diagnostic{
+					Pos:     typeSpec.Pos(),
+					Message: fmt.Sprintf("skipped %s: none of the methods %s", typeSpec.Name.Name, strings.Join(methods, ", ")),
+				})
+				continue
+			}
+			if len(others) == 0 {
+				specs = append(specs, spec)
+				continue
+			}
+
+			// only interfaces have methods left out, as func types have one
+			narrowed := *typeSpec
+			narrowed.Type = &ast.InterfaceType{Methods: &ast.FieldList{List: selected}}
+			omitted[typeSpec.Name.Name] = others
+			specs = append(specs, &narrowed)
+		}
+		if len(specs) == 0 {
+			continue
+		}
+
+		filtered := *genDecl
+		filtered.Specs = specs
+		kept = append(kept, &filtered)
+	}
+	return kept, omitted, diags
+}
+
+// unspiedDecls adds to each generated type the methods left out of the
+// interface it is asserted to implement, each of which panics when called:
+//
+//	// Delete panics, as only some methods of the interface are spied on
+//	func (*SpyStore) Delete(key string) error {
+//		panic("method Delete not spied")
+//	}
+func unspiedDecls(ds []ast.Decl, omitted map[string][]*ast.Field) []ast.Decl {
+	if len(omitted) == 0 {
+		return ds
+	}
+
+	var decls []ast.Decl
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if ok && genDecl.Tok == token.VAR && len(genDecl.Specs) == 1 {
+			valueSpec, ok := genDecl.Specs[0].(*ast.ValueSpec)
+			if ok && len(valueSpec.Values) == 1 {
+				ident, _ := valueSpec.Type.(*ast.Ident)
+				structName := assertedStruct(valueSpec.Values[0])
+				if ident != nil && structName != "" {
+					// the methods of the interface take the place of any
+					// generated ones of the same name, e.g., Reset
+					decls = withoutMethods(decls, structName, omitted[ident.Name])
+					// the methods precede the assertion
+					for _, field := range omitted[ident.Name] {
+						decls = append(decls, unspiedFunc(structName, field))
+					}
+				}
+			}
+		}
+		decls = append(decls, d)
+	}
+	return decls
+}
+
+// withoutMethods removes the methods of the named struct which share
+// their names with any of the fields
+func withoutMethods(ds []ast.Decl, structName string, fields []*ast.Field) []ast.Decl {
+	names := make(map[string]bool)
+	for _, field := range fields {
+		names[field.Names[0].Name] = true
+	}
+
+	var kept []ast.Decl
+	for _, d := range ds {
+		funcDecl, ok := d.(*ast.FuncDecl)
+		if ok && funcDecl.Recv != nil && names[funcDecl.Name.Name] {
+			if star, ok := funcDecl.Recv.List[0].Type.(*ast.StarExpr); ok && isIdent(star.X, structName) {
+				continue
+			}
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+// unspiedFunc returns a method of the named struct which panics
+func unspiedFunc(structName string, field *ast.Field) *ast.FuncDecl {
+	name := field.Names[0].Name
+	return &ast.FuncDecl{
+		Doc: docComment(fmt.Sprintf("%s panics, as only some methods of the interface are spied on", name)),
+		Recv: &ast.FieldList{List: []*ast.Field{{
+			Type: &ast.StarExpr{X: ast.NewIdent(structName)},
+		}}},
+		Name: ast.NewIdent(name),
+		Type: stripPos(field.Type).(*ast.FuncType),
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.ExprStmt{X: &ast.CallExpr{
+				Fun: ast.NewIdent("panic"),
+				Args: []ast.Expr{&ast.BasicLit{
+					Kind:  token.STRING,
+					Value: strconv.Quote(fmt.Sprintf("method %s not spied", name)),
+				}},
+			}},
+		}},
+	}
+}
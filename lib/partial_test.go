@@ -0,0 +1,87 @@
+package fm_test
+
+import (
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestRunGeneratesPartialSpies ensures only the selected methods are
+// spied on, while the others still satisfy the interface by panicking,
+// even when generated methods share their names, and that interfaces
+// without any selected method are skipped
+func TestRunGeneratesPartialSpies(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type Store interface {
+	Get(key string) (string, error)
+	Put(key, value string) error
+	Delete(key string) error
+}
+
+type Closer interface {
+	Close() error
+}
+
+type Machine interface {
+	Start()
+	Reset()
+}
+`,
+	})
+	defer rmDir()
+
+	warnings := &strings.Builder{}
+	cmd := &fm.Cmd{
+		DeclGenerator: buildGen(),
+		Warnings:      warnings,
+		Methods:       []string{"Get", "P*", "Start"},
+	}
+	// the unspied Reset of SpyMachine takes the place of the generated one,
+	// which would not compile otherwise
+	f := runChecked(t, cmd, dir, "fm_test.go")
+
+	if _, ok := declaredTypes(f)["SpyCloser"]; ok {
+		t.Error("want no SpyCloser")
+	}
+
+	st := declaredTypes(f)["SpyStore"].(*ast.StructType)
+	var inputs []string
+	for _, field := range st.Fields.List {
+		if name := field.Names[0].Name; strings.HasSuffix(name, "_Input") {
+			inputs = append(inputs, name)
+		}
+	}
+	if want := []string{"Get_Input", "Put_Input"}; !reflect.DeepEqual(want, inputs) {
+		t.Errorf("want %v, got %v", want, inputs)
+	}
+
+	// Delete panics rather than recording the call
+	del, ok := declaredMethods(f)["SpyStore.Delete"]
+	if !ok {
+		t.Fatalf("want SpyStore.Delete, got %v", declaredMethods(f))
+	}
+	var panics bool
+	if len(del.Body.List) == 1 {
+		if stmt, ok := del.Body.List[0].(*ast.ExprStmt); ok {
+			call, ok := stmt.X.(*ast.CallExpr)
+			panics = ok && types.ExprString(call.Fun) == "panic"
+		}
+	}
+	if !panics {
+		t.Errorf("want Delete to panic, got %v", del.Body.List)
+	}
+
+	wantWarnings := filepath.Join(dir, "sample.go") + ":9:6: skipped Closer: none of the methods Get, P*, Start\n"
+	gotWarnings := warnings.String()
+
+	if wantWarnings != gotWarnings {
+		t.Errorf("want %v, got %v", wantWarnings, gotWarnings)
+	}
+}
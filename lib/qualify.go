@@ -0,0 +1,165 @@
+package fm
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// qualifyInterfaces rewrites the types declared in the source package
+// which appear in interface methods so that they are qualified with the
+// package name, e.g., Task becomes example.Task, and reports whether any
+// type was qualified. The declarations are modified in place.
+func qualifyInterfaces(ds []ast.Decl, pkg string) bool {
+	var qualified bool
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok || !doubledType(typeSpec) {
+				continue
+			}
+			for _, field := range methodsOf(typeSpec) {
+				if len(field.Names) == 0 {
+					continue // embedded interfaces are not implemented
+				}
+				field.Type = qualify(field.Type, pkg, &qualified)
+			}
+		}
+	}
+	return qualified
+}
+
+// qualifyAssertions qualifies the interfaces named in the compile-time
+// assertions among the generated declarations with the package name,
+// e.g., var _ example.Doer = (*SpyDoer)(nil), and reports whether
+// any interface was qualified
+func qualifyAssertions(ds []ast.Decl, pkg string) bool {
+	var qualified bool
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec, ok := spec.(*ast.ValueSpec)
+			if !ok || len(valueSpec.Names) != 1 || valueSpec.Names[0].Name != "_" {
+				continue
+			}
+			if ident, ok := valueSpec.Type.(*ast.Ident); ok {
+				valueSpec.Type = &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: ident}
+				qualified = true
+			}
+		}
+	}
+	return qualified
+}
+
+// typeFuncFields gives the fields of generated structs which hold the
+// func type the struct provides, e.g., the Delegate of DelegateClock,
+// the type the struct is asserted to provide, once that is qualified
+// or instantiated, e.g., example.Clock for Clock
+func typeFuncFields(ds []ast.Decl) {
+	asserted := make(map[string]ast.Expr)
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec, ok := spec.(*ast.ValueSpec)
+			if !ok || len(valueSpec.Values) != 1 {
+				continue
+			}
+			// e.g., var _ example.Clock = (*DelegateClock)(nil).Clock
+			method, ok := valueSpec.Values[0].(*ast.SelectorExpr)
+			if !ok {
+				continue
+			}
+			if structName := assertedStruct(method); structName != "" {
+				asserted[structName+"."+method.Sel.Name] = valueSpec.Type
+			}
+		}
+	}
+
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			st, ok := typeSpec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			for _, field := range st.Fields.List {
+				ident, ok := field.Type.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				if typ, ok := asserted[typeSpec.Name.Name+"."+ident.Name]; ok {
+					field.Type = typ
+				}
+			}
+		}
+	}
+}
+
+// qualify returns the type expression with all unqualified, non-builtin
+// type names qualified by pkg
+func qualify(e ast.Expr, pkg string, qualified *bool) ast.Expr {
+	switch t := e.(type) {
+	case *ast.Ident:
+		if types.Universe.Lookup(t.Name) != nil {
+			return t
+		}
+		*qualified = true
+		return &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: t}
+	case *ast.StarExpr:
+		t.X = qualify(t.X, pkg, qualified)
+	case *ast.ParenExpr:
+		t.X = qualify(t.X, pkg, qualified)
+	case *ast.ArrayType:
+		t.Elt = qualify(t.Elt, pkg, qualified)
+	case *ast.Ellipsis:
+		t.Elt = qualify(t.Elt, pkg, qualified)
+	case *ast.MapType:
+		t.Key = qualify(t.Key, pkg, qualified)
+		t.Value = qualify(t.Value, pkg, qualified)
+	case *ast.ChanType:
+		t.Value = qualify(t.Value, pkg, qualified)
+	case *ast.IndexExpr:
+		t.X = qualify(t.X, pkg, qualified)
+		t.Index = qualify(t.Index, pkg, qualified)
+	case *ast.IndexListExpr:
+		t.X = qualify(t.X, pkg, qualified)
+		for i := range t.Indices {
+			t.Indices[i] = qualify(t.Indices[i], pkg, qualified)
+		}
+	case *ast.FuncType:
+		qualifyFields(t.Params, pkg, qualified)
+		qualifyFields(t.Results, pkg, qualified)
+	case *ast.StructType:
+		qualifyFields(t.Fields, pkg, qualified)
+	case *ast.InterfaceType:
+		qualifyFields(t.Methods, pkg, qualified)
+	}
+	return e
+}
+
+// qualifyFields qualifies the type of every field in the list
+func qualifyFields(fl *ast.FieldList, pkg string, qualified *bool) {
+	if fl == nil {
+		return
+	}
+	for _, field := range fl.List {
+		field.Type = qualify(field.Type, pkg, qualified)
+	}
+}
@@ -0,0 +1,256 @@
+package fm
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+const (
+	snapshotSuffix = "Snapshot"
+	resetMethod    = "Reset"
+	snapshotMethod = "Snapshot"
+)
+
+// withResets adds a Reset and a Snapshot method to each spy among the
+// generated declarations, along with the type of its snapshot, e.g.,
+// SpyDoerSnapshot. Either method is left out when the interface declares
+// a method of the same name, which is spied on instead
+func withResets(ds []ast.Decl) []ast.Decl {
+	var decls []ast.Decl
+	spies := make(map[string]*ast.StructType)
+	for _, d := range ds {
+		genDecl, ok := d.(*ast.GenDecl)
+		if !ok {
+			decls = append(decls, d)
+			continue
+		}
+
+		switch genDecl.Tok {
+		case token.TYPE:
+			decls = append(decls, d)
+			for _, spec := range genDecl.Specs {
+				typeSpec, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				structType, ok := typeSpec.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				spies[typeSpec.Name.Name] = structType
+			}
+		case token.VAR:
+			// the methods precede the assertion
+			if structName := assertionStruct(genDecl); spies[structName] != nil {
+				structType := spies[structName]
+				if !spiedMethod(structType, resetMethod) {
+					decls = append(decls, resetDecl(structName, structType))
+				}
+				if !spiedMethod(structType, snapshotMethod) {
+					decls = append(decls, snapshotTypeDecl(structName, structType))
+					decls = append(decls, snapshotDecl(structName, structType))
+				}
+				delete(spies, structName)
+			}
+			decls = append(decls, d)
+		default:
+			decls = append(decls, d)
+		}
+	}
+	return decls
+}
+
+// assertionStruct returns the struct named in the compile-time
+// assertion, if the declaration is one
+func assertionStruct(genDecl *ast.GenDecl) string {
+	if len(genDecl.Specs) != 1 {
+		return ""
+	}
+	valueSpec, ok := genDecl.Specs[0].(*ast.ValueSpec)
+	if !ok || len(valueSpec.Values) != 1 {
+		return ""
+	}
+	return assertedStruct(valueSpec.Values[0])
+}
+
+// spiedMethod reports whether the spy records calls to the named method
+func spiedMethod(s *ast.StructType, name string) bool {
+	for _, field := range s.Fields.List {
+		if len(field.Names) == 1 && field.Names[0].Name == name+calledSuffix {
+			return true
+		}
+	}
+	return false
+}
+
+// recordedField reports whether the field records calls, i.e., whether
+// the field is part of a snapshot
+func recordedField(name string) bool {
+	return name == callLogField ||
+		strings.HasSuffix(name, calledSuffix) ||
+		strings.HasSuffix(name, callCountSuffix) ||
+		strings.HasSuffix(name, inputSuffix)
+}
+
+// resetField reports whether the field is cleared by Reset, i.e., whether
+// it records calls or configures results. Gates are kept, so that calls
+// which are blocked may still be released
+func resetField(name string) bool {
+	return recordedField(name) ||
+		strings.HasSuffix(name, outputSuffix) ||
+		strings.HasSuffix(name, rulesSuffix)
+}
+
+// fieldNames returns the names of the struct's fields which pass the filter
+func fieldNames(s *ast.StructType, filter func(string) bool) []string {
+	var names []string
+	for _, field := range s.Fields.List {
+		for _, n := range field.Names {
+			if filter(n.Name) {
+				names = append(names, n.Name)
+			}
+		}
+	}
+	return names
+}
+
+// snapshotTypeDecl declares the type holding a copy of the calls
+// recorded by the spy:
+//
+//	// SpyDoerSnapshot holds a copy of the calls recorded by SpyDoer
+//	type SpyDoerSnapshot struct {
+//		DoIt_Called    bool
+//		DoIt_CallCount int
+//		DoIt_Input     struct{ ... }
+//		CallLog        []string
+//	}
+func snapshotTypeDecl(structName string, s *ast.StructType) ast.Decl {
+	var list []*ast.Field
+	for _, field := range s.Fields.List {
+		if len(field.Names) == 1 && recordedField(field.Names[0].Name) {
+			list = append(list, stripPos(field).(*ast.Field))
+		}
+	}
+	return &ast.GenDecl{
+		Doc: docComment(structName + snapshotSuffix + " holds a copy of the calls recorded by " + structName),
+		Tok: token.TYPE,
+		Specs: []ast.Spec{&ast.TypeSpec{
+			Name: ast.NewIdent(structName + snapshotSuffix),
+			Type: &ast.StructType{Fields: &ast.FieldList{List: list}},
+		}},
+	}
+}
+
+// snapshotDecl builds a function which copies the recorded calls:
+//
+//	func (f *SpyDoer) Snapshot() SpyDoerSnapshot {
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//		var snapshot SpyDoerSnapshot
+//		snapshot.DoIt_Called = f.DoIt_Called
+//		...
+//		snapshot.CallLog = append([]string(nil), f.CallLog...)
+//		return snapshot
+//	}
+func snapshotDecl(structName string, s *ast.StructType) *ast.FuncDecl {
+	list := []ast.Stmt{
+		lockStmt(),
+		deferUnlockStmt(),
+		varStmt("snapshot", structName+snapshotSuffix),
+	}
+	for _, name := range fieldNames(s, recordedField) {
+		var value ast.Expr = recvSelector(name)
+		if name == callLogField {
+			// the log grows in place, so it is copied
+			value = &ast.CallExpr{
+				Fun: ast.NewIdent("append"),
+				Args: []ast.Expr{
+					&ast.CallExpr{
+						Fun:  &ast.ArrayType{Elt: ast.NewIdent("string")},
+						Args: []ast.Expr{ast.NewIdent("nil")},
+					},
+					value,
+				},
+				Ellipsis: 1,
+			}
+		}
+		list = append(list, &ast.AssignStmt{
+			Lhs: []ast.Expr{selector("snapshot", name)},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{value},
+		})
+	}
+	list = append(list, &ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent("snapshot")}})
+
+	return &ast.FuncDecl{
+		Doc: docComment(
+			"Snapshot returns a copy of the calls recorded so far, which is safe",
+			"to inspect while calls are still being made",
+		),
+		Recv: spyRecv(structName),
+		Name: ast.NewIdent(snapshotMethod),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{{
+				Type: ast.NewIdent(structName + snapshotSuffix),
+			}}},
+		},
+		Body: &ast.BlockStmt{List: list},
+	}
+}
+
+// resetDecl builds a function which clears the recorded calls and the
+// configured results by assigning the zero value of each field:
+//
+//	func (f *SpyDoer) Reset() {
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//		var zero SpyDoer
+//		f.DoIt_Called = zero.DoIt_Called
+//		...
+//	}
+func resetDecl(structName string, s *ast.StructType) *ast.FuncDecl {
+	list := []ast.Stmt{
+		lockStmt(),
+		deferUnlockStmt(),
+		varStmt("zero", structName),
+	}
+	for _, name := range fieldNames(s, resetField) {
+		list = append(list, &ast.AssignStmt{
+			Lhs: []ast.Expr{recvSelector(name)},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{selector("zero", name)},
+		})
+	}
+
+	return &ast.FuncDecl{
+		Doc: docComment(
+			"Reset clears the calls recorded so far along with the configured results,",
+			"so that the spy may be reused. Calls which are blocked stay blocked",
+		),
+		Recv: spyRecv(structName),
+		Name: ast.NewIdent(resetMethod),
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{List: list},
+	}
+}
+
+// spyRecv returns the receiver f *structName
+func spyRecv(structName string) *ast.FieldList {
+	return &ast.FieldList{List: []*ast.Field{{
+		Names: []*ast.Ident{ast.NewIdent(recvName)},
+		Type:  &ast.StarExpr{X: ast.NewIdent(structName)},
+	}}}
+}
+
+// varStmt returns the declaration var name typeName
+func varStmt(name, typeName string) ast.Stmt {
+	return &ast.DeclStmt{Decl: &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{&ast.ValueSpec{
+			Names: []*ast.Ident{ast.NewIdent(name)},
+			Type:  ast.NewIdent(typeName),
+		}},
+	}}
+}
@@ -0,0 +1,103 @@
+package fm_test
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestRunGeneratesResetAndSnapshot ensures every spy may be reset and
+// its recorded calls copied, unless the interface declares a method of
+// the same name, which is spied on instead
+func TestRunGeneratesResetAndSnapshot(t *testing.T) {
+	dir, rmDir := writeModule(t, map[string]string{
+		"sample.go": `package sample
+
+type Doer interface {
+	Do(task string) error
+}
+
+type Machine interface {
+	Reset()
+}
+`,
+	})
+	defer rmDir()
+
+	cmd := &fm.Cmd{DeclGenerator: buildGen()}
+	f := runChecked(t, cmd, dir, "fm_test.go")
+
+	methods := declaredMethods(f)
+	for _, method := range []string{"SpyDoer.Reset", "SpyDoer.Snapshot", "SpyMachine.Reset", "SpyMachine.Snapshot"} {
+		if _, ok := methods[method]; !ok {
+			t.Fatalf("want %v, got none", method)
+		}
+	}
+
+	// Reset clears the configured results as well as the recorded calls
+	if got := assignedFields(methods["SpyDoer.Reset"]); !contains(got, "f.Do_Output") {
+		t.Errorf("want f.Do_Output reset, got %v", got)
+	}
+	// the Reset of Machine is spied on rather than resetting the spy
+	if got := assignedFields(methods["SpyMachine.Reset"]); !contains(got, "f.Reset_Called") {
+		t.Errorf("want SpyMachine.Reset to record its call, got %v", got)
+	}
+
+	for method, want := range map[string]string{
+		"SpyDoer.Snapshot":    "SpyDoerSnapshot",
+		"SpyMachine.Snapshot": "SpyMachineSnapshot",
+	} {
+		results := methods[method].Type.Results
+		if results == nil || len(results.List) != 1 || types.ExprString(results.List[0].Type) != want {
+			t.Errorf("want %v to return %v", method, want)
+		}
+	}
+
+	// snapshots copy the recorded calls, not the configured results
+	for snapshot, want := range map[string][]string{
+		"SpyDoerSnapshot":    {"Do_Called", "Do_CallCount", "Do_Input", "CallLog"},
+		"SpyMachineSnapshot": {"Reset_Called", "Reset_CallCount", "CallLog"},
+	} {
+		st, ok := declaredTypes(f)[snapshot].(*ast.StructType)
+		if !ok {
+			t.Errorf("want struct %v, got none", snapshot)
+			continue
+		}
+		var got []string
+		for _, field := range st.Fields.List {
+			for _, name := range field.Names {
+				got = append(got, name.Name)
+			}
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+}
+
+// assignedFields returns the expressions assigned to by the statements
+// of the function's body, e.g., f.Do_Output
+func assignedFields(funcDecl *ast.FuncDecl) []string {
+	var assigned []string
+	for _, stmt := range funcDecl.Body.List {
+		if assign, ok := stmt.(*ast.AssignStmt); ok {
+			for _, lhs := range assign.Lhs {
+				assigned = append(assigned, types.ExprString(lhs))
+			}
+		}
+	}
+	return assigned
+}
+
+// contains reports whether s is one of ss
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
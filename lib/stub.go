@@ -0,0 +1,89 @@
+package fm
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+const (
+	stubPrefix = "Stub"
+)
+
+// StubGenerator creates stub implementations of interface declarations,
+// i.e., test doubles which return canned values without recording
+// anything about how they were called
+type StubGenerator struct {
+	Converter   StructConverter
+	Implementer FuncImplementer
+}
+
+// Generate transforms all the interfaces in the list of declarations
+// into stubs in the form of structs with implemented functions
+func (g *StubGenerator) Generate(ds []ast.Decl) ([]ast.Decl, []Diagnostic) {
+	return generate(ds, g.Converter, g.Implementer)
+}
+
+// StubStructConverter converts interfaces into stubs.
+// Meant to be used in conjunction with StubFuncImplementer
+type StubStructConverter struct{}
+
+// Convert returns a struct type with public properties for all
+// return values declared in the interface
+func (s *StubStructConverter) Convert(t *ast.TypeSpec, i *ast.InterfaceType) *ast.TypeSpec {
+	var list []*ast.Field
+	for _, field := range i.Methods.List {
+		funcType, ok := field.Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+
+		if funcType.Results != nil && len(funcType.Results.List) > 0 {
+			outputStruct := buildStruct(field.Names[0].Name+outputSuffix, retPrefix, funcType.Results.List)
+			list = append(list, outputStruct)
+		}
+	}
+
+	return &ast.TypeSpec{
+		Name: ast.NewIdent(stubPrefix + t.Name.Name),
+		Type: &ast.StructType{
+			Fields: &ast.FieldList{List: list},
+		},
+	}
+}
+
+// StubFuncImplementer creates stub implementations of an interface's
+// functions. Meant to be used in conjunction with StubStructConverter
+type StubFuncImplementer struct{}
+
+// Implement returns function declarations which return the values
+// of properties on a stub struct
+func (s *StubFuncImplementer) Implement(name *ast.Ident, i *ast.InterfaceType) []*ast.FuncDecl {
+	var funcDecls []*ast.FuncDecl
+	for _, list := range i.Methods.List {
+		funcType, ok := list.Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+
+		fname := list.Names[0].Name
+		var body []ast.Stmt
+		var results []ast.Expr
+		for idx := range resultTypes(funcType) {
+			results = append(results, recvSelector(fname+outputSuffix, fmt.Sprintf("%s%d", retPrefix, idx)))
+		}
+		if len(results) > 0 {
+			body = append(body, &ast.ReturnStmt{Results: results})
+		}
+
+		funcDecls = append(funcDecls, &ast.FuncDecl{
+			Recv: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent(recvName)},
+				Type:  &ast.StarExpr{X: name},
+			}}},
+			Name: list.Names[0],
+			Type: funcType,
+			Body: &ast.BlockStmt{List: body},
+		})
+	}
+	return funcDecls
+}
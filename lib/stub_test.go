@@ -0,0 +1,69 @@
+package fm_test
+
+import (
+	"go/ast"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// only adds an Output struct, i.e., records nothing about calls
+func TestStubConvertGeneratesOutputStructOnly(t *testing.T) {
+	converter := &fm.StubStructConverter{}
+
+	typeSpec := converter.Convert(
+		&ast.TypeSpec{Name: ast.NewIdent("Tester")},
+		buildResultInterface(),
+	)
+
+	want := "StubTester"
+	got := typeSpec.Name.Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	structType, ok := typeSpec.Type.(*ast.StructType)
+	if !ok {
+		t.Fatal("expected typeSpec to be of type StructType")
+	}
+
+	if len(structType.Fields.List) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(structType.Fields.List))
+	}
+
+	want = "SomeMethod_Output"
+	got = structType.Fields.List[0].Names[0].Name
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestStubImplementReturnsOutput(t *testing.T) {
+	s := &fm.StubFuncImplementer{}
+	funcDecls := s.Implement(ast.NewIdent("StubTester"), buildResultInterface())
+
+	if len(funcDecls) != 1 {
+		t.Fatalf("want %v, got %v", 1, len(funcDecls))
+	}
+
+	want := 1 // return f.SomeMethod_Output.Ret0
+	got := len(funcDecls[0].Body.List)
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func buildResultInterface() *ast.InterfaceType {
+	return &ast.InterfaceType{Methods: &ast.FieldList{List: []*ast.Field{{
+		Names: []*ast.Ident{ast.NewIdent("SomeMethod")},
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{
+				{Type: ast.NewIdent("int")},
+			}},
+		},
+	}}}}
+}
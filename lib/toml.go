@@ -0,0 +1,188 @@
+package fm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// tomlEntry is a key and its value, along with the table holding it,
+// e.g., [packages."internal/store"]
+type tomlEntry struct {
+	table []string
+	key   string
+	value interface{} // string, bool, or []string
+	line  int
+}
+
+// parseTOML reads the subset of TOML used by fm configuration files:
+// tables, and keys holding strings, booleans, or arrays of strings
+func parseTOML(r io.Reader) ([]tomlEntry, error) {
+	var entries []tomlEntry
+	var table []string
+
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(stripTOMLComment(s.Text()))
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") || strings.HasPrefix(text, "[[") {
+				return nil, fmt.Errorf("line %d: malformed table %s", line, text)
+			}
+			keys, err := splitTOMLKey(strings.TrimSpace(text[1 : len(text)-1]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			table = keys
+			continue
+		}
+
+		eq := strings.Index(text, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value, got %s", line, text)
+		}
+		keys, err := splitTOMLKey(strings.TrimSpace(text[:eq]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if len(keys) != 1 {
+			return nil, fmt.Errorf("line %d: dotted keys are not supported", line)
+		}
+		value, err := parseTOMLValue(strings.TrimSpace(text[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		entries = append(entries, tomlEntry{table: table, key: keys[0], value: value, line: line})
+	}
+	return entries, s.Err()
+}
+
+// stripTOMLComment removes a trailing # comment outside of any string
+func stripTOMLComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitTOMLKey splits a dotted key, e.g., packages."internal/store",
+// into its parts
+func splitTOMLKey(key string) ([]string, error) {
+	var parts []string
+	for key != "" {
+		var part string
+		if key[0] == '"' || key[0] == '\'' {
+			end := strings.IndexByte(key[1:], key[0])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated key %s", key)
+			}
+			part, key = key[1:end+1], key[end+2:]
+		} else {
+			end := strings.IndexByte(key, '.')
+			if end < 0 {
+				end = len(key)
+			}
+			part, key = strings.TrimSpace(key[:end]), key[end:]
+		}
+		if part == "" {
+			return nil, fmt.Errorf("empty key")
+		}
+		parts = append(parts, part)
+
+		key = strings.TrimSpace(key)
+		if key == "" {
+			break
+		}
+		if key[0] != '.' {
+			return nil, fmt.Errorf("malformed key near %s", key)
+		}
+		key = strings.TrimSpace(key[1:])
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty key")
+	}
+	return parts, nil
+}
+
+// parseTOMLValue parses a string, boolean, or array of strings
+func parseTOMLValue(v string) (interface{}, error) {
+	switch {
+	case v == "true":
+		return true, nil
+	case v == "false":
+		return false, nil
+	case strings.HasPrefix(v, "["):
+		if !strings.HasSuffix(v, "]") {
+			return nil, fmt.Errorf("arrays must be written on a single line")
+		}
+		list := []string{}
+		for _, item := range splitTOMLArray(v[1 : len(v)-1]) {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue // allows a trailing comma
+			}
+			s, err := parseTOMLString(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return parseTOMLString(v)
+	}
+}
+
+// splitTOMLArray splits the items of an array on the commas outside of
+// any string, e.g., "Pair[string, int]" is a single item
+func splitTOMLArray(items string) []string {
+	var list []string
+	var quote rune
+	escaped := false
+	start := 0
+	for i, r := range items {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == ',':
+			list = append(list, items[start:i])
+			start = i + 1
+		}
+	}
+	return append(list, items[start:])
+}
+
+// parseTOMLString parses a basic "string" or a literal 'string'
+func parseTOMLString(v string) (string, error) {
+	if len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+		return v[1 : len(v)-1], nil
+	}
+	if len(v) >= 2 && v[0] == '"' {
+		return strconv.Unquote(v)
+	}
+	return "", fmt.Errorf("unsupported value %s", v)
+}
@@ -1,37 +1,140 @@
 package fm
 
 import (
-	"bufio"
+	"bytes"
+	"fmt"
 	"go/ast"
 	"go/format"
 	"go/token"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 const codeComment = `// Spies generated by fm. Do not edit.
 // Regenerate by running fm instead.
 `
 
-// FileWriter formats an ast.File as a standard go file
-// and writes it to disk
-type FileWriter struct{}
+// extractComment marks interfaces extracted by fm, which are parsed like
+// any other source, unlike the files holding spies
+const extractComment = `// Interface extracted by fm. Do not edit.
+// Regenerate by running fm extract instead.
+`
 
-// Write outputs the ast.File to a file on disk specified by filename
-func (w *FileWriter) Write(file *ast.File, filename string) error {
-	spyFile, err := os.Create(filename)
+// render formats an ast.File as a standard go file, preceded by
+// the header which marks it as generated by fm and by the build
+// constraint, if any
+func render(file *ast.File, constraint string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(codeComment)
+	if constraint != "" {
+		fmt.Fprintf(&buf, "\n//go:build %s\n\n", constraint)
+	}
+	err := format.Node(&buf, token.NewFileSet(), file)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FileWriter writes go source to disk
+type FileWriter struct {
+	// Force allows overwriting files which were not generated by fm
+	Force bool
+}
+
+// Write outputs the source to a file on disk specified by filename.
+// The source is written to a temporary file which then replaces the
+// destination, so a failure leaves any previous file untouched, and
+// which takes on the permissions of the destination, if it exists.
+// An existing file is only overwritten when it was generated by fm,
+// unless the writer is forced
+func (w *FileWriter) Write(filename string, src []byte) error {
+	if !w.Force {
+		err := checkGenerated(filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+
+	_, err = tmp.Write(src)
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	err = tmp.Close()
 	if err != nil {
 		return err
 	}
-	buf := bufio.NewWriter(spyFile)
-	_, err = buf.Write([]byte(codeComment))
+
+	// keep the permissions of any file being replaced
+	mode := os.FileMode(0644)
+	info, err := os.Stat(filename)
+	if err == nil {
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), mode)
 	if err != nil {
 		return err
 	}
 
-	err = format.Node(buf, token.NewFileSet(), file)
+	return os.Rename(tmp.Name(), filename)
+}
+
+// checkGenerated returns an error when the file exists but does not
+// start with either of the headers written by fm
+func checkGenerated(filename string) error {
+	generated, err := isGenerated(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	if !generated {
+		generated, err = isExtracted(filename)
+		if err != nil {
+			return err
+		}
+	}
+	if !generated {
+		return fmt.Errorf("refusing to overwrite %s which was not generated by fm (use -force to overwrite it)", filename)
+	}
+	return nil
+}
 
-	return buf.Flush()
+// isGenerated reports whether the file starts with the header written by fm
+func isGenerated(filename string) (bool, error) {
+	return hasHeader(filename, codeComment)
+}
+
+// isExtracted reports whether the file starts with the header of an
+// interface extracted by fm
+func isExtracted(filename string) (bool, error) {
+	return hasHeader(filename, extractComment)
+}
+
+// hasHeader reports whether the file starts with the header
+func hasHeader(filename, want string) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(want))
+	_, err = io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return bytes.Equal(header, []byte(want)), nil
 }
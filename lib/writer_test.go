@@ -0,0 +1,134 @@
+package fm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// TestWriteRefusesToOverwriteHandWrittenFile ensures a file without
+// fm's header is left untouched and named in the error
+func TestWriteRefusesToOverwriteHandWrittenFile(t *testing.T) {
+	filename := writeExisting(t, "package sample_test\n")
+
+	w := &fm.FileWriter{}
+	err := w.Write(filename, []byte("package sample_test\n// regenerated\n"))
+
+	if err == nil || !strings.Contains(err.Error(), filename) {
+		t.Fatalf("want error naming %v, got %v", filename, err)
+	}
+
+	want := "package sample_test\n"
+	got := readFile(t, filename)
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestWriteOverwritesGeneratedFile ensures files generated by fm
+// are replaced without leaving temporary files behind
+func TestWriteOverwritesGeneratedFile(t *testing.T) {
+	filename := writeExisting(t, `// Spies generated by fm. Do not edit.
+// Regenerate by running fm instead.
+package old_test
+`)
+
+	w := &fm.FileWriter{}
+	err := w.Write(filename, []byte("package sample_test\n"))
+	if err != nil {
+		t.Fatalf("Write failed with %v", err)
+	}
+
+	want := "package sample_test\n"
+	got := readFile(t, filename)
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	entries, err := ioutil.ReadDir(path.Dir(filename))
+	if err != nil {
+		t.Fatalf("ReadDir failed with %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("want only %v, got %v files", filename, len(entries))
+	}
+}
+
+// TestWriteKeepsPermissionsOfOverwrittenFile ensures a replaced file
+// keeps its permissions, while new files are readable by everyone
+func TestWriteKeepsPermissionsOfOverwrittenFile(t *testing.T) {
+	filename := writeExisting(t, "package sample_test\n")
+	err := os.Chmod(filename, 0600)
+	if err != nil {
+		t.Fatalf("Chmod failed with %v", err)
+	}
+
+	w := &fm.FileWriter{Force: true}
+	err = w.Write(filename, []byte("package generated_test\n"))
+	if err != nil {
+		t.Fatalf("Write failed with %v", err)
+	}
+	newFile := path.Join(path.Dir(filename), "fm_new_test.go")
+	err = w.Write(newFile, []byte("package generated_test\n"))
+	if err != nil {
+		t.Fatalf("Write failed with %v", err)
+	}
+
+	for filename, want := range map[string]os.FileMode{filename: 0600, newFile: 0644} {
+		info, err := os.Stat(filename)
+		if err != nil {
+			t.Fatalf("Stat failed with %v", err)
+		}
+		if got := info.Mode().Perm(); want != got {
+			t.Errorf("want %v for %v, got %v", want, filename, got)
+		}
+	}
+}
+
+// TestWriteForceOverwritesHandWrittenFile ensures forcing the writer
+// overwrites any file
+func TestWriteForceOverwritesHandWrittenFile(t *testing.T) {
+	filename := writeExisting(t, "package sample_test\n")
+
+	w := &fm.FileWriter{Force: true}
+	err := w.Write(filename, []byte("package generated_test\n"))
+	if err != nil {
+		t.Fatalf("Write failed with %v", err)
+	}
+
+	want := "package generated_test\n"
+	got := readFile(t, filename)
+
+	if want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func writeExisting(t *testing.T, contents string) string {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("TempDir failed with %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	filename := path.Join(dir, "fm_test.go")
+	err = ioutil.WriteFile(filename, []byte(contents), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile failed with %v", err)
+	}
+	return filename
+}
+
+func readFile(t *testing.T, filename string) string {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile failed with %v", err)
+	}
+	return string(bytes)
+}
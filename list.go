@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	fm "github.com/enocom/fm/lib"
+)
+
+// list prints the interfaces within the given packages, e.g., ./...,
+// along with whether test doubles can be generated for them
+func list(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	internal := fs.Bool(
+		"internal",
+		false,
+		"List interfaces as if spies were written into the package itself",
+	)
+	tags := fs.String(
+		"tags",
+		"",
+		"Comma-separated list of build tags to consider when parsing",
+	)
+	tests := fs.Bool(
+		"tests",
+		false,
+		"Include interfaces declared in test files",
+	)
+	_ = fs.Parse(args)
+	build.Default.BuildTags = append(build.Default.BuildTags, splitList(*tags)...)
+
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	dirs, err := expandPatterns(patterns)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, dir := range dirs {
+		cfg, err := fm.LoadConfig(dir)
+		if err != nil {
+			fmt.Printf("Error %v\n", err)
+			os.Exit(1)
+		}
+		c := &fm.Cmd{
+			Parser: &fm.SrcFileParser{
+				Tests:   *tests || (cfg.Tests && !isFlagSet(fs, "tests")),
+				Include: cfg.IncludeFiles,
+				Exclude: cfg.ExcludeFiles,
+			},
+			Internal: *internal || (cfg.Internal && !isFlagSet(fs, "internal")),
+			Include:  cfg.Include,
+			Exclude:  cfg.Exclude,
+		}
+		infos, err := c.List(dir)
+		if err != nil {
+			fmt.Printf("Error %v\n", err)
+			os.Exit(1)
+		}
+		for _, info := range infos {
+			status := "supported"
+			if !info.Supported {
+				status = info.Reason
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d method(s)\t%s\n",
+				info.Package, info.Position, info.Name, info.Methods, status)
+		}
+	}
+	_ = w.Flush()
+}
+
+// expandPatterns returns the directories named by the patterns, where a
+// pattern ending in /... names every directory beneath it containing
+// Go source files, except for vendor, testdata, and hidden directories
+func expandPatterns(patterns []string) ([]string, error) {
+	var dirs []string
+	for _, pattern := range patterns {
+		if pattern != "..." && !strings.HasSuffix(pattern, "/...") {
+			dirs = append(dirs, pattern)
+			continue
+		}
+
+		root := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+		if root == "" {
+			root = "."
+		}
+		err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			name := info.Name()
+			if p != root && (name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if hasSrcFiles(p) {
+				dirs = append(dirs, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// hasSrcFiles reports whether the directory contains Go source files
+// other than tests
+func hasSrcFiles(dir string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, m := range matches {
+		if !strings.HasSuffix(m, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,48 +1,51 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"os"
-
-	fm "github.com/enocom/fm/lib"
+	"strings"
 )
 
 // Version designates the currently released version of fm
 const Version = "1.2.0"
 
-func main() {
-	printVersion := flag.Bool("version", false, "Print version and exit")
-	outputFilename := flag.String(
-		"out",
-		"fm_test.go",
-		"Name of output file with generated spies",
-	)
-	workingDir := flag.String(
-		"dir",
-		".",
-		"Directory to search for interfaces",
-	)
-	flag.Parse()
+const usage = `Usage:
+    fm [gen] [flags]      generate test doubles (the default command)
+    fm list [packages]    list the interfaces fm would pick up
+    fm extract -type T    declare an interface for a concrete type, then generate
+    fm config show        print the settings read from fm.toml files
+    fm version            print the version
 
-	if *printVersion {
-		fmt.Printf("fm version %s\n", Version)
-		return
-	}
+Run "fm <command> -h" for the flags of a command.
+`
 
-	c := &fm.Cmd{
-		DeclGenerator: &fm.SpyGenerator{
-			Converter:   &fm.SpyStructConverter{},
-			Implementer: &fm.SpyFuncImplementer{},
-		},
-		Parser:       &fm.SrcFileParser{},
-		Writer:       &fm.FileWriter{},
-		ImportWriter: &fm.GoImportsWriter{},
+func main() {
+	// without a command, fm generates test doubles as it always has
+	command, args := "gen", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
 
-	err := c.Run(*workingDir, *outputFilename)
-	if err != nil {
-		fmt.Printf("Error %v\n", err)
+	switch command {
+	case "gen":
+		gen(args)
+	case "list":
+		list(args)
+	case "extract":
+		extract(args)
+	case "config":
+		config(args)
+	case "version":
+		version()
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Printf("Error unknown command %q\n\n%s", command, usage)
 		os.Exit(1)
 	}
 }
+
+// version prints the version of fm
+func version() {
+	fmt.Printf("fm version %s\n", Version)
+}